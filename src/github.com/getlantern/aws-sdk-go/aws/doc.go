@@ -1,3 +1,3 @@
 // Package aws contains support code for the various AWS clients in the
-// github.com/awslabs/aws-sdk-go/gen subpackages.
+// github.com/getlantern/aws-sdk-go/gen subpackages.
 package aws
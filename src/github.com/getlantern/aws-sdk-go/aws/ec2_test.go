@@ -10,7 +10,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/getlantern/aws-sdk-go/aws"
 )
 
 func TestEC2Request(t *testing.T) {
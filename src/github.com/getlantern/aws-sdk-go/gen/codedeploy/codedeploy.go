@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/awslabs/aws-sdk-go/aws"
-	"github.com/awslabs/aws-sdk-go/gen/endpoints"
+	"github.com/getlantern/aws-sdk-go/aws"
+	"github.com/getlantern/aws-sdk-go/gen/endpoints"
 )
 
 // CodeDeploy is a client for AWS CodeDeploy.
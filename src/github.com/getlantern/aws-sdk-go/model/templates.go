@@ -48,8 +48,8 @@ import (
   "net/http"
   "time"
 
-  "github.com/awslabs/aws-sdk-go/aws"
-  "github.com/awslabs/aws-sdk-go/gen/endpoints"
+  "github.com/getlantern/aws-sdk-go/aws"
+  "github.com/getlantern/aws-sdk-go/gen/endpoints"
 )
 
 {{ end }}
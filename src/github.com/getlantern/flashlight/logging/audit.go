@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	auditFile = "lantern-audit.log"
+
+	// auditRotationSize is the size beyond which the audit log is rotated
+	auditRotationSize = 10 * 1024 * 1024
+)
+
+var (
+	audit = &auditLog{rotationSize: auditRotationSize}
+
+	// instanceIdValue is the instance id last passed to Configure
+	instanceIdValue atomic.Value
+)
+
+func init() {
+	instanceIdValue.Store("")
+}
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Timestamp  time.Time         `json:"ts"`
+	Event      string            `json:"event"`
+	InstanceId string            `json:"instanceId,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// Audit records a security relevant event, like a configuration change or a
+// proxy switch, in lantern-audit.log in the logs directory as a JSON line with
+// the timestamp and instance id, masking the secrets given to RegisterSecret
+// in the event and fields. Unlike the other logs, each entry is synced
+// to disk before Audit returns and the audit log is never deleted: once it
+// exceeds 10 MB, it's renamed with a timestamp suffix (and compressed with
+// Options.CompressRotated) and kept indefinitely. Failures are logged as
+// errors.
+func Audit(event string, fields map[string]string) {
+	entry := auditEntry{
+		Timestamp:  time.Now().In(time.UTC),
+		Event:      maskSecrets(event),
+		InstanceId: instanceIdValue.Load().(string),
+	}
+	if fields != nil {
+		entry.Fields = make(map[string]string, len(fields))
+		for key, value := range fields {
+			entry.Fields[maskSecrets(key)] = maskSecrets(value)
+		}
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("Unable to marshal audit event %v: %v", event, err)
+		return
+	}
+	dir := currentLogDir()
+	if dir == "" {
+		log.Errorf("Logging not initialized, unable to audit event %v", event)
+		return
+	}
+	if err := audit.write(filepath.Join(dir, auditFile), append(b, '\n'), currentOptions().CompressRotated); err != nil {
+		log.Errorf("Unable to audit event %v: %v", event, err)
+	}
+}
+
+// auditLog is an append only file synced on every write, which is rotated by
+// renaming rather than deleting.
+type auditLog struct {
+	rotationSize int64
+	mutex        sync.Mutex
+}
+
+func (a *auditLog) write(path string, p []byte, compress bool) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if stat, err := os.Stat(path); err == nil && stat.Size()+int64(len(p)) > a.rotationSize {
+		if err := a.rotate(path, compress); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(p)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// rotate renames the audit log with a timestamp suffix that doesn't collide
+// with any existing file, e.g. lantern-audit-20150601T120000Z.log.
+func (a *auditLog) rotate(path string, compress bool) error {
+	base := strings.TrimSuffix(path, filepath.Ext(path)) + "-" + time.Now().In(time.UTC).Format("20060102T150405Z")
+	rotated := base + filepath.Ext(path)
+	for i := 1; exists(rotated) || exists(rotated+compressedExt); i++ {
+		rotated = fmt.Sprintf("%v-%d%v", base, i, filepath.Ext(path))
+	}
+	if err := os.Rename(path, rotated); err != nil {
+		return fmt.Errorf("Unable to rotate audit log: %v", err)
+	}
+	if compress {
+		if err := compressFile(rotated, validCompressLevel(currentOptions().CompressLevel)); err != nil {
+			log.Errorf("Unable to compress rotated audit log %v: %v", rotated, err)
+		}
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir := logDir
+	defer func() {
+		logDir = oldLogDir
+		instanceIdValue.Store("")
+	}()
+	logDir = dir
+	instanceIdValue.Store("abc123")
+
+	Audit("proxy-switch", map[string]string{"from": "a", "to": "b"})
+	Audit("config-change", nil)
+	b, err := ioutil.ReadFile(filepath.Join(dir, auditFile))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if assert.Len(t, lines, 2) {
+		var entry auditEntry
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+		assert.Equal(t, "proxy-switch", entry.Event)
+		assert.Equal(t, "abc123", entry.InstanceId)
+		assert.Equal(t, map[string]string{"from": "a", "to": "b"}, entry.Fields)
+		assert.False(t, entry.Timestamp.IsZero())
+	}
+}
+
+func TestAuditMasksSecrets(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir := logDir
+	defer func() {
+		logDir = oldLogDir
+	}()
+	defer resetSecrets()
+	logDir = dir
+
+	RegisterSecret("hunter2")
+	Audit("login hunter2", map[string]string{"password": "hunter2", "hunter2": "key"})
+	b, err := ioutil.ReadFile(filepath.Join(dir, auditFile))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotContains(t, string(b), "hunter2", "should mask secrets")
+	var entry auditEntry
+	if assert.NoError(t, json.Unmarshal(b, &entry)) {
+		assert.Equal(t, "login ***", entry.Event)
+		assert.Equal(t, map[string]string{"password": "***", "***": "key"}, entry.Fields)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, auditFile)
+
+	a := &auditLog{rotationSize: 10}
+	for _, s := range []string{"0000000000", "1111111111", "2222222222"} {
+		assert.NoError(t, a.write(path, []byte(s), false))
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "lantern-audit*"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 3, "should never delete rotated audit logs")
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "2222222222", string(b))
+}
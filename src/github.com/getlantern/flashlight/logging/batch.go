@@ -0,0 +1,274 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/go-loggly"
+)
+
+const (
+	logglyBatchSize     = 100
+	logglyMaxPending    = 1000
+	logglyFlushInterval = 5 * time.Second
+
+	defaultLogglyMaxInFlight = 4
+
+	// maxBatchRetryBackoff caps how long a batchingSender waits before
+	// sending again after failures
+	maxBatchRetryBackoff = 5 * time.Minute
+)
+
+var (
+	// logglyBatch holds the *batchingSender of the active Loggly writer, if
+	// any
+	logglyBatch atomic.Value
+
+	logglyBacklog  int64
+	logglyInFlight int64
+
+	// lastLogglySend holds the logglySendResult of the last batch sent
+	lastLogglySend atomic.Value
+
+	logglyCounters = batchCounters{&logglyBacklog, &logglyInFlight, &lastLogglySend}
+)
+
+func init() {
+	logglyBatch.Store((*batchingSender)(nil))
+	lastLogglySend.Store(logglySendResult{})
+}
+
+type logglySendResult struct {
+	at  time.Time
+	err error
+}
+
+// batchCounters are where a batchingSender keeps the number of messages
+// queued, the number of sends in flight and the logglySendResult of the last
+// send.
+type batchCounters struct {
+	backlog  *int64
+	inFlight *int64
+	lastSend *atomic.Value
+}
+
+// newBatchCounters creates batchCounters of its own, for senders that aren't
+// reported in Stats.
+func newBatchCounters() batchCounters {
+	return batchCounters{new(int64), new(int64), &atomic.Value{}}
+}
+
+// PendingLogglyMessages returns a copy of the messages waiting to be sent to
+// Loggly in the next batch.
+func PendingLogglyMessages() []loggly.Message {
+	b := logglyBatch.Load().(*batchingSender)
+	if b == nil {
+		return []loggly.Message{}
+	}
+	return b.pendingMessages()
+}
+
+// setLogglyBatch makes b the active batchingSender, stopping the previous one.
+func setLogglyBatch(b *batchingSender) {
+	if previous := logglyBatch.Load().(*batchingSender); previous != nil && previous != b {
+		previous.stop()
+	}
+	logglyBatch.Store(b)
+}
+
+// stopLogglyBatch stops the active batchingSender, if any, after sending the
+// messages it has queued.
+func stopLogglyBatch() {
+	b := logglyBatch.Load().(*batchingSender)
+	if b == nil {
+		return
+	}
+	logglyBatch.Store((*batchingSender)(nil))
+	b.stop()
+	if err := b.Flush(); err != nil {
+		log.Debugf("Unable to send pending messages to Loggly: %v", err)
+	}
+}
+
+// batchingSender queues messages, passing them on to the next sender in
+// batches every interval or once batchSize are queued, so that the queue can
+// be inspected. At most maxInFlight batches are sent at once, messages
+// otherwise stay queued, up to maxPending. After a failed send, it backs off
+// exponentially from interval up to maxBatchRetryBackoff before sending
+// again, unless flushed explicitly, and flushes the next sender even with
+// nothing queued until a send succeeds.
+type batchingSender struct {
+	next       logglySender
+	batchSize  int
+	maxPending int
+	interval   time.Duration
+	counters   batchCounters
+	inFlight   chan struct{}
+	pending    []loggly.Message
+	failures   uint
+	retryAt    time.Time
+	mutex      sync.Mutex
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+// newBatchingSender creates the batchingSender for Loggly, reported in Stats.
+func newBatchingSender(next logglySender, batchSize int, maxInFlight int, interval time.Duration) *batchingSender {
+	if maxInFlight <= 0 {
+		maxInFlight = defaultLogglyMaxInFlight
+	}
+	return startBatchingSender(next, batchSize, logglyMaxPending, maxInFlight, interval, logglyCounters)
+}
+
+func startBatchingSender(next logglySender, batchSize int, maxPending int, maxInFlight int, interval time.Duration, counters batchCounters) *batchingSender {
+	b := &batchingSender{
+		next:       next,
+		batchSize:  batchSize,
+		maxPending: maxPending,
+		interval:   interval,
+		counters:   counters,
+		inFlight:   make(chan struct{}, maxInFlight),
+		stopCh:     make(chan struct{}),
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stopCh:
+				return
+			case <-ticker.C:
+				b.flush(false)
+			}
+		}
+	}()
+	return b
+}
+
+func (b *batchingSender) Send(m loggly.Message) error {
+	if _, exists := m["timestamp"]; !exists {
+		// Timestamp now rather than when actually sent
+		m["timestamp"] = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	b.mutex.Lock()
+	b.pending = append(b.pending, m)
+	if len(b.pending) > b.maxPending {
+		b.pending = b.pending[len(b.pending)-b.maxPending:]
+	}
+	full := len(b.pending) >= b.batchSize
+	atomic.StoreInt64(b.counters.backlog, int64(len(b.pending)))
+	b.mutex.Unlock()
+	if full {
+		go b.flush(false)
+	}
+	return nil
+}
+
+func (b *batchingSender) SetDefault(key string, value interface{}) {
+	b.next.SetDefault(key, value)
+}
+
+// Flush passes on the queued messages and flushes the next sender, waiting
+// for one of the in-flight sends to finish if needed.
+func (b *batchingSender) Flush() error {
+	return b.flush(true)
+}
+
+// flush passes on the queued messages if fewer than maxInFlight sends are in
+// flight and it's not backing off, or if wait is set, leaving them queued
+// otherwise.
+func (b *batchingSender) flush(wait bool) error {
+	if wait {
+		b.inFlight <- struct{}{}
+	} else {
+		b.mutex.Lock()
+		backingOff := time.Now().Before(b.retryAt)
+		b.mutex.Unlock()
+		if backingOff {
+			return nil
+		}
+		select {
+		case b.inFlight <- struct{}{}:
+		default:
+			return nil
+		}
+	}
+	atomic.AddInt64(b.counters.inFlight, 1)
+	defer func() {
+		atomic.AddInt64(b.counters.inFlight, -1)
+		<-b.inFlight
+	}()
+
+	b.mutex.Lock()
+	batch := b.pending
+	b.pending = nil
+	atomic.StoreInt64(b.counters.backlog, 0)
+	failing := b.failures > 0
+	b.mutex.Unlock()
+	if len(batch) == 0 && !failing {
+		// After failures, the next sender is flushed regardless in case it
+		// kept what it failed to send
+		return nil
+	}
+	err := b.send(batch)
+	now := time.Now()
+	b.counters.lastSend.Store(logglySendResult{now, err})
+	b.mutex.Lock()
+	if err != nil {
+		b.retryAt = now.Add(b.backoff())
+		b.failures++
+	} else {
+		b.failures = 0
+		b.retryAt = time.Time{}
+	}
+	b.mutex.Unlock()
+	return err
+}
+
+// backoff returns how long to wait before sending again after the next
+// failure. It must be called with the mutex held.
+func (b *batchingSender) backoff() time.Duration {
+	backoff := b.interval
+	for i := uint(0); i < b.failures && backoff < maxBatchRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBatchRetryBackoff {
+		backoff = maxBatchRetryBackoff
+	}
+	return backoff
+}
+
+func (b *batchingSender) send(batch []loggly.Message) error {
+	for _, m := range batch {
+		if err := b.next.Send(m); err != nil {
+			return err
+		}
+	}
+	if f, ok := b.next.(flushingSender); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (b *batchingSender) pendingMessages() []loggly.Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	result := make([]loggly.Message, 0, len(b.pending))
+	for _, m := range b.pending {
+		c := make(loggly.Message, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// stop flushes the queued messages and stops the periodic flushes.
+func (b *batchingSender) stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+		go b.Flush()
+	})
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+var benchLine = []byte("DEBUG flashlight.proxy: proxy.go:10 dialing 10.0.0.1:443 for www.example.com:443\n")
+
+func benchmarkNonStopWriter(b *testing.B, n int) {
+	writers := make([]io.Writer, n)
+	for i := range writers {
+		writers[i] = ioutil.Discard
+	}
+	w := NonStopWriter(writers...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Write(benchLine)
+	}
+}
+
+func BenchmarkNonStopWriter1(b *testing.B) { benchmarkNonStopWriter(b, 1) }
+func BenchmarkNonStopWriter2(b *testing.B) { benchmarkNonStopWriter(b, 2) }
+func BenchmarkNonStopWriter3(b *testing.B) { benchmarkNonStopWriter(b, 3) }
+
+// BenchmarkWritePath writes through the debug stream as set up by Init
+// without Loggly, discarding the output.
+func BenchmarkWritePath(b *testing.B) {
+	_, stdout := consoleOutputs(ioutil.Discard, ioutil.Discard, false, true)
+	fileOut := gated(destFile, &lockedWriter{w: formatted(ioutil.Discard, FormatText)})
+	recent := newLineRing(defaultRecentLogsSize)
+	var lines uint64
+	debugOut := NonStopWriter(gated(destStdout, stdout), fileOut)
+	debugOut = observeLines(captureLines(recordLines(debugOut, recent)))
+	debugOut = filterLevels(countLines(debugOut, &lines), levelEnabled)
+	w := &lineFilter{debugOut}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Write(benchLine)
+	}
+}
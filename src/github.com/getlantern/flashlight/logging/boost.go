@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// boostedLevels holds the map[string]bool of the levels sent to Loggly
+	// from the debug stream during a boost, nil otherwise
+	boostedLevels atomic.Value
+
+	boostMutex sync.Mutex
+	boostTimer *time.Timer
+	boostUntil time.Time
+)
+
+func init() {
+	boostedLevels.Store(map[string]bool(nil))
+}
+
+// BoostRemoteLogging also sends lines of the given levels, like DEBUG, to
+// Loggly for the duration d, e.g. to troubleshoot a live issue, after which
+// only errors are sent again. Boosting while a boost is in effect adds the
+// levels and extends it rather than starting another one.
+func BoostRemoteLogging(levels []string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("Invalid boost duration %v", d)
+	}
+	for _, level := range levels {
+		if _, found := levelRanks[strings.ToUpper(level)]; !found {
+			return fmt.Errorf("Unknown log level %v", level)
+		}
+	}
+
+	boostMutex.Lock()
+	defer boostMutex.Unlock()
+	boosted := make(map[string]bool)
+	for level := range boostedLevels.Load().(map[string]bool) {
+		boosted[level] = true
+	}
+	for _, level := range levels {
+		boosted[strings.ToUpper(level)] = true
+	}
+	boostedLevels.Store(boosted)
+	until := time.Now().Add(d)
+	if boostTimer != nil && boostUntil.After(until) {
+		until = boostUntil
+	}
+	boostUntil = until
+	if boostTimer == nil {
+		boostTimer = time.AfterFunc(time.Until(until), endBoost)
+	} else {
+		boostTimer.Reset(time.Until(until))
+	}
+	logInfo(fmt.Sprintf("Sending %v to Loggly until %v", strings.Join(sortedLevels(boosted), ", "),
+		until.In(time.UTC).Format(time.RFC3339)))
+	return nil
+}
+
+// endBoost ends the current boost, if any.
+func endBoost() {
+	boostMutex.Lock()
+	defer boostMutex.Unlock()
+	if boostTimer == nil {
+		return
+	}
+	boostTimer.Stop()
+	boostTimer = nil
+	boostedLevels.Store(map[string]bool(nil))
+	logInfo("Only sending errors to Loggly again")
+}
+
+func sortedLevels(levels map[string]bool) []string {
+	sorted := make([]string, 0, len(levels))
+	for level := range levels {
+		sorted = append(sorted, level)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return levelRanks[sorted[i]] < levelRanks[sorted[j]]
+	})
+	return sorted
+}
+
+// remoteBooster also writes the lines of the boosted levels to Loggly.
+type remoteBooster struct {
+	io.Writer
+}
+
+func (w *remoteBooster) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *remoteBooster) writeAt(p []byte, t time.Time) (int, error) {
+	if boosted := boostedLevels.Load().(map[string]bool); boosted != nil && boosted[levelOf(p)] {
+		if lw := activeLoggly(); lw != nil && destinationEnabled(logglyRemote) {
+			writeTimed(lw, p, t)
+		}
+	}
+	return writeTimed(w.Writer, p, t)
+}
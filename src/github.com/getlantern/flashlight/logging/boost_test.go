@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoostRemoteLogging(t *testing.T) {
+	defer golog.ResetOutputs()
+	defer endBoost()
+	var remoteBuf syncBuffer
+	addLoggly(&remoteBuf)
+	defer removeLoggly()
+
+	var local bytes.Buffer
+	w := &remoteBooster{&local}
+	w.Write([]byte("DEBUG test: a.go:1 before\n"))
+	assert.Equal(t, "", remoteBuf.String(), "should only send errors without a boost")
+
+	assert.Error(t, BoostRemoteLogging([]string{"VERBOSE"}, time.Minute))
+	assert.Error(t, BoostRemoteLogging([]string{levelDebug}, 0))
+	assert.NoError(t, BoostRemoteLogging([]string{"debug"}, 50*time.Millisecond))
+	w.Write([]byte("DEBUG test: a.go:2 boosted\n"))
+	w.Write([]byte("INFO test: a.go:3 not boosted\n"))
+	assert.Equal(t, "DEBUG test: a.go:2 boosted\n", remoteBuf.String())
+	assert.Contains(t, local.String(), "boosted", "should still write locally")
+
+	assert.NoError(t, BoostRemoteLogging([]string{levelInfo}, 100*time.Millisecond))
+	time.Sleep(70 * time.Millisecond)
+	w.Write([]byte("DEBUG test: a.go:4 extended\n"))
+	w.Write([]byte("INFO test: a.go:5 added\n"))
+	assert.Contains(t, remoteBuf.String(), "extended", "should extend the boost and keep its levels")
+	assert.Contains(t, remoteBuf.String(), "added")
+
+	time.Sleep(100 * time.Millisecond)
+	w.Write([]byte("DEBUG test: a.go:6 after\n"))
+	assert.NotContains(t, remoteBuf.String(), "after", "should revert once the boost is over")
+}
+
+func TestBoostRespectsDestination(t *testing.T) {
+	defer golog.ResetOutputs()
+	defer endBoost()
+	var remoteBuf syncBuffer
+	addLoggly(&remoteBuf)
+	defer removeLoggly()
+	SetDestinationEnabled(logglyRemote, false)
+	defer SetDestinationEnabled(logglyRemote, true)
+
+	BoostRemoteLogging([]string{levelDebug}, time.Minute)
+	(&remoteBooster{ioutil.Discard}).Write([]byte("DEBUG test: a.go:1 boosted\n"))
+	assert.Equal(t, "", remoteBuf.String())
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// bufferBudget is Options.MaxBufferBytes, accessed atomically
+	bufferBudget int64
+
+	// captureBytes is the size of the lines held by all capture scopes
+	captureBytes int64
+
+	// trimMutex keeps concurrent writers from trimming at the same time
+	trimMutex sync.Mutex
+)
+
+// bufferUsage returns the size of the lines held in memory by the recent
+// logs, the error history and the capture scopes combined.
+func bufferUsage() int64 {
+	return atomic.LoadInt64(&recentLogs.bytes) + atomic.LoadInt64(&errorHistory.bytes) + atomic.LoadInt64(&captureBytes)
+}
+
+// checkBufferBudget trims the in-memory buffers if they exceed
+// Options.MaxBufferBytes. It must be called without holding any of their
+// locks.
+func checkBufferBudget() {
+	budget := atomic.LoadInt64(&bufferBudget)
+	if budget <= 0 || bufferUsage() <= budget {
+		return
+	}
+	trimMutex.Lock()
+	defer trimMutex.Unlock()
+	// Evict from the least valuable buffer first: the raw recent lines, then
+	// the error history and only then what capture scopes asked for
+	excess := bufferUsage() - budget
+	if excess > 0 {
+		excess -= recentLogs.trim(excess)
+	}
+	if excess > 0 {
+		excess -= errorHistory.trim(excess)
+	}
+	if excess > 0 {
+		capturesMutex.RLock()
+		for c := range captures {
+			if excess -= c.trim(excess); excess <= 0 {
+				break
+			}
+		}
+		capturesMutex.RUnlock()
+	}
+}
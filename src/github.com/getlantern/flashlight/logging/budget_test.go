@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferBudget(t *testing.T) {
+	recentLogs.reset(100)
+	errorHistory.reset(100)
+	atomic.StoreInt64(&bufferBudget, 2000)
+	defer func() {
+		atomic.StoreInt64(&bufferBudget, 0)
+		recentLogs.reset(defaultRecentLogsSize)
+		errorHistory.reset(defaultErrorHistorySize)
+	}()
+	errOut := recordErrors(recordLines(ioutil.Discard, recentLogs), errorHistory)
+	dbgOut := recordLines(ioutil.Discard, recentLogs)
+
+	msg := strings.Repeat("x", 80)
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(errOut, "ERROR test: a.go:%d %v\n", i, msg)
+	}
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(dbgOut, "DEBUG test: a.go:%d %v\n", i, msg)
+	}
+	assert.True(t, Stats().BufferBytes <= 2000, "should stay within budget, used %d", Stats().BufferBytes)
+	assert.Len(t, RecentErrors(), 5, "should trim the recent lines before the errors")
+	recent := RecentLogs()
+	assert.True(t, len(recent) < 25, "should have evicted recent lines")
+	assert.True(t, strings.HasSuffix(recent[len(recent)-1], "DEBUG test: a.go:19 "+msg), "should keep the newest lines")
+
+	stop := CaptureScope()
+	captured := captureLines(ioutil.Discard)
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(captured, "DEBUG test: a.go:%d %v\n", i, msg)
+	}
+	assert.True(t, Stats().BufferBytes <= 2000, "should stay within budget, used %d", Stats().BufferBytes)
+	assert.Empty(t, RecentLogs())
+	assert.Empty(t, RecentErrors(), "should trim errors before captured lines")
+	lines := stop()
+	assert.True(t, len(lines) > 0 && len(lines) < 30)
+	assert.Equal(t, "DEBUG test: a.go:29 "+msg, lines[len(lines)-1])
+	assert.Equal(t, int64(0), Stats().BufferBytes, "stopping the capture should release its lines")
+}
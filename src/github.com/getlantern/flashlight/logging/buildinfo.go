@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"unicode"
+)
+
+const (
+	// maxBuildInfoLength is the maximum length of a BuildInfo field
+	maxBuildInfoLength = 64
+)
+
+// BuildInfo is build metadata beyond the version and build date, included in
+// every message sent to Loggly. Empty fields are left out.
+type BuildInfo struct {
+	// Commit is the SHA of the commit that was built
+	Commit string
+	// Channel is the release channel, like beta or stable
+	Channel string
+	// BuildNumber identifies the build on the build server
+	BuildNumber string
+}
+
+// fields returns the Loggly fields for the valid, non-empty fields of the
+// BuildInfo. Invalid fields are logged and left out.
+func (b BuildInfo) fields() map[string]string {
+	fields := make(map[string]string)
+	for key, value := range map[string]string{
+		"commit":      b.Commit,
+		"channel":     b.Channel,
+		"buildNumber": b.BuildNumber,
+	} {
+		if value == "" {
+			continue
+		}
+		if !validBuildInfo(value) {
+			log.Errorf("Invalid build info %v, not sending it to Loggly: %q", key, value)
+			continue
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// validBuildInfo checks that value is reasonably short and printable.
+func validBuildInfo(value string) bool {
+	if len(value) > maxBuildInfoLength {
+		return false
+	}
+	for _, r := range value {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,17 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfoFields(t *testing.T) {
+	assert.Equal(t, map[string]string{}, BuildInfo{}.fields())
+	assert.Equal(t, map[string]string{"commit": "1a2b3c4", "channel": "beta", "buildNumber": "1234"},
+		BuildInfo{Commit: "1a2b3c4", Channel: "beta", BuildNumber: "1234"}.fields())
+	assert.Equal(t, map[string]string{"channel": "beta"},
+		BuildInfo{Commit: strings.Repeat("a", maxBuildInfoLength+1), Channel: "beta", BuildNumber: "12\n34"}.fields(),
+		"should leave out invalid fields")
+}
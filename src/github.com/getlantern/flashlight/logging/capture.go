@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	captures      = make(map[*capture]bool)
+	capturesMutex sync.RWMutex
+)
+
+type capture struct {
+	lines []string
+	// bytes is the size of lines, counted in captureBytes while capturing
+	bytes int64
+	mutex sync.Mutex
+}
+
+// CaptureScope starts capturing all logged lines into a private buffer until
+// the returned stop function is called, which returns the captured lines. This
+// allows surfacing the logs produced during a specific operation, like a
+// connectivity test. Several scopes can be active at once, each getting its
+// own copy of the lines. Only lines logged after Init are captured.
+func CaptureScope() (stop func() []string) {
+	c := &capture{}
+	capturesMutex.Lock()
+	captures[c] = true
+	capturesMutex.Unlock()
+
+	var once sync.Once
+	return func() []string {
+		once.Do(func() {
+			capturesMutex.Lock()
+			delete(captures, c)
+			capturesMutex.Unlock()
+			c.mutex.Lock()
+			atomic.AddInt64(&captureBytes, -c.bytes)
+			c.mutex.Unlock()
+		})
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return append([]string(nil), c.lines...)
+	}
+}
+
+type captureTee struct {
+	io.Writer
+}
+
+// captureLines creates a writer that adds each line written to it to all
+// active capture scopes before passing it on to w.
+func captureLines(w io.Writer) io.Writer {
+	return &captureTee{w}
+}
+
+func (w *captureTee) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *captureTee) writeAt(p []byte, t time.Time) (int, error) {
+	capturesMutex.RLock()
+	if len(captures) > 0 {
+		line := strings.TrimRight(string(p), "\r\n")
+		for c := range captures {
+			c.mutex.Lock()
+			c.lines = append(c.lines, line)
+			c.bytes += int64(len(line))
+			atomic.AddInt64(&captureBytes, int64(len(line)))
+			c.mutex.Unlock()
+		}
+	}
+	capturesMutex.RUnlock()
+	checkBufferBudget()
+	return writeTimed(w.Writer, p, t)
+}
+
+// trim drops the oldest captured lines until at least n bytes are freed or
+// none are left, returning the number of bytes freed.
+func (c *capture) trim(n int64) int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var freed int64
+	i := 0
+	for ; i < len(c.lines) && freed < n; i++ {
+		freed += int64(len(c.lines[i]))
+	}
+	c.lines = append([]string(nil), c.lines[i:]...)
+	c.bytes -= freed
+	atomic.AddInt64(&captureBytes, -freed)
+	return freed
+}
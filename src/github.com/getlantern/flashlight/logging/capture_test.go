@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureScope(t *testing.T) {
+	w := captureLines(ioutil.Discard)
+	fmt.Fprintln(w, "before")
+
+	stop1 := CaptureScope()
+	fmt.Fprintln(w, "one")
+	stop2 := CaptureScope()
+	fmt.Fprintln(w, "two")
+	assert.Equal(t, []string{"one", "two"}, stop1())
+	fmt.Fprintln(w, "three")
+	assert.Equal(t, []string{"two", "three"}, stop2())
+	assert.Equal(t, []string{"one", "two"}, stop1(), "stopping twice should be harmless")
+}
+
+func TestCaptureScopeConcurrent(t *testing.T) {
+	w := captureLines(ioutil.Discard)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stop := CaptureScope()
+			for j := 0; j < 100; j++ {
+				fmt.Fprintf(w, "%d %d\n", i, j)
+			}
+			assert.True(t, len(stop()) >= 100)
+		}(i)
+	}
+	wg.Wait()
+}
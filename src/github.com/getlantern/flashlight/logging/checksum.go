@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// checksumExt is appended to the path of a rotated file for its sidecar with
+// the line count and checksum.
+const checksumExt = ".meta"
+
+// writeChecksum writes the sidecar of the completed file at path, containing
+// the number of lines in the file and the SHA-256 of its contents as stored,
+// i.e. compressed if path is compressed. The lines are counted in the
+// uncompressed contents.
+func writeChecksum(path string) error {
+	lines, sum, err := checksumFile(path)
+	if err != nil {
+		return err
+	}
+	meta := fmt.Sprintf("lines=%d\nsha256=%v\n", lines, sum)
+	return ioutil.WriteFile(path+checksumExt, []byte(meta), 0644)
+}
+
+// checksumFile returns the number of lines in the file at path and the hex
+// encoded SHA-256 of its contents.
+func checksumFile(path string) (lines int, sum string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	hashed := io.TeeReader(bufio.NewReader(f), hash)
+	contents := hashed
+	if strings.HasSuffix(path, compressedExt) {
+		gz, err := gzip.NewReader(contents)
+		if err != nil {
+			return 0, "", err
+		}
+		defer gz.Close()
+		contents = gz
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := contents.Read(buf)
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	// Hash anything gzip didn't need to read
+	if _, err := io.Copy(ioutil.Discard, hashed); err != nil {
+		return 0, "", err
+	}
+	return lines, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyLogFile checks a rotated log file against the line count and
+// checksum written next to it with Options.RotatedChecksums, e.g. before
+// shipping it, returning an error if it was altered or truncated.
+func VerifyLogFile(path string) error {
+	meta, err := ioutil.ReadFile(path + checksumExt)
+	if err != nil {
+		return fmt.Errorf("Unable to read checksum of %v: %v", path, err)
+	}
+	lines, sum, err := checksumFile(path)
+	if err != nil {
+		return fmt.Errorf("Unable to checksum %v: %v", path, err)
+	}
+	if expected := fmt.Sprintf("lines=%d\nsha256=%v\n", lines, sum); string(meta) != expected {
+		return fmt.Errorf("Log file %v doesn't match its checksum", path)
+	}
+	return nil
+}
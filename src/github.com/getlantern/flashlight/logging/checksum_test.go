@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatedChecksums(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	r.RotationSize = 20
+	r.MaxRotation = 2
+	r.Compress = true
+	r.Checksums = true
+	defer r.Close()
+
+	for _, s := range []string{"line 1\nline 2\n", "line 3\nline 4\n", "line 5\n", "line 6\n"} {
+		r.Write([]byte(s))
+	}
+	awaitCompression(r)
+	meta, err := ioutil.ReadFile(path + ".1.gz.meta")
+	if assert.NoError(t, err) {
+		assert.Regexp(t, "^lines=2\nsha256=[0-9a-f]{64}\n$", string(meta))
+	}
+	assert.NoError(t, VerifyLogFile(path+".1.gz"))
+	assert.NoError(t, VerifyLogFile(path+".2.gz"), "checksum should follow the file when shifted")
+
+	assert.NoError(t, ioutil.WriteFile(path+".2.gz", []byte("altered"), 0644))
+	assert.Error(t, VerifyLogFile(path+".2.gz"))
+	assert.Error(t, VerifyLogFile(path), "current file has no checksum")
+
+	r.Write([]byte("line 7\nline 8\nline 9\n"))
+	assert.NoError(t, VerifyLogFile(path+".2.gz"), "should replace the checksum along with the oldest file")
+}
+
+func TestDatedChecksums(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+
+	r := newSizeRotator(filepath.Join(dir, "lantern.log"))
+	r.Dated = true
+	r.RotationSize = 10
+	r.Checksums = true
+	defer r.Close()
+	r.Write([]byte("0000\n1111\n"))
+	r.Write([]byte("2222\n"))
+
+	completed := r.datedFiles()[0].path
+	assert.NoError(t, VerifyLogFile(completed))
+	assert.NoError(t, ioutil.WriteFile(completed, []byte("0000\n"), 0644))
+	assert.Error(t, VerifyLogFile(completed), "should detect truncation")
+}
+
+func TestChecksumFailure(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	var errOut syncBuffer
+	rotationErrorOut = &errOut
+	defer func() {
+		rotationErrorOut = os.Stderr
+	}()
+
+	r := newSizeRotator(filepath.Join(dir, "lantern.log"))
+	r.Dated = true
+	r.RotationSize = 10
+	r.Checksums = true
+	defer r.Close()
+	completed := r.currentPath()
+	// A directory in the way of the checksum can't be written over
+	assert.NoError(t, os.Mkdir(completed+checksumExt, 0755))
+
+	errorsBefore := Stats().RotationErrors
+	for _, s := range []string{"0000\n1111\n", "2222\n"} {
+		_, err := r.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	assert.Contains(t, errOut.String(), "ERROR flashlight.logging: Unable to write checksum of rotated log file "+completed)
+	assert.EqualValues(t, 1, Stats().RotationErrors-errorsBefore)
+}
@@ -0,0 +1,278 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/aws-sdk-go/aws"
+	"github.com/getlantern/aws-sdk-go/gen/logs"
+	"github.com/getlantern/go-loggly"
+)
+
+const (
+	cloudWatchRemote = "cloudwatch"
+
+	cloudWatchFlushInterval = 5 * time.Second
+	cloudWatchBatchSize     = 1000
+	cloudWatchMaxBuffered   = 10000
+
+	// Limits of PutLogEvents: each event counts for its message plus 26
+	// bytes towards the batch size.
+	cloudWatchMaxBatchEvents  = 10000
+	cloudWatchMaxBatchBytes   = 1048576
+	cloudWatchEventOverhead   = 26
+	cloudWatchMaxMessageBytes = 262144 - cloudWatchEventOverhead
+)
+
+// CloudWatchCredentials are the AWS credentials used to sign requests to
+// CloudWatch Logs. SessionToken is only needed for temporary credentials.
+type CloudWatchCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// ConfigureCloudWatch starts sending the error stream to the given CloudWatch
+// Logs group and stream in the given AWS region, through the proxy last
+// passed to Configure. The group and stream are created if missing. Events
+// are batched within the PutLogEvents limits, and events that fail to send
+// are retried with the next batch, backing off like Loggly, up to a bounded
+// backlog. An empty group stops sending.
+func ConfigureCloudWatch(region, group, stream string, creds CloudWatchCredentials) error {
+	if group == "" {
+		stopCloudWatch()
+		return nil
+	}
+	if region == "" || stream == "" {
+		return fmt.Errorf("Both a region and a stream are needed to send logs to CloudWatch")
+	}
+	client, err := proxiedHTTPClient()
+	if err != nil {
+		return fmt.Errorf("Unable to send logs to CloudWatch: %v", err)
+	}
+	provider := aws.Creds(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken)
+	configureCloudWatch(logs.New(provider, region, client), group, stream, cloudWatchFlushInterval)
+	return nil
+}
+
+func configureCloudWatch(client *logs.Logs, group, stream string, flushInterval time.Duration) *cloudWatchWriter {
+	stopCloudWatch()
+	sender := &cloudWatchSender{
+		client: client,
+		group:  group,
+		stream: stream,
+	}
+	// Sends are serialized since each needs the sequence token returned by
+	// the previous one
+	w := &cloudWatchWriter{startBatchingSender(sender, cloudWatchBatchSize, cloudWatchMaxBuffered, 1, flushInterval, newBatchCounters())}
+	setRemote(cloudWatchRemote, w)
+	return w
+}
+
+// stopCloudWatch stops sending to CloudWatch, flushing any pending events.
+func stopCloudWatch() {
+	w, _ := remote(cloudWatchRemote).(*cloudWatchWriter)
+	if w == nil {
+		return
+	}
+	setRemote(cloudWatchRemote, nil)
+	w.batch.stop()
+	if err := w.batch.Flush(); err != nil {
+		log.Debugf("Unable to send pending log events to CloudWatch: %v", err)
+	}
+}
+
+// cloudWatchWriter queues the lines written to it as messages for a
+// cloudWatchSender, which the batchingSender passes on in batches.
+type cloudWatchWriter struct {
+	batch *batchingSender
+}
+
+func (w *cloudWatchWriter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *cloudWatchWriter) writeAt(p []byte, t time.Time) (int, error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	if len(msg) > cloudWatchMaxMessageBytes {
+		msg = msg[:cloudWatchMaxMessageBytes]
+	}
+	w.batch.Send(loggly.Message{
+		"timestamp": t.UnixNano() / int64(time.Millisecond),
+		"message":   msg,
+	})
+	return len(p), nil
+}
+
+// flush sends the queued events right away.
+func (w *cloudWatchWriter) flush() error {
+	return w.batch.Flush()
+}
+
+type cloudWatchEvent struct {
+	timestamp int64
+	message   string
+}
+
+// cloudWatchSender is the logglySender that puts the messages it's given to
+// CloudWatch Logs with PutLogEvents when flushed. Events that fail to send
+// are kept for the next flush, up to cloudWatchMaxBuffered.
+type cloudWatchSender struct {
+	client *logs.Logs
+	group  string
+	stream string
+
+	mutex         sync.Mutex
+	events        []cloudWatchEvent
+	sequenceToken string
+}
+
+func (s *cloudWatchSender) Send(m loggly.Message) error {
+	timestamp, _ := m["timestamp"].(int64)
+	message, _ := m["message"].(string)
+	s.mutex.Lock()
+	s.events = append(s.events, cloudWatchEvent{timestamp, message})
+	if len(s.events) > cloudWatchMaxBuffered {
+		s.events = s.events[len(s.events)-cloudWatchMaxBuffered:]
+	}
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *cloudWatchSender) SetDefault(key string, value interface{}) {
+}
+
+// Flush sends the events given so far in as many batches as needed, keeping
+// the unsent ones if sending fails.
+func (s *cloudWatchSender) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// PutLogEvents requires chronological order, which lines logged with
+	// WriteAt may not be in
+	sort.SliceStable(s.events, func(i, j int) bool {
+		return s.events[i].timestamp < s.events[j].timestamp
+	})
+	for len(s.events) > 0 {
+		n := cloudWatchBatchLen(s.events)
+		if err := s.send(s.events[:n]); err != nil {
+			return fmt.Errorf("Unable to send %d log events to CloudWatch: %v", len(s.events), err)
+		}
+		s.events = s.events[n:]
+	}
+	s.events = nil
+	return nil
+}
+
+// cloudWatchBatchLen returns how many of the given events fit in one
+// PutLogEvents request.
+func cloudWatchBatchLen(events []cloudWatchEvent) int {
+	size := 0
+	for i, e := range events {
+		size += len(e.message) + cloudWatchEventOverhead
+		if i == cloudWatchMaxBatchEvents || size > cloudWatchMaxBatchBytes {
+			return i
+		}
+	}
+	return len(events)
+}
+
+// send puts the given events, creating the log group and stream if they
+// don't exist yet and retrying once with the current sequence token if the
+// one used was rejected. It must be called with the mutex held.
+func (s *cloudWatchSender) send(events []cloudWatchEvent) error {
+	err := s.put(events)
+	switch {
+	case err == nil:
+		return nil
+	case isAWSError(err, "ResourceNotFoundException"):
+		if err := s.create(); err != nil {
+			return err
+		}
+		s.sequenceToken = ""
+	case isAWSError(err, "InvalidSequenceTokenException"):
+		if err := s.refreshSequenceToken(); err != nil {
+			return err
+		}
+	case isAWSError(err, "DataAlreadyAcceptedException"):
+		return s.refreshSequenceToken()
+	default:
+		return err
+	}
+	return s.put(events)
+}
+
+func (s *cloudWatchSender) put(events []cloudWatchEvent) error {
+	req := &logs.PutLogEventsRequest{
+		LogEvents:     make([]logs.InputLogEvent, 0, len(events)),
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+	}
+	for _, e := range events {
+		req.LogEvents = append(req.LogEvents, logs.InputLogEvent{
+			Message:   aws.String(e.message),
+			Timestamp: aws.Long(e.timestamp),
+		})
+	}
+	if s.sequenceToken != "" {
+		req.SequenceToken = aws.String(s.sequenceToken)
+	}
+	resp, err := s.client.PutLogEvents(req)
+	if err != nil {
+		return err
+	}
+	s.sequenceToken = ""
+	if resp.NextSequenceToken != nil {
+		s.sequenceToken = *resp.NextSequenceToken
+	}
+	return nil
+}
+
+// refreshSequenceToken looks up the sequence token to use for the next put.
+func (s *cloudWatchSender) refreshSequenceToken() error {
+	resp, err := s.client.DescribeLogStreams(&logs.DescribeLogStreamsRequest{
+		LogGroupName:        aws.String(s.group),
+		LogStreamNamePrefix: aws.String(s.stream),
+	})
+	if err != nil {
+		return err
+	}
+	for _, stream := range resp.LogStreams {
+		if stream.LogStreamName != nil && *stream.LogStreamName == s.stream {
+			s.sequenceToken = ""
+			if stream.UploadSequenceToken != nil {
+				s.sequenceToken = *stream.UploadSequenceToken
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("Log stream %v not found in group %v", s.stream, s.group)
+}
+
+// create creates the log group and stream, ignoring those that already
+// exist.
+func (s *cloudWatchSender) create() error {
+	err := s.client.CreateLogGroup(&logs.CreateLogGroupRequest{LogGroupName: aws.String(s.group)})
+	if err != nil && !isAWSError(err, "ResourceAlreadyExistsException") {
+		return err
+	}
+	err = s.client.CreateLogStream(&logs.CreateLogStreamRequest{
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+	})
+	if err != nil && !isAWSError(err, "ResourceAlreadyExistsException") {
+		return err
+	}
+	return nil
+}
+
+// isAWSError tells whether err is the given exception returned by AWS. The
+// type may be prefixed with a namespace, like
+// "com.amazonaws.logs#InvalidSequenceTokenException".
+func isAWSError(err error, exception string) bool {
+	apiErr, ok := err.(aws.APIError)
+	return ok && (apiErr.Type == exception || strings.HasSuffix(apiErr.Type, "#"+exception))
+}
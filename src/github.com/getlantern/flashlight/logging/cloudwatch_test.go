@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/aws-sdk-go/aws"
+	"github.com/getlantern/aws-sdk-go/gen/logs"
+	"github.com/stretchr/testify/assert"
+)
+
+// redirectingTransport sends all requests to the server at target instead.
+type redirectingTransport struct {
+	target *url.URL
+}
+
+func (t *redirectingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func testCloudWatchClient(serverURL string) *logs.Logs {
+	target, _ := url.Parse(serverURL)
+	client := &http.Client{Transport: &redirectingTransport{target}}
+	return logs.New(aws.Creds("AKID", "secret", ""), "us-east-1", client)
+}
+
+func TestCloudWatchExport(t *testing.T) {
+	var mutex sync.Mutex
+	var actions []string
+	var puts []map[string]interface{}
+	created, staleToken, unavailable := false, false, false
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Equal(t, "application/x-amz-json-1.1", req.Header.Get("Content-Type"))
+		action := strings.TrimPrefix(req.Header.Get("X-Amz-Target"), "Logs_20140328.")
+		actions = append(actions, action)
+		b, _ := ioutil.ReadAll(req.Body)
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(b, &body))
+		fail := func(exception string) {
+			resp.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(resp, `{"__type":"%v","message":"failed"}`, exception)
+		}
+		switch action {
+		case "CreateLogGroup":
+			assert.Equal(t, "lantern", body["logGroupName"])
+			created = true
+			fmt.Fprint(resp, `{}`)
+		case "CreateLogStream":
+			assert.Equal(t, "client", body["logStreamName"])
+			fail("ResourceAlreadyExistsException")
+		case "DescribeLogStreams":
+			assert.Equal(t, "client", body["logStreamNamePrefix"])
+			fmt.Fprint(resp, `{"logStreams":[{"logStreamName":"client-2","uploadSequenceToken":"other"},{"logStreamName":"client","uploadSequenceToken":"t2"}]}`)
+		case "PutLogEvents":
+			switch {
+			case unavailable:
+				resp.WriteHeader(http.StatusServiceUnavailable)
+			case !created:
+				fail("ResourceNotFoundException")
+			case staleToken:
+				staleToken = false
+				fail("com.amazonaws.logs#InvalidSequenceTokenException")
+			default:
+				puts = append(puts, body)
+				fmt.Fprint(resp, `{"nextSequenceToken":"t1"}`)
+			}
+		}
+	}))
+	defer server.Close()
+
+	w := configureCloudWatch(testCloudWatchClient(server.URL), "lantern", "client", time.Hour)
+	defer stopCloudWatch()
+	fmt.Fprintln(w, "ERROR flashlight.proxy: proxy.go:10 unable to dial")
+	assert.NoError(t, w.flush())
+	mutex.Lock()
+	assert.Equal(t, []string{"PutLogEvents", "CreateLogGroup", "CreateLogStream", "PutLogEvents"}, actions, "should create the group and stream when missing")
+	if assert.Len(t, puts, 1) {
+		_, hasToken := puts[0]["sequenceToken"]
+		assert.False(t, hasToken, "new stream shouldn't need a sequence token")
+		events := puts[0]["logEvents"].([]interface{})
+		assert.Equal(t, "ERROR flashlight.proxy: proxy.go:10 unable to dial", events[0].(map[string]interface{})["message"])
+	}
+	staleToken = true
+	mutex.Unlock()
+
+	fmt.Fprintln(w, "ERROR flashlight: main.go:1 second")
+	assert.NoError(t, w.flush())
+	mutex.Lock()
+	if assert.Len(t, puts, 2, "should retry with the current sequence token") {
+		assert.Equal(t, "t2", puts[1]["sequenceToken"])
+	}
+	unavailable = true
+	mutex.Unlock()
+
+	fmt.Fprintln(w, "ERROR flashlight: main.go:1 third")
+	assert.Error(t, w.flush())
+	mutex.Lock()
+	unavailable = false
+	mutex.Unlock()
+	assert.NoError(t, w.flush())
+	mutex.Lock()
+	defer mutex.Unlock()
+	if assert.Len(t, puts, 3, "should send events that failed to send with the next flush") {
+		events := puts[2]["logEvents"].([]interface{})
+		assert.Equal(t, "ERROR flashlight: main.go:1 third", events[0].(map[string]interface{})["message"])
+	}
+}
+
+func TestCloudWatchBatchLen(t *testing.T) {
+	events := make([]cloudWatchEvent, cloudWatchMaxBatchEvents+5)
+	assert.Equal(t, cloudWatchMaxBatchEvents, cloudWatchBatchLen(events))
+	msg := strings.Repeat("a", cloudWatchMaxMessageBytes)
+	events = []cloudWatchEvent{{0, msg}, {0, msg}, {0, msg}, {0, msg}, {0, msg}}
+	assert.Equal(t, 4, cloudWatchBatchLen(events), "should stay within 1MB")
+	assert.Equal(t, 2, cloudWatchBatchLen(events[:2]))
+}
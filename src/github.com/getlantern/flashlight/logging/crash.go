@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	crashMarkerFile = "lantern.crashed"
+
+	// crashFlushTimeout bounds how long RecoverAndLog waits for the log file
+	// to be flushed before re-panicking
+	crashFlushTimeout = 2 * time.Second
+)
+
+// RecoverAndLog logs any panic in the calling goroutine along with its stack
+// trace, leaves a crash marker in the logs directory for PreviousRunCrashed to
+// find on the next launch, flushes the log file so that the stack trace is on
+// disk and then re-panics. Use it as:
+//
+//	defer logging.RecoverAndLog()
+func RecoverAndLog() {
+	if r := recover(); r != nil {
+		log.Errorf("Panic: %v\n%s", r, debug.Stack())
+		writeCrashMarker(r)
+		flushWithin(crashFlushTimeout)
+		panic(r)
+	}
+}
+
+// flushWithin writes out the queued lines and flushes the log file, giving up
+// after timeout so that a hung file doesn't keep a crash from propagating.
+func flushWithin(timeout time.Duration) {
+	done := make(chan error, 1)
+	go func() {
+		drainQueues()
+		done <- Flush()
+	}()
+	select {
+	case err := <-done:
+		if err != nil && err != ErrNotInitialized {
+			log.Debugf("Unable to flush log file: %v", err)
+		}
+	case <-time.After(timeout):
+		log.Debugf("Timed out flushing log file")
+	}
+}
+
+func writeCrashMarker(r interface{}) {
+	dir := currentLogDir()
+	if dir == "" {
+		return
+	}
+	content := fmt.Sprintf("%v: %v\n", time.Now().In(time.UTC).Format(time.RFC3339), r)
+	if err := ioutil.WriteFile(filepath.Join(dir, crashMarkerFile), []byte(content), 0644); err != nil {
+		log.Errorf("Unable to write crash marker: %v", err)
+	}
+}
+
+// PreviousRunCrashed tells whether the previous run left a crash marker
+// behind, clearing the marker so that it's only reported once. Call it at
+// startup after Init.
+func PreviousRunCrashed() bool {
+	dir := currentLogDir()
+	if dir == "" {
+		return false
+	}
+	err := os.Remove(filepath.Join(dir, crashMarkerFile))
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Unable to remove crash marker: %v", err)
+		return true
+	}
+	return err == nil
+}
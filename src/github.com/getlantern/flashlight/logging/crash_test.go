@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverAndLog(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir := logDir
+	defer func() {
+		logDir = oldLogDir
+	}()
+	logDir = dir
+
+	assert.False(t, PreviousRunCrashed(), "no marker should mean no crash")
+
+	func() {
+		defer func() {
+			assert.Equal(t, "boom", recover(), "RecoverAndLog should re-panic")
+		}()
+		defer RecoverAndLog()
+		panic("boom")
+	}()
+
+	assert.True(t, PreviousRunCrashed(), "should find crash marker")
+	assert.False(t, PreviousRunCrashed(), "crash marker should be cleared")
+}
+
+func TestRecoverAndLogFlushes(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogFile := logFile
+	defer func() {
+		logFile = oldLogFile
+	}()
+	path := filepath.Join(dir, "lantern.log")
+	logFile = newSizeRotator(path)
+	logFile.BufferSize = 64 * 1024
+	defer logFile.Close()
+	golog.SetOutputs(&lockedWriter{w: logFile}, ioutil.Discard)
+	defer golog.ResetOutputs()
+
+	func() {
+		defer func() {
+			assert.Equal(t, "boom", recover(), "RecoverAndLog should re-panic")
+			b, err := ioutil.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Contains(t, string(b), "Panic: boom", "panic should be on disk before re-panicking")
+			assert.Contains(t, string(b), "TestRecoverAndLogFlushes", "stack trace should be on disk")
+		}()
+		defer RecoverAndLog()
+		panic("boom")
+	}()
+}
+
+func TestRecoverAndLogOrderedOutput(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir, Level: "ERROR", OrderedOutput: true, FileBytesPerSecond: 10})) {
+		return
+	}
+	defer Close()
+	// Use up the throttle's budget so that the panic has to wait
+	log.Error("before")
+
+	func() {
+		defer func() {
+			assert.Equal(t, "boom", recover(), "RecoverAndLog should re-panic")
+			b, err := ioutil.ReadFile(filepath.Join(dir, logFileName))
+			assert.NoError(t, err)
+			assert.Contains(t, string(b), "Panic: boom", "queued panic should be on disk before re-panicking")
+		}()
+		defer RecoverAndLog()
+		panic("boom")
+	}()
+}
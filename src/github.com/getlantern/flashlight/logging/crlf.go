@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+)
+
+// crlfWriter translates the LF line endings of lines written to it to CRLF
+// before passing them on, leaving existing CRLFs alone.
+type crlfWriter struct {
+	io.Writer
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := w.Writer.Write(toCRLF(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// toCRLF replaces each LF in p not preceded by a CR with CRLF, returning p
+// itself if there are none.
+func toCRLF(p []byte) []byte {
+	n := 0
+	for i, c := range p {
+		if c == '\n' && (i == 0 || p[i-1] != '\r') {
+			n++
+		}
+	}
+	if n == 0 {
+		return p
+	}
+	out := make([]byte, 0, len(p)+n)
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			return append(out, p...)
+		}
+		if i > 0 && p[i-1] == '\r' {
+			out = append(out, p[:i+1]...)
+		} else {
+			out = append(append(out, p[:i]...), '\r', '\n')
+		}
+		p = p[i+1:]
+	}
+}
@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRLFWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := textFormatted(&crlfWriter{&buf}, false)
+	n, err := w.Write([]byte("ERROR test: a.go:1 failed\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 26, n, "should report the length written to it")
+	w.Write([]byte("DEBUG test: a.go:2 already\r\n"))
+	w.Write([]byte("ERROR test: a.go:3 multi\nline\n"))
+	assert.Equal(t, "ERROR test: a.go:1 failed\r\nDEBUG test: a.go:2 already\r\nERROR test: a.go:3 multi\r\nline\r\n", buf.String())
+
+	p := []byte("no line ending")
+	assert.Equal(t, &p[0], &toCRLF(p)[0], "shouldn't copy without LFs")
+}
@@ -0,0 +1,177 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const datedFormat = "2006-01-02"
+
+// RotationPolicy determines how the log file is rotated.
+type RotationPolicy int
+
+const (
+	// RotateBySize rotates lantern.log to lantern.log.1 and so on when it
+	// gets too large.
+	RotateBySize RotationPolicy = iota
+
+	// RotateByDateAndSize writes to a file per UTC day, like
+	// lantern-2006-01-02.log, moving on to lantern-2006-01-02.1.log and so on
+	// within the day when it gets too large. Options.MaxAge and the number of
+	// kept files apply to all dated files but the current one.
+	RotateByDateAndSize
+)
+
+// datedFile is one of the files written with Dated set.
+type datedFile struct {
+	path string
+	date string
+	part int
+}
+
+// datedPath returns the path of the given part of the file for the given
+// date, e.g. lantern-2006-01-02.1.log for path lantern.log and part 1.
+func (r *sizeRotator) datedPath(date string, part int) string {
+	dir, file := filepath.Split(r.path)
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(file, ext) + "-" + date
+	if part > 0 {
+		name += "." + strconv.Itoa(part)
+	}
+	return filepath.Join(dir, name+ext)
+}
+
+// datedFiles returns the existing dated files, compressed or not, oldest
+// first.
+func (r *sizeRotator) datedFiles() []datedFile {
+	dir, file := filepath.Split(r.path)
+	ext := filepath.Ext(file)
+	prefix := strings.TrimSuffix(file, ext) + "-"
+	matches, _ := filepath.Glob(filepath.Join(dir, prefix+"*"))
+	var files []datedFile
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), compressedExt)
+		if !strings.HasSuffix(name, ext) {
+			continue
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		date, part := name, 0
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			var err error
+			date = name[:i]
+			if part, err = strconv.Atoi(name[i+1:]); err != nil || part <= 0 {
+				continue
+			}
+		}
+		if _, err := time.Parse(datedFormat, date); err != nil {
+			continue
+		}
+		files = append(files, datedFile{path, date, part})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].date != files[j].date {
+			return files[i].date < files[j].date
+		}
+		return files[i].part < files[j].part
+	})
+	return files
+}
+
+// checkDate moves on to the file for the current day if needed. It must be
+// called with the mutex held.
+func (r *sizeRotator) checkDate() {
+	today := r.now().In(time.UTC).Format(datedFormat)
+	if r.date == today {
+		return
+	}
+	if r.date == "" {
+		r.date, r.part = today, r.lastPart(today)
+		return
+	}
+	completed := r.activePath()
+	r.closeFile()
+	r.date, r.part = today, r.lastPart(today)
+	r.totalSize = 0
+	r.openedAt = r.now()
+	r.completeDated(completed)
+}
+
+// lastPart returns the part of the file for date to continue writing to.
+func (r *sizeRotator) lastPart(date string) int {
+	part := 0
+	for _, f := range r.datedFiles() {
+		if f.date != date {
+			continue
+		}
+		part = f.part
+		if strings.HasSuffix(f.path, compressedExt) && !r.LiveCompress {
+			// Already complete
+			part++
+		}
+	}
+	return part
+}
+
+// rotateDated moves on to the next part of the current day's file. It must
+// be called with the mutex held.
+func (r *sizeRotator) rotateDated() error {
+	if r.date == "" {
+		r.checkDate()
+	}
+	completed := r.activePath()
+	r.closeFile()
+	r.part++
+	r.totalSize = 0
+	now := r.now()
+	r.adaptRotationSize(now)
+	r.openedAt = now
+	r.completeDated(completed)
+	return nil
+}
+
+// completeDated applies retention, then compresses the completed file if
+// needed and notifies OnRotate, see complete. It must be called with the
+// mutex held, which is released meanwhile if a file is still being
+// compressed.
+func (r *sizeRotator) completeDated(completed string) {
+	r.awaitCompression()
+	r.pruneDated(time.Now())
+	if _, err := os.Stat(completed); err != nil {
+		// Nothing was written to it
+		return
+	}
+	r.complete(completed, r.Compress && !r.LiveCompress)
+}
+
+// pruneDated deletes the oldest dated files beyond MaxRotation, and those
+// older than MaxAge, never deleting the current one. It must be called with
+// the mutex held, failures being reported once it's released.
+func (r *sizeRotator) pruneDated(now time.Time) {
+	active := r.activePath()
+	var completed []datedFile
+	for _, f := range r.datedFiles() {
+		if f.path != active {
+			completed = append(completed, f)
+		}
+	}
+	for i, f := range completed {
+		expired := false
+		if r.MaxAge > 0 {
+			if stat, err := os.Stat(f.path); err == nil && now.Sub(stat.ModTime()) > r.MaxAge {
+				expired = true
+			}
+		}
+		if !expired && i >= len(completed)-r.MaxRotation {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			r.errs = append(r.errs, fmt.Errorf("Unable to delete old log file %v: %v", f.path, err))
+		}
+		os.Remove(f.path + checksumExt)
+	}
+}
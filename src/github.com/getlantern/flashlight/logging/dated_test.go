@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatedRotation(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2015, 6, 1, 23, 0, 0, 0, time.UTC)
+	r := newSizeRotator(filepath.Join(dir, "lantern.log"))
+	r.Dated = true
+	r.RotationSize = 10
+	r.MaxRotation = 3
+	r.now = func() time.Time {
+		return now
+	}
+	var rotated []string
+	r.OnRotate = func(closedPath string) {
+		rotated = append(rotated, filepath.Base(closedPath))
+	}
+	defer r.Close()
+
+	assert.Equal(t, filepath.Join(dir, "lantern-2015-06-01.log"), r.currentPath())
+	for _, s := range []string{"0000000000", "1111111111", "2222222222"} {
+		r.Write([]byte(s))
+	}
+	now = now.Add(2 * time.Hour)
+	r.Write([]byte("3333333333"))
+
+	for name, expected := range map[string]string{
+		"lantern-2015-06-01.log":   "0000000000",
+		"lantern-2015-06-01.1.log": "1111111111",
+		"lantern-2015-06-01.2.log": "2222222222",
+		"lantern-2015-06-02.log":   "3333333333",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(b), name)
+	}
+	assert.Equal(t, []string{"lantern-2015-06-01.log", "lantern-2015-06-01.1.log", "lantern-2015-06-01.2.log"}, rotated)
+
+	r.Write([]byte("4444444444"))
+	_, err := os.Stat(filepath.Join(dir, "lantern-2015-06-01.log"))
+	assert.True(t, os.IsNotExist(err), "should keep at most MaxRotation files besides the current one")
+	assert.Len(t, r.datedFiles(), 4)
+	assert.Equal(t, filepath.Join(dir, "lantern-2015-06-02.1.log"), r.currentPath())
+
+	// Reopening continues with the last part of the day
+	assert.NoError(t, r.Close())
+	r2 := newSizeRotator(filepath.Join(dir, "lantern.log"))
+	r2.Dated = true
+	r2.now = r.now
+	defer r2.Close()
+	assert.Equal(t, filepath.Join(dir, "lantern-2015-06-02.1.log"), r2.currentPath())
+}
+
+func TestDatedRotationCompressedAndMaxAge(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := newSizeRotator(filepath.Join(dir, "lantern.log"))
+	r.Dated = true
+	r.Compress = true
+	r.RotationSize = 10
+	r.now = func() time.Time {
+		return now
+	}
+	defer r.Close()
+	r.Write([]byte("0000000000"))
+	r.Write([]byte("1111111111"))
+	awaitCompression(r)
+	assert.Equal(t, "0000000000", readGzip(t, filepath.Join(dir, "lantern-2015-06-01.log.gz")))
+
+	r.MaxAge = time.Hour
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "lantern-2015-06-01.log.gz"), old, old))
+	r.Sweep()
+	_, err := os.Stat(filepath.Join(dir, "lantern-2015-06-01.log.gz"))
+	assert.True(t, os.IsNotExist(err), "should delete expired files")
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "lantern-2015-06-01.1.log"), old, old))
+	r.Sweep()
+	_, err = os.Stat(filepath.Join(dir, "lantern-2015-06-01.1.log"))
+	assert.NoError(t, err, "should never delete the current file")
+}
+
+func TestDatedRotationFailedDelete(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	var errOut syncBuffer
+	rotationErrorOut = &errOut
+	defer func() {
+		rotationErrorOut = os.Stderr
+	}()
+
+	// A non-empty directory can't be deleted like a file
+	expired := filepath.Join(dir, "lantern-2015-05-01.log")
+	assert.NoError(t, os.Mkdir(expired, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(expired, "x"), []byte("x"), 0644))
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := newSizeRotator(filepath.Join(dir, "lantern.log"))
+	r.Dated = true
+	r.MaxRotation = 1
+	r.RotationSize = 10
+	r.now = func() time.Time {
+		return now
+	}
+	defer r.Close()
+
+	errorsBefore := Stats().RotationErrors
+	for _, s := range []string{"0000000000", "1111111111", "2222222222"} {
+		_, err := r.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	assert.Contains(t, errOut.String(), "ERROR flashlight.logging: Unable to delete old log file "+expired)
+	assert.True(t, Stats().RotationErrors > errorsBefore)
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// dedupedLines is the number of lines dropped from the log file as
+	// duplicates
+	dedupedLines uint64
+)
+
+// maxDuplicateKeys bounds the number of messages remembered for suppressing
+// duplicates, beyond which expired ones are forgotten.
+const maxDuplicateKeys = 1000
+
+// DuplicateScope determines which part of a message is compared when
+// suppressing duplicates sent to Loggly.
+type DuplicateScope int
+
+const (
+	// DuplicateStackLines compares all but the first line of messages, so
+	// that the same stack trace is suppressed even if the error leading it
+	// varies. Single line messages are never suppressed.
+	DuplicateStackLines DuplicateScope = iota
+
+	// DuplicateFullMessage compares whole messages.
+	DuplicateFullMessage
+)
+
+type duplicate struct {
+	until      time.Time
+	suppressed int
+}
+
+// duplicateSuppressor remembers the hashes of recent messages so that only
+// the first of identical ones is sent within each window.
+type duplicateSuppressor struct {
+	window time.Duration
+	scope  DuplicateScope
+	seen   map[uint64]*duplicate
+	mutex  sync.Mutex
+}
+
+func newDuplicateSuppressor(window time.Duration, scope DuplicateScope) *duplicateSuppressor {
+	return &duplicateSuppressor{
+		window: window,
+		scope:  scope,
+		seen:   make(map[uint64]*duplicate),
+	}
+}
+
+// check determines whether to send message. If it's sent after duplicates
+// were suppressed in the previous window, suppressed is how many.
+func (s *duplicateSuppressor) check(message string, now time.Time) (send bool, suppressed int) {
+	compared := strings.TrimRight(message, "\n")
+	if s.scope == DuplicateStackLines {
+		i := strings.IndexByte(compared, '\n')
+		if i < 0 {
+			return true, 0
+		}
+		compared = compared[i+1:]
+	}
+	h := fnv.New64a()
+	h.Write([]byte(compared))
+	key := h.Sum64()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	d := s.seen[key]
+	if d != nil && now.Before(d.until) {
+		d.suppressed++
+		return false, 0
+	}
+	if d != nil {
+		suppressed = d.suppressed
+	} else if len(s.seen) >= maxDuplicateKeys {
+		for k, existing := range s.seen {
+			if !now.Before(existing.until) {
+				delete(s.seen, k)
+			}
+		}
+	}
+	s.seen[key] = &duplicate{until: now.Add(s.window)}
+	return true, suppressed
+}
+
+type duplicateWriter struct {
+	io.Writer
+	duplicates *duplicateSuppressor
+}
+
+// dedupe creates a writer that only writes the first of identical lines
+// within each window, adding " (repeated N times)" to the next one written
+// after duplicates were dropped. It keeps its state on its own, so that
+// rotating the underlying file doesn't restart the count.
+func dedupe(w io.Writer, window time.Duration) io.Writer {
+	if window <= 0 {
+		return w
+	}
+	return &duplicateWriter{w, newDuplicateSuppressor(window, DuplicateFullMessage)}
+}
+
+func (w *duplicateWriter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *duplicateWriter) writeAt(p []byte, t time.Time) (int, error) {
+	write, suppressed := w.duplicates.check(string(p), time.Now())
+	if !write {
+		atomic.AddUint64(&dedupedLines, 1)
+		return len(p), nil
+	}
+	if suppressed == 0 {
+		return writeTimed(w.Writer, p, t)
+	}
+	line := strings.TrimRight(string(p), "\n")
+	if _, err := writeTimed(w.Writer, []byte(line+" (repeated "+strconv.Itoa(suppressed)+" times)\n"), t); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
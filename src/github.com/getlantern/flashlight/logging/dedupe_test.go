@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicateSuppressor(t *testing.T) {
+	trace := "goroutine 1 [running]:\nmain.main()\n\t/src/main.go:10 +0x20\n"
+	now := time.Now()
+	s := newDuplicateSuppressor(time.Minute, DuplicateStackLines)
+
+	send, _ := s.check("ERROR flashlight: a.go:1 Panic: first\n"+trace, now)
+	assert.True(t, send, "should send the first occurrence")
+	send, _ = s.check("ERROR flashlight: a.go:1 Panic: second\n"+trace, now.Add(time.Second))
+	assert.False(t, send, "should suppress the same stack with a different first line")
+	send, _ = s.check("ERROR flashlight: a.go:1 Panic: third\n"+trace, now.Add(2*time.Second))
+	assert.False(t, send)
+	send, _ = s.check("ERROR flashlight: a.go:1 single line\n", now.Add(3*time.Second))
+	assert.True(t, send, "should never suppress single lines by stack")
+	send, _ = s.check("ERROR flashlight: a.go:1 single line\n", now.Add(4*time.Second))
+	assert.True(t, send)
+
+	send, suppressed := s.check("ERROR flashlight: a.go:1 Panic: fourth\n"+trace, now.Add(2*time.Minute))
+	assert.True(t, send, "should send again after the window")
+	assert.Equal(t, 2, suppressed, "should count suppressed duplicates")
+
+	full := newDuplicateSuppressor(time.Minute, DuplicateFullMessage)
+	send, _ = full.check("ERROR flashlight: a.go:1 single line\n", now)
+	assert.True(t, send)
+	send, _ = full.check("ERROR flashlight: a.go:1 single line\n", now)
+	assert.False(t, send, "should compare whole messages")
+	send, _ = full.check("ERROR flashlight: a.go:1 Panic: other\n"+trace, now)
+	assert.True(t, send)
+}
+
+func TestLogglySuppressesDuplicates(t *testing.T) {
+	trace := "goroutine 1 [running]:\nmain.main()\n\t/src/main.go:10 +0x20\n"
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender, duplicates: newDuplicateSuppressor(time.Hour, DuplicateStackLines)}
+	for i := 0; i < 5; i++ {
+		line := "ERROR flashlight: dedupe_test.go:1 Panic: crashed\n" + trace
+		n, err := lw.Write([]byte(line))
+		assert.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	assert.Len(t, sender.sent(), 1, "should only send the first of identical stacks")
+
+	for _, d := range lw.duplicates.seen {
+		d.until = time.Now()
+	}
+	lw.Write([]byte("ERROR flashlight: dedupe_test.go:1 Panic: crashed\n" + trace))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, "4", msgs[1]["extra"].(map[string]string)["suppressedDuplicates"])
+	}
+}
+
+func TestFileDuplicatesAcrossRotation(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+	r := newSizeRotator(path)
+	defer r.Close()
+	w := dedupe(r, time.Hour).(*duplicateWriter)
+	dedupedBefore := Stats().DedupedLines
+
+	line := []byte("ERROR flashlight: a.go:1 unable to dial\n")
+	for i := 0; i < 4; i++ {
+		w.Write(line)
+	}
+	assert.NoError(t, r.Rotate())
+	for i := 0; i < 2; i++ {
+		w.Write(line)
+	}
+	b, _ := ioutil.ReadFile(path + ".1")
+	assert.Equal(t, string(line), string(b), "should only write the first line")
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "", string(b), "should keep dropping duplicates after rotating")
+	assert.EqualValues(t, 5, Stats().DedupedLines-dedupedBefore)
+
+	// Expire the window
+	for _, d := range w.duplicates.seen {
+		d.until = time.Now()
+	}
+	w.Write(line)
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "ERROR flashlight: a.go:1 unable to dial (repeated 5 times)\n", string(b),
+		"should count duplicates from before and after the rotation")
+}
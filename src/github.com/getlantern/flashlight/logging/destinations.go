@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Destinations that can be toggled with SetDestinationEnabled.
+const (
+	destStderr   = "stderr"
+	destStdout   = "stdout"
+	destFile     = "file"
+	destJournald = "journald"
+	destSocket   = "socket"
+)
+
+var (
+	knownDestinations = []string{
+		destStderr, destStdout, destFile, destJournald, destSocket,
+		logglyRemote, otlpRemote, webhookRemote, cloudWatchRemote,
+	}
+
+	// disabledDestinations are the destinations turned off with
+	// SetDestinationEnabled
+	disabledDestinations      = make(map[string]bool)
+	disabledDestinationsMutex sync.RWMutex
+)
+
+// SetDestinationEnabled turns the given output on or off at runtime without
+// reinitializing, e.g. to silence stderr while still logging to the file.
+// Destinations are stderr (errors printed to the console, stdout with
+// Options.AllToStdout), stdout, file, journald, socket, loggly, otlp, webhook
+// and cloudwatch. All are enabled by default, and stay as set across Init.
+func SetDestinationEnabled(dest string, enabled bool) error {
+	if !isKnownDestination(dest) {
+		return fmt.Errorf("Unknown log destination %v", dest)
+	}
+	disabledDestinationsMutex.Lock()
+	defer disabledDestinationsMutex.Unlock()
+	if enabled {
+		delete(disabledDestinations, dest)
+	} else {
+		disabledDestinations[dest] = true
+	}
+	return nil
+}
+
+// Destinations returns whether each destination is enabled, see
+// SetDestinationEnabled.
+func Destinations() map[string]bool {
+	disabledDestinationsMutex.RLock()
+	defer disabledDestinationsMutex.RUnlock()
+	result := make(map[string]bool, len(knownDestinations))
+	for _, dest := range knownDestinations {
+		result[dest] = !disabledDestinations[dest]
+	}
+	return result
+}
+
+func isKnownDestination(dest string) bool {
+	for _, known := range knownDestinations {
+		if dest == known {
+			return true
+		}
+	}
+	return false
+}
+
+func destinationEnabled(dest string) bool {
+	disabledDestinationsMutex.RLock()
+	defer disabledDestinationsMutex.RUnlock()
+	return !disabledDestinations[dest]
+}
+
+// gatedWriter drops everything written to it while its destination is
+// disabled.
+type gatedWriter struct {
+	io.Writer
+	dest string
+}
+
+// gated creates a writer passing on to w only while dest is enabled.
+func gated(dest string, w io.Writer) io.Writer {
+	return &gatedWriter{w, dest}
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *gatedWriter) writeAt(p []byte, t time.Time) (int, error) {
+	if !destinationEnabled(w.dest) {
+		return len(p), nil
+	}
+	return writeTimed(w.Writer, p, t)
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDestinationEnabled(t *testing.T) {
+	defer SetDestinationEnabled(destStderr, true)
+
+	assert.Error(t, SetDestinationEnabled("syslog", false), "should reject unknown destinations")
+	assert.True(t, Destinations()[destStderr])
+
+	var buf bytes.Buffer
+	w := gated(destStderr, &buf)
+	fmt.Fprintln(w, "before")
+	assert.NoError(t, SetDestinationEnabled(destStderr, false))
+	assert.False(t, Destinations()[destStderr])
+	assert.True(t, Destinations()[destFile], "should only disable the given destination")
+	n, err := fmt.Fprintln(w, "while disabled")
+	assert.NoError(t, err)
+	assert.Equal(t, len("while disabled\n"), n)
+	assert.NoError(t, SetDestinationEnabled(destStderr, true))
+	fmt.Fprintln(w, "after")
+	assert.Equal(t, "before\nafter\n", buf.String())
+}
+
+func TestRemoteDestinations(t *testing.T) {
+	defer SetDestinationEnabled(logglyRemote, true)
+	defer removeLoggly()
+	defer resetGologOutputs()
+
+	sender := newFakeSender()
+	addLoggly(&logglyErrorWriter{client: sender})
+	errOut := currentOutputs.Load().(outputs).errorOut
+	assert.NoError(t, SetDestinationEnabled(logglyRemote, false))
+	fmt.Fprintln(errOut, "ERROR flashlight: a.go:1 not sent")
+	assert.Empty(t, sender.sent(), "should be able to disable remotes")
+	assert.NoError(t, SetDestinationEnabled(logglyRemote, true))
+	fmt.Fprintln(errOut, "ERROR flashlight: a.go:2 sent")
+	assert.Len(t, sender.sent(), 1)
+}
@@ -0,0 +1,17 @@
+// +build !windows
+
+package logging
+
+import (
+	"syscall"
+)
+
+// diskFree returns the number of bytes available to unprivileged users on
+// the filesystem containing dir.
+func diskFree(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/flashlight/geolookup"
+)
+
+const osReleaseFile = "/etc/os-release"
+
+var (
+	// buildDateValue is the build date last passed to Configure
+	buildDateValue atomic.Value
+
+	// environmentLogged is set once the environment was logged since Init
+	environmentLogged int32
+)
+
+func init() {
+	buildDateValue.Store("")
+}
+
+// LogEnvironment logs an INFO line with facts about the environment useful
+// for support: the OS, architecture, OS version, language, time zone,
+// country, free space in the logs directory, whether running as a service,
+// and the version and build date. Facts that can't be determined are left
+// out. It's called once by Configure after each Init.
+func LogEnvironment() {
+	logInfo("environment" + formatFields(environmentFacts()))
+}
+
+// logEnvironmentOnce calls LogEnvironment if it wasn't since Init.
+func logEnvironmentOnce() {
+	if atomic.CompareAndSwapInt32(&environmentLogged, 0, 1) {
+		LogEnvironment()
+	}
+}
+
+func environmentFacts() map[string]string {
+	facts := map[string]string{
+		"os":        runtime.GOOS,
+		"arch":      runtime.GOARCH,
+		"osVersion": osVersion(osReleaseFile),
+		"language":  detectLanguage(currentOptions().LanguageProvider),
+		"timeZone":  time.Now().Format("MST"),
+		"country":   geolookup.GetCountry(),
+		"service":   strconv.FormatBool(runningAsService()),
+		"version":   appVersion.Load().(string),
+		"buildDate": buildDateValue.Load().(string),
+	}
+	if dir := currentLogDir(); dir != "" {
+		if free, err := diskFree(dir); err == nil {
+			facts["diskFree"] = strconv.FormatUint(free, 10)
+		}
+	}
+	for key, value := range facts {
+		if value == "" {
+			delete(facts, key)
+		}
+	}
+	return facts
+}
+
+// osVersion returns the PRETTY_NAME from the given os-release file, like
+// "Ubuntu 14.04.2 LTS", or "" if it can't be read, as on other platforms
+// than Linux.
+func osVersion(osRelease string) string {
+	f, err := os.Open(osRelease)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "PRETTY_NAME=") {
+			value := strings.TrimPrefix(line, "PRETTY_NAME=")
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+			return strings.Trim(value, `'"`)
+		}
+	}
+	return ""
+}
+
+// runningAsService guesses whether the process runs as a service, i.e. was
+// started by init, systemd or launchd rather than from a session.
+func runningAsService() bool {
+	return os.Getppid() == 1 || os.Getenv("INVOCATION_ID") != ""
+}
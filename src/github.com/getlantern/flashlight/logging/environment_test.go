@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOSVersion(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "os-release")
+	assert.Equal(t, "", osVersion(path), "should be empty without the file")
+
+	ioutil.WriteFile(path, []byte("NAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 14.04.2 LTS\"\n"), 0644)
+	assert.Equal(t, "Ubuntu 14.04.2 LTS", osVersion(path))
+	ioutil.WriteFile(path, []byte("PRETTY_NAME=Alpine\n"), 0644)
+	assert.Equal(t, "Alpine", osVersion(path))
+}
+
+func TestLogEnvironment(t *testing.T) {
+	origLogDir := logDir
+	var buf bytes.Buffer
+	setGologOutputs(os.Stderr, &buf)
+	defer resetGologOutputs()
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	logDir = dir
+	appVersion.Store("2.0.0")
+	defer func() {
+		logDir = origLogDir
+		appVersion.Store("")
+	}()
+
+	facts := environmentFacts()
+	assert.Equal(t, runtime.GOOS, facts["os"])
+	assert.Equal(t, runtime.GOARCH, facts["arch"])
+	assert.Equal(t, "2.0.0", facts["version"])
+	assert.NotEmpty(t, facts["diskFree"])
+	_, found := facts["buildDate"]
+	assert.False(t, found, "should leave out unknown facts")
+
+	LogEnvironment()
+	assert.Regexp(t, `^INFO flashlight.logging: environment \{.*version=2.0.0\}\n$`, buf.String())
+}
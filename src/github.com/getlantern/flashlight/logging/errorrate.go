@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorRateSamples is how many times per window the error count is sampled
+// for OnErrorRate.
+const errorRateSamples = 10
+
+// OnErrorRate calls cb with the current rate, in error lines per second over
+// the sliding window, when it rises above threshold, for example to show a
+// banner or check connectivity when errors spike. To avoid flapping, cb isn't
+// called again until the rate has fallen back to the threshold, and at most
+// once per window. The rate is sampled from the error line count on its own
+// goroutine, which also runs cb, so logging is never held up. Calling the
+// returned remove function stops it. It returns an error if the threshold is
+// negative or the window is shorter than errorRateSamples nanoseconds.
+func OnErrorRate(threshold float64, window time.Duration, cb func(rate float64)) (remove func(), err error) {
+	if threshold < 0 || math.IsNaN(threshold) {
+		return nil, fmt.Errorf("Invalid error rate threshold %v", threshold)
+	}
+	if window < errorRateSamples {
+		return nil, fmt.Errorf("Invalid error rate window %v", window)
+	}
+	stop := make(chan struct{})
+	go trackErrorRate(threshold, window, cb, stop)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+		})
+	}, nil
+}
+
+func trackErrorRate(threshold float64, window time.Duration, cb func(rate float64), stop chan struct{}) {
+	ticker := time.NewTicker(window / errorRateSamples)
+	defer ticker.Stop()
+
+	// samples holds the error counts over the last window, oldest first
+	samples := []uint64{atomic.LoadUint64(&errorLines)}
+	armed := true
+	var lastCalled time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			samples = append(samples, atomic.LoadUint64(&errorLines))
+			if len(samples) > errorRateSamples+1 {
+				samples = samples[1:]
+			}
+			rate := float64(samples[len(samples)-1]-samples[0]) / window.Seconds()
+			if rate <= threshold {
+				armed = true
+			} else if armed && now.Sub(lastCalled) >= window {
+				armed = false
+				lastCalled = now
+				cb(rate)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnErrorRate(t *testing.T) {
+	rates := make(chan float64, 10)
+	remove, err := OnErrorRate(50, 200*time.Millisecond, func(rate float64) {
+		rates <- rate
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer remove()
+
+	expectRate := func(msg string) {
+		select {
+		case rate := <-rates:
+			assert.True(t, rate > 50, "rate should be above the threshold, was %v", rate)
+		case <-time.After(5 * time.Second):
+			t.Fatal(msg)
+		}
+	}
+	expectNone := func(msg string) {
+		select {
+		case rate := <-rates:
+			t.Fatalf("%v, got rate %v", msg, rate)
+		case <-time.After(300 * time.Millisecond):
+		}
+	}
+
+	atomic.AddUint64(&errorLines, 5)
+	expectNone("shouldn't call back below the threshold")
+
+	atomic.AddUint64(&errorLines, 100)
+	expectRate("should call back when errors spike")
+	atomic.AddUint64(&errorLines, 100)
+	expectNone("shouldn't call back again before the rate falls back")
+
+	time.Sleep(300 * time.Millisecond)
+	atomic.AddUint64(&errorLines, 100)
+	expectRate("should call back again after the rate fell back")
+
+	remove()
+	remove()
+	time.Sleep(300 * time.Millisecond)
+	atomic.AddUint64(&errorLines, 100)
+	expectNone("shouldn't call back after removal")
+}
+
+func TestOnErrorRateInvalid(t *testing.T) {
+	cb := func(rate float64) {}
+	for _, window := range []time.Duration{0, -time.Second, 5 * time.Nanosecond} {
+		_, err := OnErrorRate(50, window, cb)
+		assert.Error(t, err, "window %v", window)
+	}
+	for _, threshold := range []float64{-1, math.NaN()} {
+		_, err := OnErrorRate(threshold, time.Second, cb)
+		assert.Error(t, err, "threshold %v", threshold)
+	}
+	remove, err := OnErrorRate(0, errorRateSamples, cb)
+	if assert.NoError(t, err, "shortest window") {
+		remove()
+	}
+}
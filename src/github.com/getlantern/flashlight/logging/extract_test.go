@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzExtractMessage(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		":",
+		"::",
+		"a:",
+		":a",
+		"ERROR flashlight.test: extract_test.go:1 could not connect: connection refused\n",
+		"ERROR flashlight: dial http://10.0.0.1:80/x: refused",
+		"x:\n",
+		"\xff:\xfe:",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		prefix, message := extractMessage(source)
+		if !strings.HasPrefix(source, prefix) {
+			t.Errorf("Prefix %q not at the start of %q", prefix, source)
+		}
+		if !strings.Contains(source, message) {
+			t.Errorf("Message %q not in %q", message, source)
+		}
+	})
+}
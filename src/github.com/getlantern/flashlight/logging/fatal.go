@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	defaultFatalExitCode = 1
+
+	// fatalFlushTimeout bounds how long Fatalf waits for the log file and
+	// Loggly to be flushed before exiting
+	fatalFlushTimeout = 5 * time.Second
+)
+
+// exit exits the process, replaceable for testing
+var exit = os.Exit
+
+// Fatalf logs an unrecoverable error at the FATAL level, which no level
+// setting filters out, so that it reaches the log file and Loggly. It then
+// writes out the lines queued for ordered output or by the file throttle,
+// flushes the log file and sends the pending Loggly messages, giving up after
+// a few seconds, and exits with Options.FatalExitCode.
+func Fatalf(format string, args ...interface{}) {
+	packageLogger.output(2, true, levelFatal, fmt.Sprintf(format, args...))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		drainQueues()
+		if err := Flush(); err != nil && err != ErrNotInitialized {
+			log.Debugf("Unable to flush log file: %v", err)
+		}
+		if b := logglyBatch.Load().(*batchingSender); b != nil {
+			if err := b.Flush(); err != nil {
+				log.Debugf("Unable to send fatal error to Loggly: %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(fatalFlushTimeout):
+		log.Debugf("Timed out flushing logs before exiting")
+	}
+	code := currentOptions().FatalExitCode
+	if code == 0 {
+		code = defaultFatalExitCode
+	}
+	exit(code)
+}
+
+// drainQueues writes out the lines queued for ordered output and those held
+// back by the file throttle, so that flushing afterwards includes them.
+func drainQueues() {
+	if o := currentOrdered(); o != nil {
+		o.drain()
+	}
+	if t := currentFileThrottle(); t != nil {
+		t.flush()
+	}
+}
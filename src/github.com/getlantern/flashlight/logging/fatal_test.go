@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFatalf(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir, oldLogFile := logDir, logFile
+	exitCode := -1
+	exit = func(code int) {
+		exitCode = code
+	}
+	defer func() {
+		exit = os.Exit
+		removeLoggly()
+		setLogglyBatch(nil)
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir, Level: "ERROR", FileBufferSize: 4096, FatalExitCode: 3})) {
+		return
+	}
+	defer Close()
+	sender := newFakeSender()
+	batch := newBatchingSender(sender, logglyBatchSize, defaultLogglyMaxInFlight, time.Hour)
+	addLoggly(&logglyErrorWriter{client: batch})
+	setLogglyBatch(batch)
+
+	Fatalf("unable to %v", "continue")
+	assert.Equal(t, 3, exitCode)
+	b, err := ioutil.ReadFile(filepath.Join(dir, logFileName))
+	assert.NoError(t, err)
+	assert.Regexp(t, `FATAL flashlight.logging: fatal_test.go:\d+ unable to continue`, string(b), "should have flushed the file")
+	sent := sender.sent()
+	if assert.Len(t, sent, 1, "should have flushed to Loggly") {
+		assert.Contains(t, sent[0]["fullMessage"], "unable to continue")
+	}
+
+	options = &Options{}
+	Fatalf("again")
+	assert.Equal(t, 1, exitCode, "should default to exit code 1")
+}
+
+func TestFatalfOrderedOutput(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir, oldLogFile := logDir, logFile
+	exit = func(code int) {}
+	defer func() {
+		exit = os.Exit
+		removeLoggly()
+		setLogglyBatch(nil)
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+
+	// The throttle only allows a few bytes a second, so the FATAL line has to
+	// wait behind the others unless Fatalf drains the queues
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir, Level: "ERROR", OrderedOutput: true, FileBytesPerSecond: 10})) {
+		return
+	}
+	defer Close()
+	sender := newFakeSender()
+	batch := newBatchingSender(sender, logglyBatchSize, defaultLogglyMaxInFlight, time.Hour)
+	addLoggly(&logglyErrorWriter{client: batch})
+	setLogglyBatch(batch)
+
+	for i := 0; i < 5; i++ {
+		log.Errorf("before %d", i)
+	}
+	Fatalf("unable to %v", "continue")
+	b, err := ioutil.ReadFile(filepath.Join(dir, logFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "before 4")
+	assert.Regexp(t, `FATAL flashlight.logging: fatal_test.go:\d+ unable to continue`, string(b), "should have drained the queues")
+	sent := sender.sent()
+	if assert.Len(t, sent, 6, "should have flushed to Loggly") {
+		assert.Contains(t, sent[5]["fullMessage"], "unable to continue")
+	}
+}
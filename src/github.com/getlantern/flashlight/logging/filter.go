@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// denylist holds the []string of substrings from Options.Denylist
+	denylist atomic.Value
+
+	deniedLines uint64
+
+	// regexFilters holds the current *regexFilters
+	filters atomic.Value
+
+	filteredLines uint64
+)
+
+func init() {
+	denylist.Store([]string(nil))
+	filters.Store(&regexFilters{})
+}
+
+type regexFilters struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// SetFilters changes the regex filters applied to every line at runtime. If
+// include is not empty, only lines matching it are logged. Lines matching
+// exclude are never logged, even if they also match include. It returns an
+// error and leaves the current filters in place if either pattern is invalid.
+func SetFilters(include string, exclude string) error {
+	f := &regexFilters{}
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile(include); err != nil {
+			return fmt.Errorf("Invalid include filter %v: %v", include, err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile(exclude); err != nil {
+			return fmt.Errorf("Invalid exclude filter %v: %v", exclude, err)
+		}
+	}
+	filters.Store(f)
+	return nil
+}
+
+// setOutputs sets golog's outputs, applying the filters that apply to every
+// destination (file, stdout/stderr and remotes alike) on top of them.
+func setOutputs(errOut io.Writer, dbgOut io.Writer) {
+	if o := currentOrdered(); o != nil {
+		errOut, dbgOut = o.writer(errOut), o.writer(dbgOut)
+	}
+	errOut, dbgOut = &lineFilter{errOut}, &lineFilter{&remoteBooster{dbgOut}}
+	if currentOptions().GoroutineIds {
+		errOut, dbgOut = &goroutineTagger{errOut}, &goroutineTagger{dbgOut}
+	}
+	errOut, dbgOut = runStages(errOut, dbgOut)
+	// Mask secrets before anything else can see or hold on to them
+	setGologOutputs(&secretMasker{errOut}, &secretMasker{dbgOut})
+}
+
+// lineFilter drops lines that shouldn't be logged anywhere and holds them
+// back while paused.
+type lineFilter struct {
+	io.Writer
+}
+
+func (w *lineFilter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *lineFilter) writeAt(p []byte, t time.Time) (int, error) {
+	if denied(p) {
+		atomic.AddUint64(&deniedLines, 1)
+		return len(p), nil
+	}
+	if filteredOut(p) {
+		atomic.AddUint64(&filteredLines, 1)
+		return len(p), nil
+	}
+	if held(w.Writer, p, t) {
+		return len(p), nil
+	}
+	return writeTimed(w.Writer, p, t)
+}
+
+// filteredOut tells whether the line is excluded by the regex filters.
+func filteredOut(p []byte) bool {
+	f := filters.Load().(*regexFilters)
+	if f.exclude != nil && f.exclude.Match(p) {
+		return true
+	}
+	return f.include != nil && !f.include.Match(p)
+}
+
+// denied tells whether the line contains any of the substrings in the
+// denylist.
+func denied(p []byte) bool {
+	list := denylist.Load().([]string)
+	if len(list) == 0 {
+		return false
+	}
+	line := string(p)
+	for _, s := range list {
+		if s != "" && strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDenylist(t *testing.T) {
+	denylist.Store([]string{"known benign warning", ""})
+	defer denylist.Store([]string(nil))
+	defer golog.ResetOutputs()
+
+	var errBuf, remoteBuf bytes.Buffer
+	oldErrorOut := errorOut
+	defer func() {
+		errorOut = oldErrorOut
+	}()
+	errorOut = &errBuf
+	errOut, dbgOut := outputsWithRemotes("linux", []io.Writer{&remoteBuf})
+	setOutputs(errOut, dbgOut)
+	l := golog.LoggerFor("test")
+
+	before := atomic.LoadUint64(&deniedLines)
+	statsBefore := Stats().DeniedLines
+	l.Error("this is a known benign warning: ignore")
+	l.Error("this is a real problem")
+
+	assert.NotContains(t, errBuf.String(), "benign", "denylisted line should not reach local output")
+	assert.NotContains(t, remoteBuf.String(), "benign", "denylisted line should not reach remotes")
+	assert.Contains(t, errBuf.String(), "real problem")
+	assert.Contains(t, remoteBuf.String(), "real problem")
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&deniedLines)-before)
+	assert.Equal(t, uint64(1), Stats().DeniedLines-statsBefore)
+}
+
+func TestSetFilters(t *testing.T) {
+	defer SetFilters("", "")
+
+	assert.Error(t, SetFilters("(unclosed", ""), "should reject invalid include")
+	assert.Error(t, SetFilters("", "[z-a]"), "should reject invalid exclude")
+	assert.False(t, filteredOut([]byte("anything")), "invalid filters should leave the old ones in place")
+
+	assert.NoError(t, SetFilters(`flashlight\.(proxy|client)`, `heartbeat|keepalive`))
+	assert.False(t, filteredOut([]byte("DEBUG flashlight.proxy: a.go:1 dialing")))
+	assert.True(t, filteredOut([]byte("DEBUG flashlight.ui: a.go:1 serving")), "should drop lines not matching include")
+	assert.True(t, filteredOut([]byte("DEBUG flashlight.proxy: a.go:1 keepalive")), "exclude should win over include")
+
+	before := Stats().FilteredLines
+	var buf bytes.Buffer
+	w := &lineFilter{&buf}
+	w.Write([]byte("DEBUG flashlight.client: a.go:1 kept\n"))
+	w.Write([]byte("DEBUG flashlight.ui: a.go:1 dropped\n"))
+	assert.Equal(t, "DEBUG flashlight.client: a.go:1 kept\n", buf.String())
+	assert.Equal(t, uint64(1), Stats().FilteredLines-before)
+}
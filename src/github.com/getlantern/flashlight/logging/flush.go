@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultFlushInterval = 2 * time.Second
+
+	// sweepInterval is how often rotated files are checked against
+	// Options.MaxAge
+	sweepInterval = 1 * time.Hour
+)
+
+var (
+	// ErrNotInitialized is returned when using logging before Init
+	ErrNotInitialized = errors.New("Logging not initialized")
+
+	// ErrClosed is returned when using logging after Close
+	ErrClosed = errors.New("Logging closed")
+
+	flusherStop chan struct{}
+	sweeperStop chan struct{}
+)
+
+// Flush writes out any log lines buffered in memory to the log file. It's a
+// no-op if logging isn't buffered. It returns ErrNotInitialized before Init
+// and ErrClosed after Close.
+func Flush() error {
+	f := currentLogFile()
+	if f == nil {
+		return ErrNotInitialized
+	}
+	return f.Flush()
+}
+
+// Rotate rotates the log file right away, e.g. to start afresh before
+// reproducing an issue. It returns ErrNotInitialized before Init and ErrClosed
+// after Close.
+func Rotate() error {
+	f := currentLogFile()
+	if f == nil {
+		return ErrNotInitialized
+	}
+	return f.Rotate()
+}
+
+// SetRotationSize changes the size at which the log file is rotated without
+// restarting, e.g. to shrink the logs footprint under storage pressure. The
+// current file is rotated with the next write if it's already larger. It
+// returns ErrNotInitialized before Init.
+func SetRotationSize(n int64) error {
+	if n <= 0 {
+		return fmt.Errorf("Invalid rotation size %d", n)
+	}
+	f := currentLogFile()
+	if f == nil {
+		return ErrNotInitialized
+	}
+	f.SetRotationSize(n)
+	return nil
+}
+
+// ErrTimeBasedRotation is returned by BytesUntilRotation when files are also
+// rotated at the end of each day, so that size alone doesn't tell when.
+var ErrTimeBasedRotation = errors.New("Log files are rotated by date")
+
+// BytesUntilRotation returns how many more bytes can be written to the log
+// file before it's rotated, e.g. for shippers to pick up the current file
+// beforehand. It returns ErrNotInitialized before Init, ErrClosed after Close
+// and ErrTimeBasedRotation with RotateByDateAndSize.
+func BytesUntilRotation() (int64, error) {
+	f := currentLogFile()
+	if f == nil {
+		return 0, ErrNotInitialized
+	}
+	return f.bytesUntilRotation()
+}
+
+// startFlusher flushes r every interval until stopFlusher is called.
+func startFlusher(r *sizeRotator, interval time.Duration) {
+	stop := make(chan struct{})
+	flusherStop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := r.Flush(); err != nil {
+					log.Debugf("Unable to flush log file: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func stopFlusher() {
+	if flusherStop != nil {
+		close(flusherStop)
+		flusherStop = nil
+	}
+}
+
+// startSweeper deletes the expired rotated files of r every interval until
+// stopSweeper is called.
+func startSweeper(r *sizeRotator, interval time.Duration) {
+	stop := make(chan struct{})
+	sweeperStop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.Sweep()
+			}
+		}
+	}()
+}
+
+func stopSweeper() {
+	if sweeperStop != nil {
+		close(sweeperStop)
+		sweeperStop = nil
+	}
+}
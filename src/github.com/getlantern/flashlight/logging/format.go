@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Format determines how lines are rendered in the log file.
+type Format int
+
+const (
+	// FormatText is golog's line prefixed with a UTC timestamp (the default)
+	// and, if Options.InstanceIdInFile or Options.ProxyAddrInFile are set, the
+	// instance id and proxy address.
+	FormatText Format = iota
+
+	// FormatJSON renders each line as a JSON object with ts, level, logger and
+	// msg fields.
+	FormatJSON
+
+	// FormatCEF renders each line in ArcSight's Common Event Format for
+	// ingestion by SIEM tools, e.g.
+	// CEF:0|Lantern|flashlight|2.0.0|ERROR|flashlight.foo|7|rt=1433160000000 msg=...
+	FormatCEF
+
+	// FormatLogfmt renders each line as logfmt key=value pairs, e.g.
+	// ts=2015-06-01T12:00:00Z level=error logger=flashlight.foo msg="..."
+	FormatLogfmt
+)
+
+var (
+	// appVersion is the version reported in formats that include it, set by
+	// Configure.
+	appVersion atomic.Value
+
+	// fileInstanceId is the instance id included in each line of the log file
+	// if Options.InstanceIdInFile is set, set by Configure.
+	fileInstanceId atomic.Value
+
+	// fileProxyAddr is the proxy address included in each line of the log
+	// file if Options.ProxyAddrInFile is set, set by Configure.
+	fileProxyAddr atomic.Value
+)
+
+func init() {
+	appVersion.Store("")
+	fileInstanceId.Store("")
+	fileProxyAddr.Store("")
+}
+
+// cefSeverities maps levels to CEF severities (0-10).
+var cefSeverities = map[string]int{
+	levelTrace: 1,
+	levelDebug: 2,
+	levelInfo:  3,
+	levelError: 7,
+	levelFatal: 10,
+}
+
+// formatted creates a writer that renders lines to w in the given format.
+func formatted(w io.Writer, format Format) io.Writer {
+	switch format {
+	case FormatJSON:
+		return &recordFormatter{w, formatJSON}
+	case FormatCEF:
+		return &recordFormatter{w, formatCEF}
+	case FormatLogfmt:
+		return &recordFormatter{w, formatLogfmt}
+	default:
+		return textFormatted(w, true)
+	}
+}
+
+// textFormatted creates a writer that renders lines to w as text, prefixed
+// with the instance and proxy tags and, if timestamp is set, the time.
+func textFormatted(w io.Writer, timestamp bool) io.Writer {
+	return prependLines(w, func(t time.Time) []byte {
+		prefix := make([]byte, 0, timestampPrefixLen)
+		if timestamp {
+			prefix = appendTimestampPrefix(prefix, t.In(time.UTC))
+		}
+		if id := fileInstanceId.Load().(string); id != "" {
+			prefix = append(append(append(prefix, '['), id...), "] "...)
+		}
+		if addr := fileProxyAddr.Load().(string); addr != "" {
+			prefix = append(append(append(prefix, "[proxy="...), addr...), "] "...)
+		}
+		return prefix
+	})
+}
+
+// recordFormatter parses each golog line written to it and writes it to the
+// underlying writer as a single formatted record.
+type recordFormatter struct {
+	io.Writer
+	format func(ts time.Time, level string, logger string, msg string) string
+}
+
+func (w *recordFormatter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *recordFormatter) writeAt(p []byte, t time.Time) (int, error) {
+	level, logger, msg := parseLine(string(p))
+	_, err := io.WriteString(w.Writer, w.format(t.In(time.UTC), level, logger, msg))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func formatJSON(ts time.Time, level string, logger string, msg string) string {
+	record := map[string]string{
+		"ts":     ts.Format(time.RFC3339Nano),
+		"level":  level,
+		"logger": logger,
+		"msg":    msg,
+	}
+	if id := fileInstanceId.Load().(string); id != "" {
+		record["instanceId"] = id
+	}
+	if addr := fileProxyAddr.Load().(string); addr != "" {
+		record["proxy"] = addr
+	}
+	b, _ := json.Marshal(record)
+	return string(b) + "\n"
+}
+
+func formatCEF(ts time.Time, level string, logger string, msg string) string {
+	severity, found := cefSeverities[level]
+	if !found {
+		severity = 5
+	}
+	if level == "" {
+		level = "UNKNOWN"
+	}
+	if logger == "" {
+		logger = "unknown"
+	}
+	return fmt.Sprintf("CEF:0|Lantern|flashlight|%s|%s|%s|%d|rt=%d msg=%s\n",
+		cefHeaderEscaper.Replace(appVersion.Load().(string)),
+		cefHeaderEscaper.Replace(level),
+		cefHeaderEscaper.Replace(logger),
+		severity,
+		ts.UnixNano()/int64(time.Millisecond),
+		cefExtensionEscaper.Replace(msg))
+}
+
+func formatLogfmt(ts time.Time, level string, logger string, msg string) string {
+	fields := []string{
+		"ts", ts.Format(time.RFC3339Nano),
+		"level", strings.ToLower(level),
+		"logger", logger,
+	}
+	if id := fileInstanceId.Load().(string); id != "" {
+		fields = append(fields, "instanceId", id)
+	}
+	if addr := fileProxyAddr.Load().(string); addr != "" {
+		fields = append(fields, "proxy", addr)
+	}
+	fields = append(fields, "msg", msg)
+	var b strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fields[i])
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(fields[i+1]))
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// logfmtValue quotes value if it's empty or contains spaces, quotes, equals
+// signs or control characters.
+func logfmtValue(value string) string {
+	if value == "" || strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || r == '\\' || r == 0x7f
+	}) >= 0 {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
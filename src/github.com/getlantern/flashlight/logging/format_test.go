@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatCEF(t *testing.T) {
+	appVersion.Store("2.0.0")
+	defer appVersion.Store("")
+
+	var buf bytes.Buffer
+	w := formatted(&buf, FormatCEF)
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	w.Write([]byte("ERROR flashlight.proxy: proxy.go:10 unable to dial a|b: key=value\\path\n"))
+
+	line := buf.String()
+	assert.True(t, strings.HasSuffix(line, "\n"))
+	fields := strings.SplitN(strings.TrimSuffix(line, "\n"), "|", 8)
+	if assert.Len(t, fields, 8) {
+		assert.Equal(t, "CEF:0", fields[0])
+		assert.Equal(t, "Lantern", fields[1])
+		assert.Equal(t, "flashlight", fields[2])
+		assert.Equal(t, "2.0.0", fields[3])
+		assert.Equal(t, "ERROR", fields[4])
+		assert.Equal(t, "flashlight.proxy", fields[5])
+		assert.Equal(t, "7", fields[6])
+	}
+	assert.Contains(t, line, `msg=proxy.go:10 unable to dial a|b: key\=value\\path`)
+	idx := strings.Index(line, "|rt=")
+	if assert.True(t, idx > 0) {
+		var rt int64
+		_, err := fmt.Sscan(line[idx+4:], &rt)
+		assert.NoError(t, err)
+		assert.True(t, rt >= before, "rt should be a current timestamp in millis")
+	}
+}
+
+func TestFormatCEFSeverities(t *testing.T) {
+	for _, c := range []struct {
+		line     string
+		severity string
+	}{
+		{"DEBUG a: a.go:1 x\n", "|2|"},
+		{"FATAL a: a.go:1 x\n", "|10|"},
+		{"no level\n", "|UNKNOWN|unknown|5|"},
+	} {
+		var buf bytes.Buffer
+		formatted(&buf, FormatCEF).Write([]byte(c.line))
+		assert.Contains(t, buf.String(), c.severity)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	var buf bytes.Buffer
+	formatted(&buf, FormatJSON).Write([]byte("ERROR flashlight.proxy: proxy.go:10 unable to dial\n"))
+	var result map[string]string
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &result)) {
+		assert.Equal(t, "ERROR", result["level"])
+		assert.Equal(t, "flashlight.proxy", result["logger"])
+		assert.Equal(t, "proxy.go:10 unable to dial", result["msg"])
+		_, err := time.Parse(time.RFC3339Nano, result["ts"])
+		assert.NoError(t, err)
+	}
+}
+
+func TestInstanceIdInFile(t *testing.T) {
+	defer fileInstanceId.Store("")
+
+	var buf bytes.Buffer
+	w := formatted(&buf, FormatText)
+	w.Write([]byte("DEBUG test: format_test.go:1 before\n"))
+	fileInstanceId.Store("abc123")
+	w.Write([]byte("DEBUG test: format_test.go:2 after\nsecond line\n"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Regexp(t, `^[^\[]+ - DEBUG test: format_test.go:1 before$`, lines[0])
+		assert.Regexp(t, ` - \[abc123\] DEBUG test: format_test.go:2 after$`, lines[1])
+		assert.Regexp(t, `^[^\[]+ - \[abc123\] second line$`, lines[2], "instance id should be added once per line")
+	}
+
+	buf.Reset()
+	formatted(&buf, FormatJSON).Write([]byte("DEBUG test: format_test.go:3 json\n"))
+	var result map[string]string
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &result)) {
+		assert.Equal(t, "abc123", result["instanceId"])
+	}
+}
+
+func TestProxyAddrInFile(t *testing.T) {
+	defer fileProxyAddr.Store("")
+	fileProxyAddr.Store(proxyTag("10.0.0.1:443", false))
+
+	var buf bytes.Buffer
+	formatted(&buf, FormatText).Write([]byte("DEBUG test: format_test.go:1 text\n"))
+	assert.Regexp(t, ` - \[proxy=10\.0\.0\.1:443\] DEBUG test: format_test.go:1 text\n$`, buf.String())
+
+	buf.Reset()
+	formatted(&buf, FormatJSON).Write([]byte("DEBUG test: format_test.go:2 json\n"))
+	var result map[string]string
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &result)) {
+		assert.Equal(t, "10.0.0.1:443", result["proxy"])
+	}
+}
+
+func TestProxyTag(t *testing.T) {
+	assert.Equal(t, "", proxyTag("", true))
+	assert.Equal(t, "10.0.0.1:443", proxyTag("10.0.0.1:443", false))
+	redacted := proxyTag("10.0.0.1:443", true)
+	assert.Regexp(t, `^[0-9a-f]{12}:443$`, redacted, "should hash the host but keep the port")
+	assert.Equal(t, redacted, proxyTag("10.0.0.1:443", true), "should be stable")
+	assert.NotEqual(t, redacted, proxyTag("10.0.0.2:443", true))
+	assert.Regexp(t, `^[0-9a-f]{12}$`, proxyTag("10.0.0.1", true))
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	ts := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "ts=2015-06-01T12:00:00Z level=error logger=flashlight.proxy msg=\"format_test.go:1 dial failed: a=b, \\\"quoted\\\" \\\\ path\"\n",
+		formatLogfmt(ts, levelError, "flashlight.proxy", `format_test.go:1 dial failed: a=b, "quoted" \ path`))
+	assert.Equal(t, "ts=2015-06-01T12:00:00Z level=debug logger=flashlight msg=simple\n",
+		formatLogfmt(ts, levelDebug, "flashlight", "simple"))
+	assert.Equal(t, "ts=2015-06-01T12:00:00Z level=\"\" logger=\"\" msg=\"line one\\nline two\"\n",
+		formatLogfmt(ts, "", "", "line one\nline two"), "should quote empty values and escape newlines")
+
+	var buf bytes.Buffer
+	formatted(&buf, FormatLogfmt).Write([]byte("ERROR flashlight.ui: format_test.go:2 failed\n"))
+	assert.Regexp(t, `^ts=\S+ level=error logger=flashlight\.ui msg="format_test\.go:2 failed"\n$`, buf.String())
+}
+
+func TestTextWithoutTimestamp(t *testing.T) {
+	defer fileInstanceId.Store("")
+	var buf bytes.Buffer
+	w := textFormatted(&buf, false)
+	w.Write([]byte("DEBUG test: format_test.go:1 plain\n"))
+	fileInstanceId.Store("abc123")
+	w.Write([]byte("DEBUG test: format_test.go:2 tagged\n"))
+	assert.Equal(t, "DEBUG test: format_test.go:1 plain\n[abc123] DEBUG test: format_test.go:2 tagged\n", buf.String())
+}
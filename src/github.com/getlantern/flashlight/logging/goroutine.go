@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+var goroutinePrefix = []byte("goroutine ")
+
+// goroutineTagger adds the id of the goroutine writing each line after its
+// location, like "DEBUG flashlight: a.go:12 [g=42] msg". It must be called
+// from the goroutine that logged the line, so before any asynchronous output.
+type goroutineTagger struct {
+	io.Writer
+}
+
+func (w *goroutineTagger) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *goroutineTagger) writeAt(p []byte, t time.Time) (int, error) {
+	i := locationEnd(p)
+	if i < 0 {
+		return writeTimed(w.Writer, p, t)
+	}
+	tag := strconv.AppendUint([]byte("[g="), goroutineID(), 10)
+	tagged := make([]byte, 0, len(p)+len(tag)+2)
+	tagged = append(tagged, p[:i+1]...)
+	tagged = append(append(tagged, tag...), "] "...)
+	tagged = append(tagged, p[i+1:]...)
+	if _, err := writeTimed(w.Writer, tagged, t); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// locationEnd returns the index of the space following the file:line
+// location of a golog line, or -1 if it isn't one.
+func locationEnd(p []byte) int {
+	if levelOf(p) == "" {
+		return -1
+	}
+	i := bytes.Index(p, []byte(": "))
+	if i < 0 {
+		return -1
+	}
+	i += 2
+	j := bytes.IndexByte(p[i:], ' ')
+	if j <= 0 || bytes.IndexByte(p[i:i+j], ':') < 0 {
+		return -1
+	}
+	return i + j
+}
+
+// goroutineID returns the id of the calling goroutine, parsed from the
+// header of its stack trace, which is stable for the goroutine's lifetime.
+// It's too costly to be used outside of Options.GoroutineIds.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, goroutinePrefix)
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
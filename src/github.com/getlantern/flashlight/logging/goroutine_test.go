@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoroutineID(t *testing.T) {
+	id := goroutineID()
+	assert.NotEqual(t, uint64(0), id)
+	assert.Equal(t, id, goroutineID(), "should be stable for a goroutine")
+	other := make(chan uint64)
+	go func() {
+		other <- goroutineID()
+	}()
+	assert.NotEqual(t, id, <-other, "should differ between goroutines")
+}
+
+func TestGoroutineTagger(t *testing.T) {
+	var buf bytes.Buffer
+	w := &goroutineTagger{&buf}
+	line := "DEBUG flashlight: a.go:12 dialing: proxy\n"
+	n, err := w.Write([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n)
+	assert.Equal(t, fmt.Sprintf("DEBUG flashlight: a.go:12 [g=%d] dialing: proxy\n", goroutineID()), buf.String())
+
+	for _, line := range []string{"not from golog\n", "INFO flashlight.logging: heartbeat uptime=1s\n"} {
+		buf.Reset()
+		w.Write([]byte(line))
+		assert.Equal(t, line, buf.String(), "should leave lines without a location alone")
+	}
+}
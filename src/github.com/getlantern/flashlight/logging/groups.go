@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// otherGroup is the Loggly message that new groups collapse into beyond
+	// Options.LogglyMaxGroups
+	otherGroup = "other"
+
+	defaultGroupResetInterval = 1 * time.Hour
+)
+
+var (
+	// logglyGroups is the number of distinct Loggly messages currently
+	// tracked
+	logglyGroups uint64
+)
+
+// groupTracker caps the number of distinct messages, which Loggly groups by,
+// to protect against messages that vary with each occurrence. It forgets the
+// groups it has seen every resetInterval.
+type groupTracker struct {
+	max           int
+	resetInterval time.Duration
+	seen          map[string]bool
+	resetAt       time.Time
+	mutex         sync.Mutex
+}
+
+func newGroupTracker(max int, resetInterval time.Duration) *groupTracker {
+	if resetInterval <= 0 {
+		resetInterval = defaultGroupResetInterval
+	}
+	atomic.StoreUint64(&logglyGroups, 0)
+	return &groupTracker{
+		max:           max,
+		resetInterval: resetInterval,
+		seen:          make(map[string]bool),
+		resetAt:       time.Now().Add(resetInterval),
+	}
+}
+
+// group returns the message to use as the group, which is otherGroup if
+// message is new and the cap is reached.
+func (t *groupTracker) group(message string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if now := time.Now(); now.After(t.resetAt) {
+		t.seen = make(map[string]bool)
+		t.resetAt = now.Add(t.resetInterval)
+	}
+	if !t.seen[message] {
+		if len(t.seen) >= t.max {
+			return otherGroup
+		}
+		t.seen[message] = true
+		atomic.StoreUint64(&logglyGroups, uint64(len(t.seen)))
+	}
+	return message
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupTracker(t *testing.T) {
+	g := newGroupTracker(2, time.Hour)
+	assert.Equal(t, "a", g.group("a"))
+	assert.Equal(t, "b", g.group("b"))
+	assert.Equal(t, otherGroup, g.group("c"), "should collapse new groups beyond the cap")
+	assert.Equal(t, "a", g.group("a"), "should keep known groups")
+	assert.Equal(t, uint64(2), Stats().LogglyGroups)
+
+	g.resetAt = time.Now().Add(-time.Second)
+	assert.Equal(t, "c", g.group("c"), "should forget groups after the reset interval")
+	assert.Equal(t, uint64(1), Stats().LogglyGroups)
+}
+
+func TestLogglyWriterGroups(t *testing.T) {
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender, groups: newGroupTracker(1, time.Hour)}
+	lw.Write([]byte("ERROR flashlight: groups_test.go:1 failed for id 1\n"))
+	lw.Write([]byte("ERROR flashlight: groups_test.go:1 failed for id 2\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, "groups_test.go:1 failed for id 1", msgs[0]["message"])
+		assert.Equal(t, otherGroup, msgs[1]["message"])
+		assert.Equal(t, "ERROR flashlight: groups_test.go:1 failed for id 2\n", msgs[1]["fullMessage"], "should keep the full message")
+	}
+}
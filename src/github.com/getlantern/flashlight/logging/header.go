@@ -0,0 +1,19 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileHeader returns the header line written at the start of log files with
+// Options.FileHeader, which starts with # so that it doesn't parse as a golog
+// line. Like in Loggly, the hostname is hidden.
+func fileHeader() string {
+	version := appVersion.Load().(string)
+	if version == "" {
+		version = "unknown"
+	}
+	return fmt.Sprintf("# lantern pid=%d started=%v version=%v hostname=hidden\n",
+		os.Getpid(), startTime.In(time.UTC).Format(time.RFC3339), version)
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+var (
+	heartbeatStop chan struct{}
+)
+
+// startHeartbeat periodically writes an INFO line with the uptime and the
+// Stats() counters to out (and to Loggly if toLoggly is set and Loggly is
+// active), so that a quiet log can be told apart from a broken one. If
+// withRuntime is set, the line also includes runtime stats.
+func startHeartbeat(out io.Writer, interval time.Duration, toLoggly bool, withRuntime bool) {
+	stop := make(chan struct{})
+	heartbeatStop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				var rt *runtimeStats
+				if withRuntime {
+					rt = readRuntimeStats()
+				}
+				line := []byte(heartbeatLine(time.Since(startTime), Stats(), rt))
+				out.Write(line)
+				if toLoggly {
+					if lw := activeLoggly(); lw != nil {
+						lw.Write(line)
+					}
+				}
+			}
+		}
+	}()
+}
+
+func stopHeartbeat() {
+	if heartbeatStop != nil {
+		close(heartbeatStop)
+		heartbeatStop = nil
+	}
+}
+
+func heartbeatLine(uptime time.Duration, stats Statistics, rt *runtimeStats) string {
+	var rateLimited uint64
+	for _, count := range stats.RateLimitedLines {
+		rateLimited += count
+	}
+	line := fmt.Sprintf("%s flashlight.logging: heartbeat uptime=%v errorLines=%d debugLines=%d throttledLines=%d deniedLines=%d filteredLines=%d pausedLines=%d sampledLines=%d rateLimitedLines=%d dedupedLines=%d observerDroppedLines=%d",
+		levelInfo, uptime/time.Second*time.Second, stats.ErrorLines, stats.DebugLines, stats.ThrottledLines,
+		stats.DeniedLines, stats.FilteredLines, stats.PausedLines, stats.SampledLines, rateLimited,
+		stats.DedupedLines, stats.ObserverDroppedLines)
+	if rt != nil {
+		line += fmt.Sprintf(" goroutines=%d heapAlloc=%d numGC=%d", rt.goroutines, rt.heapAlloc, rt.numGC)
+	}
+	return line + "\n"
+}
+
+// runtimeStats are the runtime figures included in the heartbeat with
+// Options.HeartbeatRuntimeStats.
+type runtimeStats struct {
+	goroutines int
+	heapAlloc  uint64
+	numGC      uint32
+}
+
+// readRuntimeStats reads the current runtimeStats. It stops the world to read
+// the memstats so it's only meant to be called on each heartbeat.
+func readRuntimeStats() *runtimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return &runtimeStats{
+		goroutines: runtime.NumGoroutine(),
+		heapAlloc:  m.HeapAlloc,
+		numGC:      m.NumGC,
+	}
+}
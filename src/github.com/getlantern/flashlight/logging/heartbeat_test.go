@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type syncBuffer struct {
+	bytes.Buffer
+	sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestHeartbeatLine(t *testing.T) {
+	stats := Statistics{
+		ErrorLines:           2,
+		DebugLines:           5,
+		ThrottledLines:       10,
+		DeniedLines:          3,
+		FilteredLines:        11,
+		PausedLines:          12,
+		SampledLines:         4,
+		RateLimitedLines:     map[string]uint64{"DEBUG": 6, "ERROR": 1},
+		DedupedLines:         8,
+		ObserverDroppedLines: 9,
+	}
+	line := heartbeatLine(90*time.Second+300*time.Millisecond, stats, nil)
+	assert.Equal(t, "INFO flashlight.logging: heartbeat uptime=1m30s errorLines=2 debugLines=5 throttledLines=10 deniedLines=3 filteredLines=11 pausedLines=12 sampledLines=4 rateLimitedLines=7 dedupedLines=8 observerDroppedLines=9\n", line)
+	assert.Equal(t, levelInfo, levelOf([]byte(line)))
+
+	line = heartbeatLine(time.Second, Statistics{}, &runtimeStats{goroutines: 12, heapAlloc: 4096, numGC: 3})
+	assert.Equal(t, "INFO flashlight.logging: heartbeat uptime=1s errorLines=0 debugLines=0 throttledLines=0 deniedLines=0 filteredLines=0 pausedLines=0 sampledLines=0 rateLimitedLines=0 dedupedLines=0 observerDroppedLines=0 goroutines=12 heapAlloc=4096 numGC=3\n", line)
+}
+
+func TestHeartbeat(t *testing.T) {
+	var buf syncBuffer
+	startHeartbeat(&buf, 10*time.Millisecond, false, true)
+	time.Sleep(55 * time.Millisecond)
+	stopHeartbeat()
+	assert.Contains(t, buf.String(), " goroutines=")
+	beats := strings.Count(buf.String(), "heartbeat")
+	assert.True(t, beats >= 2, "should have emitted several heartbeats, got %d", beats)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, beats, strings.Count(buf.String(), "heartbeat"), "no heartbeats after stopping")
+}
+
+func TestPackageLinesFiltered(t *testing.T) {
+	denylist.Store([]string{"denied"})
+	defer denylist.Store([]string(nil))
+	defer resetGologOutputs()
+
+	var dbgBuf syncBuffer
+	oldDebugOut := debugOut
+	defer func() {
+		debugOut = oldDebugOut
+	}()
+	debugOut = &dbgBuf
+	setOutputs(&syncBuffer{}, debugOut)
+
+	logInfo("denied line")
+	logInfo("kept line")
+	Pause()
+	logInfo("paused line")
+	startHeartbeat(debugStream{}, 10*time.Millisecond, false, false)
+	time.Sleep(35 * time.Millisecond)
+	stopHeartbeat()
+	Resume()
+
+	assert.Contains(t, dbgBuf.String(), "kept line")
+	assert.NotContains(t, dbgBuf.String(), "denied line", "should apply the denylist")
+	assert.NotContains(t, dbgBuf.String(), "paused line", "should apply Pause")
+	assert.NotContains(t, dbgBuf.String(), "heartbeat", "should apply Pause to the heartbeat")
+}
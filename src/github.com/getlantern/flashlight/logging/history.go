@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultErrorHistorySize = 50
+)
+
+var (
+	errorHistory = newHistory(defaultErrorHistorySize)
+)
+
+// ErrorEntry is an error line kept in the recent error history.
+type ErrorEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Logger    string    `json:"logger"`
+	Message   string    `json:"message"`
+}
+
+// RecentErrors returns the most recently logged errors, oldest first. It
+// returns an empty slice if nothing has been logged yet.
+func RecentErrors() []ErrorEntry {
+	return errorHistory.entries()
+}
+
+// RecentErrorsJSON returns the same entries as RecentErrors serialized as a
+// JSON array, suitable for posting to a support backend. It is safe to call
+// before Init, in which case it returns an empty array.
+func RecentErrorsJSON() ([]byte, error) {
+	return json.Marshal(RecentErrors())
+}
+
+// history is a fixed-size ring of ErrorEntries.
+type history struct {
+	ring []ErrorEntry
+	next int
+	full bool
+	// bytes is the size of the entries held, updated with the mutex held and
+	// read atomically
+	bytes int64
+	mutex sync.Mutex
+}
+
+func newHistory(size int) *history {
+	return &history{ring: make([]ErrorEntry, size)}
+}
+
+// reset clears the history and changes its size.
+func (h *history) reset(size int) {
+	h.mutex.Lock()
+	h.ring = make([]ErrorEntry, size)
+	h.next = 0
+	h.full = false
+	atomic.StoreInt64(&h.bytes, 0)
+	h.mutex.Unlock()
+}
+
+func (h *history) add(entry ErrorEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.ring) == 0 {
+		return
+	}
+	atomic.AddInt64(&h.bytes, entry.size()-h.ring[h.next].size())
+	h.ring[h.next] = entry
+	h.next = (h.next + 1) % len(h.ring)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+func (h *history) entries() []ErrorEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	result := make([]ErrorEntry, 0, len(h.ring))
+	for _, entry := range h.ordered() {
+		// Trimmed entries are left empty
+		if entry.Level != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// ordered returns the slots of the ring oldest first. It must be called with
+// the mutex held.
+func (h *history) ordered() []ErrorEntry {
+	var result []ErrorEntry
+	if h.full {
+		result = append(result, h.ring[h.next:]...)
+	}
+	return append(result, h.ring[:h.next]...)
+}
+
+// trim evicts the oldest entries until at least n bytes are freed or the
+// history is empty, returning the number of bytes freed.
+func (h *history) trim(n int64) int64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var freed int64
+	for i := 0; i < len(h.ring) && freed < n; i++ {
+		// Oldest first
+		j := i
+		if h.full {
+			j = (h.next + i) % len(h.ring)
+		}
+		freed += h.ring[j].size()
+		h.ring[j] = ErrorEntry{}
+	}
+	atomic.AddInt64(&h.bytes, -freed)
+	return freed
+}
+
+// size is roughly how much memory the entry's strings take.
+func (e ErrorEntry) size() int64 {
+	return int64(len(e.Level) + len(e.Logger) + len(e.Message))
+}
+
+type errorRecorder struct {
+	io.Writer
+	h *history
+}
+
+// recordErrors creates a writer that adds each line written to it to the
+// given history before passing it on to w.
+func recordErrors(w io.Writer, h *history) io.Writer {
+	return &errorRecorder{w, h}
+}
+
+func (w *errorRecorder) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *errorRecorder) writeAt(p []byte, t time.Time) (int, error) {
+	level, logger, message := parseLine(string(p))
+	if level == "" {
+		level = levelError
+	}
+	w.h.add(ErrorEntry{
+		Timestamp: t.In(time.UTC),
+		Level:     level,
+		Logger:    logger,
+		Message:   message,
+	})
+	checkBufferBudget()
+	return writeTimed(w.Writer, p, t)
+}
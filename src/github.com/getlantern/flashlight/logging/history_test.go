@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	level, logger, message := parseLine("ERROR flashlight.foo: foo.go:12 bad things: happened\n")
+	assert.Equal(t, "ERROR", level)
+	assert.Equal(t, "flashlight.foo", logger)
+	assert.Equal(t, "foo.go:12 bad things: happened", message)
+
+	_, _, message = parseLine("ERROR flashlight.foo: foo.go:12 bad things: happened\r\n")
+	assert.Equal(t, "foo.go:12 bad things: happened", message, "should handle CRLF")
+
+	level, logger, message = parseLine("not from golog")
+	assert.Equal(t, "", level)
+	assert.Equal(t, "", logger)
+	assert.Equal(t, "not from golog", message)
+}
+
+func TestRecentErrorsJSONEmpty(t *testing.T) {
+	b, err := json.Marshal(newHistory(5).entries())
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", string(b))
+}
+
+func TestRecentErrors(t *testing.T) {
+	h := newHistory(3)
+	w := recordErrors(ioutil.Discard, h)
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(w, "ERROR test: history_test.go:%d error %d\n", i, i)
+	}
+	entries := h.entries()
+	if assert.Len(t, entries, 3, "history should be bounded") {
+		assert.Equal(t, "history_test.go:2 error 2", entries[0].Message, "oldest entry should come first")
+		assert.Equal(t, "history_test.go:4 error 4", entries[2].Message)
+		assert.Equal(t, "test", entries[2].Logger)
+		assert.Equal(t, "ERROR", entries[2].Level)
+	}
+
+	b, err := json.Marshal(entries)
+	if assert.NoError(t, err) {
+		var result []map[string]interface{}
+		if assert.NoError(t, json.Unmarshal(b, &result)) {
+			assert.Len(t, result, 3)
+			for _, field := range []string{"timestamp", "level", "logger", "message"} {
+				_, found := result[0][field]
+				assert.True(t, found, "missing field %v", field)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// +build linux
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// journalSocket is where journald listens for its native protocol.
+var journalSocket = "/run/systemd/journal/socket"
+
+// journalWriter sends each golog line to journald as a datagram of structured
+// fields so that journalctl can filter on level and logger, e.g.
+// journalctl LANTERN_LOGGER=flashlight.proxy.
+type journalWriter struct {
+	conn  *net.UnixConn
+	mutex sync.Mutex
+}
+
+func newJournalWriter(path string) (io.WriteCloser, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to journald at %v: %v", path, err)
+	}
+	return &journalWriter{conn: conn}, nil
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, err := w.conn.Write(journalEntry(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *journalWriter) Close() error {
+	return w.conn.Close()
+}
+
+// journalEntry encodes a golog line using journald's native protocol.
+func journalEntry(line string) []byte {
+	level, logger, message := parseLine(line)
+	var b bytes.Buffer
+	journalField(&b, "PRIORITY", journalPriority(level))
+	journalField(&b, "SYSLOG_IDENTIFIER", "lantern")
+	journalField(&b, "MESSAGE", message)
+	if level != "" {
+		journalField(&b, "LANTERN_LEVEL", level)
+	}
+	if logger != "" {
+		journalField(&b, "LANTERN_LOGGER", logger)
+	}
+	return b.Bytes()
+}
+
+// journalField appends a field, using the binary form for values spanning
+// several lines, like stack traces.
+func journalField(b *bytes.Buffer, name string, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalPriority maps golog levels to syslog priorities.
+func journalPriority(level string) string {
+	switch level {
+	case levelFatal:
+		return "2"
+	case levelError:
+		return "3"
+	case levelInfo:
+		return "6"
+	default:
+		return "7"
+	}
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package logging
+
+import (
+	"errors"
+	"io"
+)
+
+var journalSocket = ""
+
+func newJournalWriter(path string) (io.WriteCloser, error) {
+	return nil, errors.New("journald is only available on Linux")
+}
@@ -0,0 +1,59 @@
+// +build linux
+
+package logging
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalEntry(t *testing.T) {
+	assert.Equal(t, "PRIORITY=3\nSYSLOG_IDENTIFIER=lantern\nMESSAGE=a.go:1 failed\nLANTERN_LEVEL=ERROR\nLANTERN_LOGGER=flashlight.proxy\n",
+		string(journalEntry("ERROR flashlight.proxy: a.go:1 failed\n")))
+
+	trace := "a.go:1 boom\ngoroutine 1"
+	var expected []byte
+	expected = append(expected, "PRIORITY=2\nSYSLOG_IDENTIFIER=lantern\nMESSAGE\n"...)
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(len(trace)))
+	expected = append(expected, size...)
+	expected = append(expected, trace+"\nLANTERN_LEVEL=FATAL\nLANTERN_LOGGER=flashlight\n"...)
+	assert.Equal(t, expected, journalEntry("FATAL flashlight: "+trace+"\n"), "should use the binary form for multi-line values")
+
+	assert.Equal(t, "PRIORITY=7\nSYSLOG_IDENTIFIER=lantern\nMESSAGE=not a golog line\n", string(journalEntry("not a golog line")))
+}
+
+func TestJournalWriter(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	w, err := newJournalWriter(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer w.Close()
+	line := "DEBUG flashlight.client: a.go:1 dialing\n"
+	n, err := w.Write([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n)
+
+	b := make([]byte, 1024)
+	n, err = conn.Read(b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, journalEntry(line), b[:n])
+	}
+
+	_, err = newJournalWriter(filepath.Join(dir, "missing.socket"))
+	assert.Error(t, err, "should fail without journald")
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyBuckets is the number of histogram buckets, the i-th counting
+	// durations up to 2^i microseconds and the last one everything above.
+	latencyBuckets = 24
+)
+
+var (
+	fileWriteLatency = &latencyHistogram{}
+	rotationLatency  = &latencyHistogram{}
+)
+
+// Latency summarizes the durations of an operation. Percentiles are
+// approximate, rounded up to the next power of 2 microseconds.
+type Latency struct {
+	Count uint64
+	P50   time.Duration
+	P95   time.Duration
+	Max   time.Duration
+}
+
+// latencyHistogram records durations in power of 2 buckets, cheaply and
+// safely for concurrent use.
+type latencyHistogram struct {
+	buckets [latencyBuckets]uint64
+	max     int64
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	i := 0
+	for us := d / time.Microsecond; us > 1<<uint(i) && i < latencyBuckets-1; {
+		i++
+	}
+	atomic.AddUint64(&h.buckets[i], 1)
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&h.max, max, int64(d)) {
+			return
+		}
+	}
+}
+
+// since records the time elapsed since start.
+func (h *latencyHistogram) since(start time.Time) {
+	h.record(time.Since(start))
+}
+
+func (h *latencyHistogram) snapshot() Latency {
+	var counts [latencyBuckets]uint64
+	var l Latency
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+		l.Count += counts[i]
+	}
+	l.Max = time.Duration(atomic.LoadInt64(&h.max))
+	l.P50 = h.percentile(counts, l.Count, 50, l.Max)
+	l.P95 = h.percentile(counts, l.Count, 95, l.Max)
+	return l
+}
+
+func (h *latencyHistogram) percentile(counts [latencyBuckets]uint64, total uint64, p uint64, max time.Duration) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	threshold := (total*p + 99) / 100
+	var seen uint64
+	for i, count := range counts {
+		seen += count
+		if seen >= threshold && i < latencyBuckets-1 {
+			d := time.Duration(1<<uint(i)) * time.Microsecond
+			if d > max {
+				d = max
+			}
+			return d
+		}
+	}
+	return max
+}
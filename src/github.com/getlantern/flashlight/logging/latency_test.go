@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := &latencyHistogram{}
+	assert.Equal(t, Latency{}, h.snapshot())
+
+	for i := 0; i < 90; i++ {
+		h.record(3 * time.Microsecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.record(100 * time.Microsecond)
+	}
+	h.record(time.Hour)
+	l := h.snapshot()
+	assert.Equal(t, uint64(100), l.Count)
+	assert.Equal(t, 4*time.Microsecond, l.P50)
+	assert.Equal(t, 128*time.Microsecond, l.P95)
+	assert.Equal(t, time.Hour, l.Max)
+}
+
+func TestFileLatencies(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+
+	r := newSizeRotator(filepath.Join(dir, "test.log"))
+	r.RotationSize = 10
+	r.writeLatency = &latencyHistogram{}
+	r.rotationLatency = &latencyHistogram{}
+	defer r.Close()
+	for i := 0; i < 3; i++ {
+		r.Write([]byte("0000000000"))
+	}
+	writes := r.writeLatency.snapshot()
+	assert.Equal(t, uint64(3), writes.Count)
+	assert.True(t, writes.Max > 0, "should time writes")
+	assert.True(t, writes.P95 <= writes.Max)
+	rotations := r.rotationLatency.snapshot()
+	assert.Equal(t, uint64(2), rotations.Count)
+	assert.True(t, rotations.Max > 0, "should time rotations")
+}
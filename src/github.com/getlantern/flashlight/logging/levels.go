@@ -0,0 +1,215 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Severities as written by golog at the beginning of each line. golog itself
+// has no INFO level, but this package writes some INFO lines of its own.
+const (
+	levelTrace = "TRACE"
+	levelDebug = "DEBUG"
+	levelInfo  = "INFO"
+	levelError = "ERROR"
+	levelFatal = "FATAL"
+)
+
+var (
+	// levelRanks orders the levels from most to least verbose
+	levelRanks = map[string]int32{
+		levelTrace: 0,
+		levelDebug: 1,
+		levelInfo:  2,
+		levelError: 3,
+		levelFatal: 4,
+	}
+
+	// compactLevels are the single character levels written with
+	// Options.CompactFileLevels
+	compactLevels = map[string]byte{
+		levelTrace: 'T',
+		levelDebug: 'D',
+		levelInfo:  'I',
+		levelError: 'E',
+		levelFatal: 'F',
+	}
+
+	// expandedLevels maps compact levels back to the full ones
+	expandedLevels = map[byte]string{
+		'T': levelTrace,
+		'D': levelDebug,
+		'I': levelInfo,
+		'E': levelError,
+		'F': levelFatal,
+	}
+
+	// minLevel is the rank of the least severe level currently logged
+	minLevel int32
+
+	// defaultLevel is the rank of the level configured at Init, which SIGUSR1
+	// toggles back to
+	defaultLevel int32
+)
+
+// SetLevel changes the least severe level that gets logged to stdout, stderr
+// and the log file at runtime. Valid levels are TRACE, DEBUG, INFO, ERROR and
+// FATAL. TRACE lines are still only produced by golog when tracing is enabled.
+// Loggly keeps receiving errors regardless of the level.
+func SetLevel(level string) error {
+	rank, found := levelRanks[strings.ToUpper(level)]
+	if !found {
+		return fmt.Errorf("Unknown log level %v", level)
+	}
+	atomic.StoreInt32(&minLevel, rank)
+	return nil
+}
+
+// Level returns the least severe level currently being logged.
+func Level() string {
+	return levelForRank(atomic.LoadInt32(&minLevel))
+}
+
+func levelForRank(rank int32) string {
+	for level, r := range levelRanks {
+		if r == rank {
+			return level
+		}
+	}
+	return levelTrace
+}
+
+// levelEnabled tells whether lines at the given level are currently logged.
+// Lines with an unknown level are always logged.
+func levelEnabled(level string) bool {
+	rank, found := levelRanks[level]
+	return !found || rank >= atomic.LoadInt32(&minLevel)
+}
+
+// toggleDebug switches between the default level and DEBUG.
+func toggleDebug() {
+	def := levelForRank(atomic.LoadInt32(&defaultLevel))
+	if Level() == def {
+		SetLevel(levelDebug)
+		logInfo(fmt.Sprintf("Switched log level from %v to %v", def, levelDebug))
+	} else {
+		logInfo(fmt.Sprintf("Switching log level from %v to %v", Level(), def))
+		SetLevel(def)
+	}
+}
+
+// setDefaultLevel sets both the current and the default level.
+func setDefaultLevel(level string) error {
+	if err := SetLevel(level); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&defaultLevel, atomic.LoadInt32(&minLevel))
+	return nil
+}
+
+// logInfo writes an INFO line from this package to the debug stream.
+func logInfo(msg string) {
+	fmt.Fprintf(debugStream{}, "%s flashlight.logging: %s\n", levelInfo, msg)
+}
+
+// levelOf returns the golog severity at the beginning of the given line, or ""
+// if the line doesn't start with a known severity. Compact levels are
+// returned in full.
+func levelOf(p []byte) string {
+	i := bytes.IndexByte(p, ' ')
+	if i <= 0 {
+		return ""
+	}
+	if i == 1 {
+		return expandedLevels[p[0]]
+	}
+	// Return the constants so that the conversion doesn't allocate
+	switch string(p[:i]) {
+	case levelTrace:
+		return levelTrace
+	case levelDebug:
+		return levelDebug
+	case levelInfo:
+		return levelInfo
+	case levelError:
+		return levelError
+	case levelFatal:
+		return levelFatal
+	}
+	return ""
+}
+
+// isVerbose tells whether the given level is one of the chatty levels (TRACE
+// or DEBUG) that may be kept out of some outputs.
+func isVerbose(level string) bool {
+	return level == levelTrace || level == levelDebug
+}
+
+type levelFilter struct {
+	io.Writer
+	allow func(level string) bool
+}
+
+// filterLevels creates a writer that only passes lines to w whose level is
+// allowed by the given function. Lines that are filtered out are reported as
+// fully written. It relies on golog writing each line in whole.
+func filterLevels(w io.Writer, allow func(level string) bool) io.Writer {
+	return &levelFilter{w, allow}
+}
+
+func (w *levelFilter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *levelFilter) writeAt(p []byte, t time.Time) (int, error) {
+	if !w.allow(levelOf(p)) {
+		return len(p), nil
+	}
+	return writeTimed(w.Writer, p, t)
+}
+
+// parseLine splits a golog line of the form
+// "ERROR flashlight.foo: foo.go:12 message" into its level, logger name and
+// remaining message. The level may also be compact, like "E". Parts that can't be recognized are returned empty, with
+// the whole line (minus trailing whitespace) as the message.
+func parseLine(line string) (level string, logger string, message string) {
+	line = strings.TrimRight(line, "\r\n")
+	level = levelOf([]byte(line))
+	if level == "" {
+		return "", "", line
+	}
+	rest := line[strings.IndexByte(line, ' ')+1:]
+	i := strings.Index(rest, ": ")
+	if i <= 0 || strings.ContainsAny(rest[:i], " \t") {
+		return level, "", rest
+	}
+	return level, rest[:i], rest[i+2:]
+}
+
+// compactLevelWriter abbreviates the level at the beginning of each line
+// written to it to a single character before passing it on.
+type compactLevelWriter struct {
+	io.Writer
+}
+
+func (w *compactLevelWriter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *compactLevelWriter) writeAt(p []byte, t time.Time) (int, error) {
+	level := levelOf(p)
+	if len(level) <= 1 {
+		return writeTimed(w.Writer, p, t)
+	}
+	compact := make([]byte, 0, len(p)-len(level)+1)
+	compact = append(compact, compactLevels[level])
+	compact = append(compact, p[len(level):]...)
+	if _, err := writeTimed(w.Writer, compact, t); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
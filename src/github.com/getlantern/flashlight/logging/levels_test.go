@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelOf(t *testing.T) {
+	assert.Equal(t, "DEBUG", levelOf([]byte("DEBUG flashlight: a.go:1 hello\n")))
+	assert.Equal(t, "ERROR", levelOf([]byte("ERROR flashlight: a.go:1 hello\n")))
+	assert.Equal(t, "", levelOf([]byte("INFOS flashlight: a.go:1 hello\n")))
+	assert.Equal(t, "", levelOf([]byte("DEBUG")))
+	assert.Equal(t, "", levelOf(nil))
+}
+
+func TestFilterLevels(t *testing.T) {
+	var buf bytes.Buffer
+	w := filterLevels(&buf, func(level string) bool {
+		return !isVerbose(level)
+	})
+	for _, line := range []string{
+		"DEBUG test: a.go:1 debug\n",
+		"TRACE test: a.go:1 trace\n",
+		"ERROR test: a.go:1 error\n",
+		"unknown\n",
+	} {
+		n, err := w.Write([]byte(line))
+		assert.NoError(t, err)
+		assert.Equal(t, len(line), n, "filtered lines should be reported as written")
+	}
+	assert.Equal(t, "ERROR test: a.go:1 error\nunknown\n", buf.String())
+}
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel(levelTrace)
+
+	assert.Error(t, SetLevel("VERBOSE"))
+	assert.NoError(t, SetLevel("error"))
+	assert.Equal(t, levelError, Level())
+	assert.False(t, levelEnabled(levelDebug))
+	assert.False(t, levelEnabled(levelInfo))
+	assert.True(t, levelEnabled(levelError))
+	assert.True(t, levelEnabled(levelFatal))
+	assert.True(t, levelEnabled(""), "unknown levels should always be logged")
+}
+
+func TestToggleDebug(t *testing.T) {
+	defer setDefaultLevel(levelTrace)
+
+	setDefaultLevel(levelError)
+	toggleDebug()
+	assert.Equal(t, levelDebug, Level())
+	toggleDebug()
+	assert.Equal(t, levelError, Level())
+}
+
+func TestCompactLevels(t *testing.T) {
+	var buf bytes.Buffer
+	w := &compactLevelWriter{&buf}
+	line := "DEBUG flashlight: a.go:1 hello\n"
+	n, err := w.Write([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n)
+	w.Write([]byte("ERROR flashlight: a.go:2 failed\n"))
+	w.Write([]byte("not from golog\n"))
+	assert.Equal(t, "D flashlight: a.go:1 hello\nE flashlight: a.go:2 failed\nnot from golog\n", buf.String())
+
+	assert.Equal(t, "ERROR", levelOf([]byte("E flashlight: a.go:2 failed\n")), "should understand compact levels")
+	assert.Equal(t, "", levelOf([]byte("X flashlight: a.go:2 failed\n")))
+	level, logger, message := parseLine("I flashlight.logging: started\n")
+	assert.Equal(t, "INFO", level)
+	assert.Equal(t, "flashlight.logging", logger)
+	assert.Equal(t, "started", message)
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// lifecycleStarted is set once the started event was emitted since Init
+	lifecycleStarted int32
+)
+
+// logStarted emits the started lifecycle event if Options.LifecycleEvents is
+// set and it wasn't emitted since Init yet.
+func logStarted() {
+	if !currentOptions().LifecycleEvents || !atomic.CompareAndSwapInt32(&lifecycleStarted, 0, 1) {
+		return
+	}
+	logLifecycle("lantern logging started")
+}
+
+// logStopped emits the stopped lifecycle event with the uptime if
+// Options.LifecycleEvents is set, and flushes it to Loggly.
+func logStopped() {
+	if !currentOptions().LifecycleEvents {
+		return
+	}
+	logLifecycle(fmt.Sprintf("lantern logging stopped, uptime=%v", time.Since(startTime)/time.Second*time.Second))
+	if b := logglyBatch.Load().(*batchingSender); b != nil {
+		b.Flush()
+	}
+}
+
+// logLifecycle writes an INFO line with the instance id and version to the
+// debug stream and to Loggly if it's active.
+func logLifecycle(msg string) {
+	line := []byte(lifecycleLine(msg, instanceIdValue.Load().(string), appVersion.Load().(string)))
+	if _, out := localOutputs(); out != nil {
+		out.Write(line)
+	}
+	if lw := activeLoggly(); lw != nil {
+		lw.Write(line)
+	}
+}
+
+func lifecycleLine(msg string, instanceId string, version string) string {
+	return fmt.Sprintf("%s flashlight.logging: %s%s\n", levelInfo, msg,
+		formatFields(map[string]string{"instanceId": instanceId, "version": version}))
+}
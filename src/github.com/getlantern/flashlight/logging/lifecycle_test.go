@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleLine(t *testing.T) {
+	line := lifecycleLine("lantern logging started", "abc123", "2.0.0")
+	assert.Equal(t, "INFO flashlight.logging: lantern logging started {instanceId=abc123 version=2.0.0}\n", line)
+	assert.Equal(t, levelInfo, levelOf([]byte(line)))
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	origOut := debugOut
+	var buf bytes.Buffer
+	debugOut = &buf
+	options = &Options{LifecycleEvents: true}
+	instanceIdValue.Store("abc123")
+	appVersion.Store("2.0.0")
+	defer func() {
+		debugOut = origOut
+		options = &Options{}
+		instanceIdValue.Store("")
+		appVersion.Store("")
+		removeLoggly()
+	}()
+
+	sender := newFakeSender()
+	batch := newBatchingSender(sender, logglyBatchSize, defaultLogglyMaxInFlight, time.Hour)
+	addLoggly(&logglyErrorWriter{client: batch})
+	setLogglyBatch(batch)
+
+	logStarted()
+	logStarted()
+	assert.Equal(t, 1, strings.Count(buf.String(), "lantern logging started {instanceId=abc123 version=2.0.0}"),
+		"should only emit the started event once")
+
+	logStopped()
+	assert.Contains(t, buf.String(), "lantern logging stopped, uptime=")
+	sent := sender.sent()
+	if assert.Len(t, sent, 2, "both events should have been flushed to Loggly") {
+		assert.Contains(t, sent[0]["fullMessage"], "lantern logging started")
+		assert.Contains(t, sent[1]["fullMessage"], "lantern logging stopped")
+		assert.Equal(t, "abc123", sent[1]["extra"].(map[string]string)["instanceId"], "should include the fields")
+	}
+
+	buf.Reset()
+	options = &Options{}
+	logStopped()
+	assert.Equal(t, "", buf.String(), "shouldn't emit events unless enabled")
+}
@@ -3,10 +3,16 @@ package logging
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/getlantern/appdir"
@@ -15,58 +21,942 @@ import (
 	"github.com/getlantern/go-loggly"
 	"github.com/getlantern/golog"
 	"github.com/getlantern/jibber_jabber"
-	"github.com/getlantern/rotator"
-	"github.com/getlantern/wfilter"
+	"github.com/getlantern/keyman"
 )
 
 const (
 	logTimestampFormat = "Jan 02 15:04:05.000"
+	logFileName        = "lantern.log"
+	ndjsonFileName     = "lantern.ndjson"
 )
 
 var (
 	log = golog.LoggerFor("flashlight.logging")
 
-	logFile *rotator.SizeRotator
+	logFile *sizeRotator
+
+	// logglyDebugFile receives Loggly messages if Options.LogglyDebug is set
+	logglyDebugFile *sizeRotator
+
+	// ndjsonFile is the machine readable copy of the log file written with
+	// Options.NDJSONFile
+	ndjsonFile *sizeRotator
+
+	// journal is the journald writer if Options.Journald is enabled
+	journal io.WriteCloser
+
+	// socketOut is the writer for Options.UnixSocket
+	socketOut io.WriteCloser
+
+	// logglyFilter holds the logglyFilterBox set by SetLogglyFilter
+	logglyFilter atomic.Value
+
+	// logglyGrouper holds the logglyGrouperBox set by SetLogglyGrouper
+	logglyGrouper atomic.Value
+
+	// logDir is the directory containing the log files
+	logDir string
 
 	// logglyToken is populated at build time by crosscompile.bash. During
 	// development time, logglyToken will be empty and we won't log to Loggly.
 	logglyToken string
 
-	errorOut io.Writer
-	debugOut io.Writer
+	// errorOut and debugOut are the local outputs for golog's error and debug
+	// streams, defaulting to golog's own until Init
+	errorOut io.Writer = os.Stderr
+	debugOut io.Writer = os.Stdout
+
+	// lastAddr is the proxy address Loggly was last set up with and
+	// lastDebugOnly whether it was only writing to loggly-debug.log, guarded
+	// by proxyMutex
+	lastAddr      string
+	lastDebugOnly bool
+
+	// startTime is when logging was initialized, used to report uptime
+	startTime = time.Now()
+
+	// options are the Options logging was last initialized with
+	options = &Options{}
+
+	// configMutex guards options, logDir, logFile, logglyDebugFile,
+	// errorOut, debugOut, ordered and fileThrottle, which Reconfigure replaces
+	// while lines are being logged. Outside of initializing, they're read
+	// through currentOptions, currentLogDir, currentLogFile,
+	// currentLogglyDebugFile, localOutputs, currentOrdered and
+	// currentFileThrottle.
+	configMutex sync.RWMutex
+
+	// proxyAddr and proxyCA are the proxy settings last passed to Configure,
+	// used to reach remote logging services, unless proxyClient was given
+	// through ConfigureWithHTTPClient
+	proxyAddr   string
+	proxyCA     string
+	proxyClient *http.Client
+	// exitCountry is the country of the current exit proxy, see
+	// SetExitCountry
+	exitCountry string
+	proxyMutex  sync.RWMutex
+)
+
+func init() {
+	logglyFilter.Store(logglyFilterBox{})
+	logglyGrouper.Store(logglyGrouperBox{})
+}
+
+// Options customizes how logging is set up by InitWithOptions. The zero value
+// gives the default behavior.
+type Options struct {
+	// DebugToStdoutOnly keeps DEBUG and TRACE lines out of the log file while
+	// still printing them to stdout, which is handy during development. ERROR
+	// lines always reach the file regardless.
+	DebugToStdoutOnly bool
+
+	// HeartbeatInterval, if positive, makes logging emit a periodic INFO line
+	// with the uptime and the Stats() counters as a liveness signal.
+	HeartbeatInterval time.Duration
+
+	// HeartbeatToLoggly also sends the heartbeat line to Loggly while Loggly
+	// is active.
+	HeartbeatToLoggly bool
+
+	// HeartbeatRuntimeStats adds the number of goroutines and the heap size
+	// and number of GCs from runtime.MemStats to the heartbeat line, to follow
+	// resource usage over time.
+	HeartbeatRuntimeStats bool
+
+	// LifecycleEvents emits an INFO line with the instance id and version
+	// when Configure is first called after Init ("lantern logging started")
+	// and on Close ("lantern logging stopped" with the uptime). The lines also
+	// go to Loggly while it's active, and Close flushes the last one before
+	// returning.
+	LifecycleEvents bool
+
+	// LogglyMaxMessageSize, if positive, caps the size in bytes of the
+	// fullMessage sent to Loggly. Longer messages are handled according to
+	// LogglyOversizePolicy.
+	LogglyMaxMessageSize int
+
+	// LogglyOversizePolicy determines whether messages exceeding
+	// LogglyMaxMessageSize are truncated (the default) or split.
+	LogglyOversizePolicy OversizePolicy
+
+	// ErrorHistorySize is the number of recent errors kept in memory for
+	// RecentErrors. Defaults to 50.
+	ErrorHistorySize int
+
+	// Level is the least severe level logged to stdout, stderr and the log
+	// file, one of TRACE, DEBUG, INFO, ERROR or FATAL. Defaults to TRACE. It
+	// can be changed later with SetLevel.
+	Level string
+
+	// CompressRotated gzips log files as they get rotated out.
+	CompressRotated bool
+
+	// CompressLevel, if set, is the gzip level used for CompressRotated, from
+	// gzip.NoCompression to gzip.BestCompression, or gzip.DefaultCompression.
+	// Defaults to gzip.DefaultCompression. Invalid levels are clamped to the
+	// valid range.
+	CompressLevel *int
+
+	// LogglyTimestamp determines whether messages sent to Loggly include the
+	// same kind of timestamp prefix as the log file. By default they don't and
+	// rely on Loggly's own timestamp. This applies identically on all
+	// platforms.
+	LogglyTimestamp LogglyTimestampMode
+
+	// LanguageProvider, if set, is used instead of guessing the OS language
+	// with jibber_jabber to populate the language field sent to Loggly. This
+	// allows the app to report the UI language the user actually selected.
+	LanguageProvider func() (string, error)
+
+	// Format is the format of the log file. Stdout and stderr always use
+	// FormatText.
+	Format Format
+
+	// FileBytesPerSecond, if positive, limits the rate at which the log file
+	// is written. Lines over the limit are buffered briefly and, if the buffer
+	// fills up, the oldest TRACE and DEBUG lines are dropped. Errors are never
+	// dropped. Stdout and stderr are not limited.
+	FileBytesPerSecond int
+
+	// FileThrottleBuffer is how many bytes may be buffered when exceeding
+	// FileBytesPerSecond. Defaults to FileBytesPerSecond.
+	FileThrottleBuffer int
+
+	// RecentLogsSize is the number of recent lines kept in memory for
+	// RecentLogs. Defaults to 200.
+	RecentLogsSize int
+
+	// MaxBufferBytes, if positive, bounds the size of the lines kept in
+	// memory by RecentLogs, RecentErrors and CaptureScope combined. When
+	// exceeded, the oldest recent lines are evicted first, then the oldest
+	// errors and only then the oldest captured lines.
+	MaxBufferBytes int64
+
+	// FileBufferSize, if positive, buffers writes to the log file in memory
+	// rather than writing each line out immediately. Buffered lines are
+	// written out every FlushInterval, on Flush and on Close, so a hard kill
+	// may lose up to FlushInterval worth of lines.
+	FileBufferSize int
+
+	// FlushInterval is how often buffered lines are written out when
+	// FileBufferSize or LiveCompress is set. Defaults to 2 seconds.
+	FlushInterval time.Duration
+
+	// InstanceIdInFile includes the instance id passed to Configure in each
+	// line of the log file (as a field in FormatJSON), which tells instances
+	// apart when log files get aggregated.
+	InstanceIdInFile bool
+
+	// Denylist drops lines containing any of these substrings before they
+	// reach any output, including the log file and Loggly. This is meant for
+	// known benign but frequent messages.
+	Denylist []string
+
+	// FilterInclude, if set, only lets lines matching it through to any
+	// output.
+	FilterInclude *regexp.Regexp
+
+	// FilterExclude drops lines matching it from all outputs. It wins over
+	// FilterInclude. Use SetFilters to set both from patterns at runtime.
+	FilterExclude *regexp.Regexp
+
+	// Journald also sends all lines to journald on Linux, with the level and
+	// logger as LANTERN_LEVEL and LANTERN_LOGGER fields. If journald isn't
+	// running, lines only go to the usual outputs.
+	Journald bool
+
+	// LogglyDebug is a debug mode that writes the exact JSON of each message
+	// sent to Loggly to loggly-debug.log in the logs directory, to check
+	// what's sent without access to Loggly. Off by default.
+	LogglyDebug LogglyDebugMode
+
+	// MaxRotationSize, if greater than the default rotation size of 1 MB,
+	// lets the log file grow up to this size before rotating when it fills up
+	// quickly, so that busy hosts keep a longer history in fewer files. The
+	// size shrinks back as the write rate goes down. See
+	// Statistics.FileRotationSize.
+	MaxRotationSize int64
+
+	// PauseBufferSize is how many bytes of lines logged while paused (see
+	// Pause) are held back and written out on Resume. By default, they're all
+	// discarded.
+	PauseBufferSize int
+
+	// PauseBypassErrors keeps logging errors while paused.
+	PauseBypassErrors bool
+
+	// OrderedOutput guarantees that all outputs receive lines in the same
+	// order, which helps correlating the log file with Loggly, by writing all
+	// lines from a single goroutine. This costs some throughput and lines are
+	// written out asynchronously, until Close.
+	OrderedOutput bool
+
+	// GoroutineIds adds the id of the goroutine that logged each line after
+	// its location, like [g=42], to help debugging concurrency. Getting the
+	// id takes a stack trace for every line, so it's meant for debugging
+	// only.
+	GoroutineIds bool
+
+	// UnixSocket is the path of a Unix domain socket, e.g. of a local log
+	// collector, to also send all lines to. The connection is reestablished
+	// as needed, holding back lines while disconnected. Not supported on
+	// Windows.
+	UnixSocket string
+
+	// SampleRates keeps only the given fraction, between 0 and 1, of the
+	// lines from loggers starting with each prefix in the log file, e.g.
+	// {"flashlight.proxy": 0.1} keeps about 10% of flashlight.proxy's lines.
+	// The longest matching prefix wins and lines from other loggers are all
+	// kept. Identical lines are consistently kept or dropped. They can be
+	// replaced at runtime with SetSamplingFromConfig. See
+	// Statistics.SampledLines.
+	SampleRates map[string]float64
+
+	// SampleLoggly also applies SampleRates to Loggly.
+	SampleLoggly bool
+
+	// RateLimits caps the number of lines per second written to the log file
+	// for each of the given levels, which may be TRACE, DEBUG or INFO, e.g.
+	// {"DEBUG": 100}. Bursts of up to a second's worth of lines are allowed.
+	// ERROR and FATAL lines are never limited, and neither is Loggly, which
+	// only gets those. See Statistics.RateLimitedLines.
+	RateLimits map[string]float64
+
+	// ProxyAddrInLoggly includes the proxy address passed to Configure as the
+	// proxy field of messages sent to Loggly, to correlate errors with the
+	// proxy in use.
+	ProxyAddrInLoggly bool
+
+	// ProxyAddrInFile includes the proxy address passed to Configure in each
+	// line of the log file (as a field in FormatJSON).
+	ProxyAddrInFile bool
+
+	// RedactProxyAddr replaces the host of the proxy address with a hash of it
+	// wherever it's included.
+	RedactProxyAddr bool
+
+	// MaxAge, if positive, deletes rotated log files once they're older than
+	// this, regardless of how many there are. This is checked hourly and on
+	// each rotation. The current log file is never deleted.
+	MaxAge time.Duration
+
+	// LogglyMaxGroups, if positive, caps the number of distinct messages
+	// (which Loggly groups by) sent to Loggly. Beyond that, messages not seen
+	// before are sent as "other", keeping the fullMessage intact. Seen
+	// messages are forgotten every LogglyGroupResetInterval. See
+	// Statistics.LogglyGroups.
+	LogglyMaxGroups int
+
+	// LogglyGroupResetInterval is how often the messages counted towards
+	// LogglyMaxGroups are forgotten. Defaults to 1 hour.
+	LogglyGroupResetInterval time.Duration
+
+	// LogglyGroup determines the message field of Loggly messages, which
+	// Loggly groups them by.
+	LogglyGroup LogglyGroupMode
+
+	// LogglyContextLines is how many of the lines logged before each error
+	// are sent along with it to Loggly, as the context field, to show what led
+	// to it. They're capped to 2 KB in total. Defaults to 5, negative values
+	// disable it.
+	LogglyContextLines int
+
+	// AllToStdout prints errors to stdout along with everything else rather
+	// than to stderr, so that captured console output, e.g. on CI, keeps lines
+	// in order. The log file and Loggly are unaffected.
+	AllToStdout bool
+
+	// LogglyMultiline determines how messages spanning several lines, like
+	// stack traces, are sent to Loggly.
+	LogglyMultiline MultilinePolicy
+
+	// LogglyTags are Loggly tags added to all messages. Tags may only contain
+	// letters, digits, dots, dashes and underscores, others are left out.
+	LogglyTags []string
+
+	// LogglyLineTags also tags each message sent to Loggly with its level and
+	// logger, like "error" and "flashlight.proxy", as its tags field.
+	LogglyLineTags bool
+
+	// LogglyUptime adds the number of seconds since Init to each message
+	// sent to Loggly, as extra.uptimeSeconds, to see whether errors cluster
+	// at startup.
+	LogglyUptime bool
+
+	// FileHeader writes a line starting with # with the process id, start
+	// time and version at the start of each log file, so that rotated files
+	// can be told apart when shipped on their own.
+	FileHeader bool
+
+	// LogglyDuplicateWindow, if positive, only sends the first of identical
+	// messages, like the same stack trace in a crash loop, to Loggly within
+	// each window. The next one sent after it carries the number suppressed
+	// as the suppressedDuplicates extra field.
+	LogglyDuplicateWindow time.Duration
+
+	// LogglyDuplicateScope determines which part of messages is compared for
+	// LogglyDuplicateWindow.
+	LogglyDuplicateScope DuplicateScope
+
+	// FileDuplicateWindow, if positive, only writes the first of identical
+	// lines to the log file within each window. The next one written after it
+	// ends with "(repeated N times)". The count carries on across rotations.
+	FileDuplicateWindow time.Duration
+
+	// LogDir, if set, is where logs are placed instead of the Lantern logs
+	// directory, like /var/log/lantern for server installs. It must be
+	// absolute, though it may start with ~ for the home directory.
+	LogDir string
+
+	// FileOpener, if set, opens log files instead of creating them in the
+	// logs directory, which then isn't created, e.g. for tests to log to
+	// memory. Rotated files are still looked for on disk.
+	FileOpener func(path string) (io.WriteCloser, error)
+
+	// DisableTimestamp leaves out the timestamp prefix from lines printed to
+	// stdout and stderr, for environments like container platforms and
+	// journald that timestamp captured lines themselves.
+	DisableTimestamp bool
+
+	// DisableFileTimestamp also leaves it out of the log file when using
+	// FormatText. Other formats always include the time.
+	DisableFileTimestamp bool
+
+	// LogglyMaxInFlight caps the number of requests to Loggly in flight at
+	// once, so that bursts of errors don't take up the proxy's connections.
+	// Messages beyond that stay queued for the next batch. Defaults to 4.
+	LogglyMaxInFlight int
+
+	// StrictLogDir fails Init if the logs directory can't be written to,
+	// rather than falling back to Lantern/logs in the temp directory.
+	StrictLogDir bool
+
+	// CompactFileLevels abbreviates levels to a single character, like E for
+	// ERROR, in the log file when using FormatText to save space. Other
+	// outputs, including Loggly, keep the full levels.
+	CompactFileLevels bool
+
+	// MaxLogFiles, if positive, limits the number of log files kept open at
+	// once, counting the log file, loggly-debug.log, lantern.ndjson and named
+	// logs, so that misconfiguration doesn't exhaust file descriptors on
+	// constrained systems. RegisterNamedLog fails beyond it. See
+	// Statistics.OpenLogFiles.
+	MaxLogFiles int
+
+	// NDJSONFile also writes the lines of the log file to lantern.ndjson as
+	// JSON objects, one per line, like with FormatJSON, for machine
+	// ingestion. It's rotated like the log file but isn't buffered or
+	// compressed live.
+	NDJSONFile bool
+
+	// CRLF ends lines in the log file with CRLF rather than LF, for tools like
+	// Notepad on Windows. Other outputs keep LF.
+	CRLF bool
+
+	// LiveCompress writes the log file itself gzip compressed, as
+	// lantern.log.gz, rather than only compressing rotated files, for very
+	// constrained storage. The rotation size then applies to the compressed
+	// size. Compressed lines are only written out every FlushInterval, on
+	// Flush and on Close, so a hard kill may lose up to FlushInterval worth
+	// of lines.
+	LiveCompress bool
+
+	// Rotation determines how the log file is rotated, by size by default.
+	Rotation RotationPolicy
+
+	// RotatedKeepExtension names files rotated by size like lantern.1.log
+	// (lantern.1.log.gz when compressed) rather than lantern.log.1, so that
+	// log shippers watching *.log pick them up. Files rotated by date already
+	// keep the extension. Rotated files named the other way are left alone.
+	RotatedKeepExtension bool
+
+	// RotatedChecksums writes a sidecar next to each rotated log file, like
+	// lantern.log.1.gz.meta, with the number of lines in the file and the
+	// SHA-256 of the file as stored (after any compression), so that it can
+	// be checked with VerifyLogFile before shipping it.
+	RotatedChecksums bool
+
+	// FatalExitCode is the exit code used by Fatalf. Defaults to 1.
+	FatalExitCode int
+}
+
+// LogglyTimestampMode determines whether and how the fullMessage sent to
+// Loggly is prefixed with a timestamp. The prefix never affects how messages
+// are grouped in Loggly.
+type LogglyTimestampMode int
+
+const (
+	// LogglyNoTimestamp sends the raw golog line and relies on Loggly's own
+	// timestamp.
+	LogglyNoTimestamp LogglyTimestampMode = iota
+
+	// LogglyUTCTimestamp prefixes the line with a UTC timestamp just like the
+	// log file does.
+	LogglyUTCTimestamp
 
-	lastAddr string
+	// LogglyLocalTimestamp prefixes the line with a timestamp in local time,
+	// skipping the UTC conversion.
+	LogglyLocalTimestamp
 )
 
+// LogglyGroupMode determines what's sent as the message field to Loggly,
+// which Loggly groups messages by. Either way, it's capped to 100 characters
+// and the whole line is sent as the fullMessage field.
+type LogglyGroupMode int
+
+const (
+	// LogglyGroupHeuristic uses the last two colon-separated parts of the
+	// line, which usually leaves out the varying details of wrapped errors.
+	LogglyGroupHeuristic LogglyGroupMode = iota
+
+	// LogglyGroupFullMessage uses the whole line.
+	LogglyGroupFullMessage
+
+	// LogglyGroupLoggerPrefix uses the level and logger, like
+	// "ERROR flashlight.proxy", grouping all errors from a logger together.
+	LogglyGroupLoggerPrefix
+)
+
+// MultilinePolicy determines how messages spanning several lines are sent to
+// Loggly.
+type MultilinePolicy int
+
+const (
+	// MultilineAsIs treats the whole message like a single line.
+	MultilineAsIs MultilinePolicy = iota
+
+	// MultilineCollapse joins the lines with " | " in the fullMessage, which
+	// keeps them on a single line in Loggly's views.
+	MultilineCollapse
+
+	// MultilineFirstLine groups messages by their first line only, still
+	// sending all lines in the fullMessage.
+	MultilineFirstLine
+)
+
+// collapseLines joins the lines of a message with " | ", keeping a trailing
+// newline.
+func collapseLines(message string) string {
+	trimmed := strings.TrimRight(message, "\n")
+	collapsed := strings.Replace(strings.Replace(trimmed, "\r\n", "\n", -1), "\n", " | ", -1)
+	return collapsed + message[len(trimmed):]
+}
+
+// LogglyDebugMode determines whether Loggly messages are also written to a
+// local debug file.
+type LogglyDebugMode int
+
+const (
+	// LogglyDebugOff only sends messages to Loggly.
+	LogglyDebugOff LogglyDebugMode = iota
+
+	// LogglyDebugAlso writes messages to the debug file and sends them to
+	// Loggly.
+	LogglyDebugAlso
+
+	// LogglyDebugOnly writes messages to the debug file instead of sending
+	// them, which works without a Loggly token or proxy.
+	LogglyDebugOnly
+)
+
+// resolveLogDir determines the logs directory from Options.LogDir, defaulting
+// to the Lantern logs directory.
+func resolveLogDir(dir string) (string, error) {
+	if dir == "" {
+		return appdir.Logs("Lantern"), nil
+	}
+	if dir == "~" || strings.HasPrefix(dir, "~/") || strings.HasPrefix(dir, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("Unable to expand ~ in logdir %v: %v", dir, err)
+		}
+		dir = filepath.Join(home, dir[1:])
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("Logdir %v is not absolute", dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// logDirWithFallback creates dir if needed and checks that it's writable. If
+// it isn't, it falls back to Lantern/logs in the temp directory unless strict
+// is set, returning the reason along with the fallback. It returns an empty
+// directory if neither can be used.
+func logDirWithFallback(dir string, strict bool) (string, error) {
+	err := prepareLogDir(dir)
+	if err == nil {
+		return dir, nil
+	}
+	if strict {
+		return "", err
+	}
+	fallback := filepath.Join(os.TempDir(), "Lantern", "logs")
+	if fallbackErr := prepareLogDir(fallback); fallbackErr != nil {
+		return "", err
+	}
+	return fallback, err
+}
+
+// prepareLogDir creates dir if needed and checks that files can be created in
+// it.
+func prepareLogDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Unable to create logdir at %s: %s", dir, err)
+	}
+	f, err := ioutil.TempFile(dir, ".writable")
+	if err != nil {
+		return fmt.Errorf("Unable to write to logdir at %s: %s", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// newLogFile creates a rotator for the given file in the given logs
+// directory, opening it with Options.FileOpener if set.
+func newLogFile(dir string, filename string) *sizeRotator {
+	r := newSizeRotator(filepath.Join(dir, filename))
+	if opener := currentOptions().FileOpener; opener != nil {
+		r.open = opener
+	}
+	return r
+}
+
+// currentOptions returns the Options logging was last initialized with.
+func currentOptions() *Options {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return options
+}
+
+// currentLogDir returns the directory containing the log files, "" before
+// Init.
+func currentLogDir() string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return logDir
+}
+
+// currentLogFile returns the rotator of the log file, nil before Init.
+func currentLogFile() *sizeRotator {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return logFile
+}
+
+// localOutputs returns the local outputs for the error and debug streams,
+// golog's own until Init.
+func localOutputs() (io.Writer, io.Writer) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return errorOut, debugOut
+}
+
+// currentOrdered returns the orderedOutput, nil unless Options.OrderedOutput
+// is set.
+func currentOrdered() *orderedOutput {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return ordered
+}
+
+// currentFileThrottle returns the throttle of the log file, nil unless
+// Options.FileBytesPerSecond is set.
+func currentFileThrottle() *throttledWriter {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return fileThrottle
+}
+
+// currentLogglyDebugFile returns the rotator of loggly-debug.log, nil unless
+// Options.LogglyDebug is set.
+func currentLogglyDebugFile() *sizeRotator {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return logglyDebugFile
+}
+
+// LogFilePath returns the path of the current log file, which is compressed
+// with Options.LiveCompress, or "" if logging isn't initialized. Its
+// directory may be the fallback rather than the Lantern logs directory (see
+// Options.StrictLogDir).
+func LogFilePath() string {
+	dir := currentLogDir()
+	if dir == "" {
+		return ""
+	}
+	if f := currentLogFile(); f != nil {
+		return f.currentPath()
+	}
+	return filepath.Join(dir, logFileName)
+}
+
+// Init sets up logging with the default Options.
 func Init() error {
-	logdir := appdir.Logs("Lantern")
-	log.Debugf("Placing logs in %v", logdir)
-	if _, err := os.Stat(logdir); err != nil {
-		if os.IsNotExist(err) {
-			// Create log dir
-			if err := os.MkdirAll(logdir, 0755); err != nil {
-				return fmt.Errorf("Unable to create logdir at %s: %s", logdir, err)
-			}
+	return InitWithOptions(&Options{})
+}
+
+// InitWithOptions sets up logging to stdout/stderr and to a rotated log file
+// in the Lantern logs directory, customized by the given Options.
+func InitWithOptions(opts *Options) error {
+	return initialize(opts, false)
+}
+
+// initialize sets up logging for InitWithOptions, keeping the remote outputs
+// if withRemotes is set.
+func initialize(opts *Options, withRemotes bool) error {
+	if err := validateOptions(opts); err != nil {
+		return err
+	}
+	startTime = time.Now()
+	configMutex.Lock()
+	options = opts
+	configMutex.Unlock()
+	atomic.StoreInt32(&lifecycleStarted, 0)
+	atomic.StoreInt32(&environmentLogged, 0)
+	fileInstanceId.Store("")
+	fileProxyAddr.Store("")
+	level := opts.Level
+	if level == "" {
+		level = levelTrace
+	}
+	if err := setDefaultLevel(level); err != nil {
+		return err
+	}
+	logdir, err := resolveLogDir(opts.LogDir)
+	if err != nil {
+		return err
+	}
+	primaryLogdir := logdir
+	var logdirErr error
+	if opts.FileOpener == nil {
+		logdir, logdirErr = logDirWithFallback(logdir, opts.StrictLogDir)
+		if logdir == "" {
+			return logdirErr
 		}
 	}
-	logFile = rotator.NewSizeRotator(filepath.Join(logdir, "lantern.log"))
+	log.Debugf("Placing logs in %v", logdir)
+	rotator := newLogFile(logdir, logFileName)
 	// Set log files to 1 MB
-	logFile.RotationSize = 1 * 1024 * 1024
+	rotator.RotationSize = 1 * 1024 * 1024
 	// Keep up to 20 log files
-	logFile.MaxRotation = 20
+	rotator.MaxRotation = 20
+	rotator.Compress = opts.CompressRotated
+	rotator.CompressLevel = validCompressLevel(opts.CompressLevel)
+	rotator.BufferSize = opts.FileBufferSize
+	rotator.LiveCompress = opts.LiveCompress
+	rotator.Dated = opts.Rotation == RotateByDateAndSize
+	rotator.KeepExtension = opts.RotatedKeepExtension
+	rotator.Checksums = opts.RotatedChecksums
+	rotator.MaxRotationSize = opts.MaxRotationSize
+	rotator.OnRotate = rotated
+	rotator.MaxAge = opts.MaxAge
+	rotator.writeLatency = fileWriteLatency
+	rotator.rotationLatency = rotationLatency
+	if opts.FileHeader {
+		rotator.Header = fileHeader
+		if opts.CRLF {
+			rotator.Header = func() string {
+				return string(toCRLF([]byte(fileHeader())))
+			}
+		}
+	}
+	var debugLog *sizeRotator
+	if opts.LogglyDebug != LogglyDebugOff {
+		debugLog = newLogFile(logdir, "loggly-debug.log")
+	}
+	// Only swap in the new log files once they're set up
+	configMutex.Lock()
+	logDir, logFile, logglyDebugFile = logdir, rotator, debugLog
+	configMutex.Unlock()
+	if opts.NDJSONFile {
+		ndjsonFile = newLogFile(logdir, ndjsonFileName)
+		ndjsonFile.RotationSize = rotator.RotationSize
+		ndjsonFile.MaxRotation = rotator.MaxRotation
+		ndjsonFile.Compress = rotator.Compress
+		ndjsonFile.CompressLevel = rotator.CompressLevel
+		ndjsonFile.Dated = rotator.Dated
+		ndjsonFile.KeepExtension = rotator.KeepExtension
+		ndjsonFile.Checksums = rotator.Checksums
+		ndjsonFile.MaxRotationSize = rotator.MaxRotationSize
+		ndjsonFile.MaxAge = rotator.MaxAge
+	}
 
 	// Loggly has its own timestamp so don't bother adding it in message,
 	// moreover, golog always write each line in whole, so we need not to care about line breaks.
-	errorOut = timestamped(NonStopWriter(os.Stderr, logFile))
-	debugOut = timestamped(NonStopWriter(os.Stdout, logFile))
-	golog.SetOutputs(errorOut, debugOut)
+	// Each output is formatted separately so that the file can use its own
+	// format and filters see whole lines. Both streams share the same file
+	// output, so serialize access to it.
+	var file io.Writer = rotator
+	if opts.CRLF {
+		file = &crlfWriter{rotator}
+	}
+	formattedFile := formatted(file, opts.Format)
+	if opts.Format == FormatText && opts.DisableFileTimestamp {
+		formattedFile = textFormatted(file, false)
+	}
+	if opts.Format == FormatText && opts.CompactFileLevels {
+		formattedFile = &compactLevelWriter{formattedFile}
+	}
+	if ndjsonFile != nil {
+		// Write both files under the same lock so that they have the same
+		// lines in the same order
+		formattedFile = NonStopWriter(formattedFile, formatted(ndjsonFile, FormatJSON))
+	}
+	var fileOut io.Writer = &lockedWriter{w: formattedFile}
+	fileOut = sample(fileOut, opts.SampleRates)
+	fileOut = rateLimit(fileOut, opts.RateLimits)
+	fileOut = dedupe(fileOut, opts.FileDuplicateWindow)
+	if opts.FileBytesPerSecond > 0 {
+		buffered := opts.FileThrottleBuffer
+		if buffered <= 0 {
+			buffered = opts.FileBytesPerSecond
+		}
+		t := throttle(fileOut, opts.FileBytesPerSecond, buffered)
+		configMutex.Lock()
+		fileThrottle = t
+		configMutex.Unlock()
+		fileOut = t
+	}
+	fileOut = gated(destFile, fileOut)
+	debugFile := fileOut
+	if opts.DebugToStdoutOnly {
+		debugFile = filterLevels(fileOut, func(level string) bool {
+			return !isVerbose(level)
+		})
+	}
+	stderr, stdout := consoleOutputs(os.Stderr, os.Stdout, opts.AllToStdout, !opts.DisableTimestamp)
+	if opts.AllToStdout {
+		stderr = gated(destStdout, stderr)
+	} else {
+		stderr = gated(destStderr, stderr)
+	}
+	stdout = gated(destStdout, stdout)
+	errorWriters := []io.Writer{stderr, fileOut}
+	debugWriters := []io.Writer{stdout, debugFile}
+	if opts.Journald {
+		j, err := newJournalWriter(journalSocket)
+		if err != nil {
+			log.Debugf("Not logging to journald: %v", err)
+		} else {
+			journal = j
+			gatedJournal := gated(destJournald, j)
+			errorWriters = append(errorWriters, gatedJournal)
+			debugWriters = append(debugWriters, gatedJournal)
+		}
+	}
+	if opts.UnixSocket != "" {
+		sw, err := newSocketWriter(opts.UnixSocket)
+		if err != nil {
+			log.Errorf("Not logging to socket %v: %v", opts.UnixSocket, err)
+		} else {
+			socketOut = sw
+			out := gated(destSocket, &lockedWriter{w: timestamped(sw)})
+			errorWriters = append(errorWriters, out)
+			debugWriters = append(debugWriters, out)
+		}
+	}
+	errOut := NonStopWriter(errorWriters...)
+	dbgOut := NonStopWriter(debugWriters...)
+	historySize := opts.ErrorHistorySize
+	if historySize <= 0 {
+		historySize = defaultErrorHistorySize
+	}
+	errorHistory.reset(historySize)
+	recentSize := opts.RecentLogsSize
+	if recentSize <= 0 {
+		recentSize = defaultRecentLogsSize
+	}
+	recentLogs.reset(recentSize)
+	atomic.StoreInt64(&bufferBudget, opts.MaxBufferBytes)
+	errOut = observeLines(captureLines(recordLines(errOut, recentLogs)))
+	dbgOut = observeLines(captureLines(recordLines(dbgOut, recentLogs)))
+	errOut = filterLevels(countLines(countByLogger(recordErrors(errOut, errorHistory)), &errorLines), levelEnabled)
+	dbgOut = filterLevels(countLines(dbgOut, &debugLines), levelEnabled)
+	configMutex.Lock()
+	errorOut, debugOut = errOut, dbgOut
+	oldOrdered := ordered
+	ordered = nil
+	configMutex.Unlock()
+	if oldOrdered != nil {
+		oldOrdered.stop()
+	}
+	if opts.OrderedOutput {
+		o := newOrderedOutput()
+		configMutex.Lock()
+		ordered = o
+		configMutex.Unlock()
+	}
+	denylist.Store(opts.Denylist)
+	filters.Store(&regexFilters{opts.FilterInclude, opts.FilterExclude})
+	if withRemotes {
+		applyRemotes()
+	} else {
+		setOutputs(errOut, dbgOut)
+	}
+	if logdirErr != nil {
+		log.Errorf("Placing logs in %v instead of %v: %v", logdir, primaryLogdir, logdirErr)
+	}
+
+	if opts.HeartbeatInterval > 0 {
+		startHeartbeat(debugStream{}, opts.HeartbeatInterval, opts.HeartbeatToLoggly, opts.HeartbeatRuntimeStats)
+	}
+	if opts.FileBufferSize > 0 || opts.LiveCompress {
+		interval := opts.FlushInterval
+		if interval <= 0 {
+			interval = defaultFlushInterval
+		}
+		startFlusher(rotator, interval)
+	}
+	if opts.MaxAge > 0 {
+		if ndjsonFile != nil {
+			ndjsonFile.Sweep()
+		}
+		rotator.Sweep()
+		startSweeper(rotator, sweepInterval)
+	}
 
 	return nil
 }
 
+// validateOptions checks the Options that InitWithOptions would otherwise
+// fail on.
+func validateOptions(opts *Options) error {
+	if _, found := levelRanks[strings.ToUpper(opts.Level)]; opts.Level != "" && !found {
+		return fmt.Errorf("Unknown log level %v", opts.Level)
+	}
+	if err := validateSampleRates(opts.SampleRates); err != nil {
+		return err
+	}
+	if err := validateRateLimits(opts.RateLimits); err != nil {
+		return err
+	}
+	_, err := resolveLogDir(opts.LogDir)
+	return err
+}
+
 func Configure(addr string, cloudConfigCA string, instanceId string,
 	version string, buildDate string) {
-	if logglyToken == "" {
+	ConfigureWithBuildInfo(addr, cloudConfigCA, instanceId, version, buildDate, BuildInfo{})
+}
+
+// ConfigureWithBuildInfo is like Configure but also includes the given build
+// metadata in every message sent to Loggly.
+func ConfigureWithBuildInfo(addr string, cloudConfigCA string, instanceId string,
+	version string, buildDate string, buildInfo BuildInfo) {
+	configure(addr, cloudConfigCA, nil, instanceId, version, buildDate, buildInfo)
+}
+
+// ConfigureWithHTTPClient is like ConfigureWithBuildInfo but sends to Loggly
+// (and other remote outputs) through the given, already proxied, HTTP client
+// rather than creating one. addr is the address of the proxy used by the
+// client, if known.
+func ConfigureWithHTTPClient(addr string, httpClient *http.Client, instanceId string,
+	version string, buildDate string, buildInfo BuildInfo) {
+	configure(addr, "", httpClient, instanceId, version, buildDate, buildInfo)
+}
+
+// ValidateConfig checks the configuration that would be passed to Configure,
+// returning an error if Loggly is to be used but the cloud config CA can't be
+// parsed, which would otherwise leave Loggly disabled with only an error
+// logged.
+func ValidateConfig(cloudConfigCA string) error {
+	if logglyToken == "" || cloudConfigCA == "" {
+		return nil
+	}
+	if _, err := keyman.LoadCertificateFromPEMBytes([]byte(cloudConfigCA)); err != nil {
+		return fmt.Errorf("Invalid cloud config CA, not sending error logs to Loggly: %v", err)
+	}
+	return nil
+}
+
+func configure(addr string, cloudConfigCA string, httpClient *http.Client, instanceId string,
+	version string, buildDate string, buildInfo BuildInfo) {
+	opts := currentOptions()
+	appVersion.Store(version)
+	buildDateValue.Store(buildDate)
+	logEnvironmentOnce()
+	proxyMutex.Lock()
+	proxyAddr, proxyCA, proxyClient = addr, cloudConfigCA, httpClient
+	proxyMutex.Unlock()
+	instanceIdValue.Store(instanceId)
+	if opts.InstanceIdInFile {
+		fileInstanceId.Store(instanceId)
+	}
+	if opts.ProxyAddrInFile {
+		fileProxyAddr.Store(proxyTag(addr, opts.RedactProxyAddr))
+	}
+	// Emit the started event once Loggly is enabled if it's going to be, so
+	// that it gets there too
+	enablingLoggly := false
+	defer func() {
+		if !enablingLoggly {
+			logStarted()
+		}
+	}()
+
+	if logglyToken == "" && opts.LogglyDebug != LogglyDebugOnly {
 		log.Debugf("No logglyToken, not sending error logs to Loggly")
 		return
 	}
@@ -81,83 +971,315 @@ func Configure(addr string, cloudConfigCA string, instanceId string,
 		return
 	}
 
-	if addr == lastAddr {
+	if httpClient == nil {
+		// Check the CA right away rather than only failing to create the
+		// client in the goroutine below
+		if err := ValidateConfig(cloudConfigCA); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	proxyMutex.RLock()
+	unchanged := httpClient == nil && addr == lastAddr
+	if opts.LogglyDebug == LogglyDebugOnly {
+		// The proxy isn't used, and may not be known yet
+		unchanged = lastDebugOnly
+	}
+	proxyMutex.RUnlock()
+	if unchanged {
 		log.Debug("Logging configuration unchanged")
 		return
 	}
 
 	// Using a goroutine because we'll be using waitforserver and at this time
 	// the proxy is not yet ready.
+	enablingLoggly = true
 	go func() {
-		lastAddr = addr
-		enableLoggly(addr, cloudConfigCA, instanceId, version, buildDate)
+		proxyMutex.Lock()
+		lastAddr, lastDebugOnly = addr, opts.LogglyDebug == LogglyDebugOnly
+		proxyMutex.Unlock()
+		enableLoggly(addr, cloudConfigCA, httpClient, instanceId, version, buildDate, buildInfo)
+		logStarted()
 	}()
 }
 
 func Close() error {
-	golog.ResetOutputs()
-	return logFile.Close()
+	logStopped()
+	endBoost()
+	stopHeartbeat()
+	stopFlusher()
+	stopSweeper()
+	// Write out the queued lines first, for the remotes to send them before
+	// stopping
+	drainQueues()
+	stopOTLP()
+	stopCloudWatch()
+	stopWebhook()
+	stopLogglyBatch()
+	resetGologOutputs()
+	configMutex.Lock()
+	o := ordered
+	ordered = nil
+	configMutex.Unlock()
+	if o != nil {
+		o.stop()
+	}
+	closeNamedLogs()
+	configMutex.Lock()
+	t := fileThrottle
+	fileThrottle = nil
+	configMutex.Unlock()
+	if t != nil {
+		t.stop()
+	}
+	if journal != nil {
+		journal.Close()
+		journal = nil
+	}
+	if socketOut != nil {
+		socketOut.Close()
+		socketOut = nil
+	}
+	configMutex.Lock()
+	debugFile := logglyDebugFile
+	logglyDebugFile = nil
+	configMutex.Unlock()
+	if debugFile != nil {
+		debugFile.Close()
+	}
+	if ndjsonFile != nil {
+		ndjsonFile.Close()
+		ndjsonFile = nil
+	}
+	f := currentLogFile()
+	if f == nil {
+		return ErrNotInitialized
+	}
+	return f.Close()
+}
+
+// consoleOutputs returns the console outputs for the error and debug streams,
+// both going to stdout if allToStdout is set. Lines are timestamped if
+// timestamp is set.
+func consoleOutputs(stderr io.Writer, stdout io.Writer, allToStdout bool, timestamp bool) (io.Writer, io.Writer) {
+	if timestamp {
+		stderr, stdout = timestamped(stderr), timestamped(stdout)
+	}
+	if !allToStdout {
+		return stderr, stdout
+	}
+	// Share a single writer so that lines from both streams don't interleave
+	out := &lockedWriter{w: stdout}
+	return out, out
 }
 
 // timestamped adds a timestamp to the beginning of log lines
 func timestamped(orig io.Writer) io.Writer {
-	return wfilter.LinePrepender(orig, func(w io.Writer) (int, error) {
-		return fmt.Fprintf(w, "%s - ", time.Now().In(time.UTC).Format(logTimestampFormat))
+	return prependLines(orig, func(t time.Time) []byte {
+		return appendTimestampPrefix(make([]byte, 0, timestampPrefixLen), t.In(time.UTC))
 	})
 }
 
-func enableLoggly(addr string, cloudConfigCA string, instanceId string,
-	version string, buildDate string) {
-	if addr == "" {
-		log.Error("No known proxy, won't report to Loggly")
-		removeLoggly()
-		return
-	}
+// timestampPrefixLen is the length of timestamp prefixes
+const timestampPrefixLen = len(logTimestampFormat) + len(" - ")
 
-	client, err := util.PersistentHTTPClient(cloudConfigCA, addr)
-	if err != nil {
-		log.Errorf("Could not create proxied HTTP client, not logging to Loggly: %v", err)
-		removeLoggly()
-		return
-	}
+func timestampPrefix(t time.Time) string {
+	return string(appendTimestampPrefix(make([]byte, 0, timestampPrefixLen), t))
+}
 
-	log.Debugf("Sending error logs to Loggly via proxy at %v", addr)
+// appendTimestampPrefix appends the timestampPrefix for t to b, which avoids
+// allocating on the write path.
+func appendTimestampPrefix(b []byte, t time.Time) []byte {
+	return append(t.AppendFormat(b, logTimestampFormat), " - "...)
+}
 
-	lang, _ := jibber_jabber.DetectLanguage()
+func enableLoggly(addr string, cloudConfigCA string, client *http.Client, instanceId string,
+	version string, buildDate string, buildInfo BuildInfo) {
+	opts := currentOptions()
+	var sender logglySender
+	if opts.LogglyDebug == LogglyDebugOnly {
+		log.Debug("Writing error logs to loggly-debug.log instead of sending them to Loggly")
+	} else if client != nil {
+		log.Debug("Sending error logs to Loggly with the given HTTP client")
+		sender = newLogglyClient(logglyToken, client, validTags(opts.LogglyTags)...)
+	} else {
+		if addr == "" {
+			log.Error("No known proxy, won't report to Loggly")
+			removeLoggly()
+			return
+		}
+
+		client, err := util.PersistentHTTPClient(cloudConfigCA, addr)
+		if err != nil {
+			log.Errorf("Could not create proxied HTTP client, not logging to Loggly: %v", err)
+			removeLoggly()
+			return
+		}
+
+		log.Debugf("Sending error logs to Loggly via proxy at %v", addr)
+		sender = newLogglyClient(logglyToken, client, validTags(opts.LogglyTags)...)
+	}
+	var batch *batchingSender
+	if sender != nil {
+		batch = newBatchingSender(sender, logglyBatchSize, opts.LogglyMaxInFlight, logglyFlushInterval)
+		sender = batch
+	}
+	if currentLogglyDebugFile() != nil {
+		sender = newLogglyDebugSender(sender, logglyDebugOut{})
+	}
+
+	lang := detectLanguage(opts.LanguageProvider)
 	logglyWriter := &logglyErrorWriter{
 		lang:            lang,
 		tz:              time.Now().Format("MST"),
 		versionToLoggly: fmt.Sprintf("%v (%v)", version, buildDate),
-		client:          loggly.New(logglyToken),
+		client:          sender,
+		maxMessageSize:  opts.LogglyMaxMessageSize,
+		oversizePolicy:  opts.LogglyOversizePolicy,
+		timestampMode:   opts.LogglyTimestamp,
+		groupMode:       opts.LogglyGroup,
+		multilinePolicy: opts.LogglyMultiline,
+		lineTags:        opts.LogglyLineTags,
+		uptime:          opts.LogglyUptime,
+	}
+	if opts.LogglyContextLines >= 0 {
+		logglyWriter.context = recentLogs
+		logglyWriter.contextLines = opts.LogglyContextLines
+		if logglyWriter.contextLines == 0 {
+			logglyWriter.contextLines = defaultContextLines
+		}
+	}
+	if opts.LogglyDuplicateWindow > 0 {
+		logglyWriter.duplicates = newDuplicateSuppressor(opts.LogglyDuplicateWindow, opts.LogglyDuplicateScope)
+	}
+	if opts.LogglyMaxGroups > 0 {
+		logglyWriter.groups = newGroupTracker(opts.LogglyMaxGroups, opts.LogglyGroupResetInterval)
+	}
+	logglyWriter.client.SetDefault("hostname", "hidden")
+	logglyWriter.client.SetDefault("instanceid", instanceId)
+	if opts.ProxyAddrInLoggly && addr != "" {
+		logglyWriter.client.SetDefault("proxy", proxyTag(addr, opts.RedactProxyAddr))
+	}
+	for key, value := range buildInfo.fields() {
+		logglyWriter.client.SetDefault(key, value)
+	}
+	if opts.SampleLoggly {
+		addLoggly(sample(logglyWriter, opts.SampleRates))
+	} else {
+		addLoggly(logglyWriter)
 	}
-	logglyWriter.client.Defaults["hostname"] = "hidden"
-	logglyWriter.client.Defaults["instanceid"] = instanceId
-	logglyWriter.client.SetHTTPClient(client)
-	addLoggly(logglyWriter)
+	logglyInUse.Store(senderBox{sender})
+	setLogglyBatch(batch)
 }
 
-func addLoggly(logglyWriter io.Writer) {
-	if runtime.GOOS == "android" {
-		golog.SetOutputs(logglyWriter, os.Stdout)
-	} else {
-		golog.SetOutputs(NonStopWriter(errorOut, logglyWriter), debugOut)
+// detectLanguage determines the language to report to Loggly using the given
+// provider, falling back to jibber_jabber if there's no provider or it fails.
+func detectLanguage(provider func() (string, error)) string {
+	if provider != nil {
+		lang, err := provider()
+		if err == nil {
+			return lang
+		}
+		log.Debugf("Unable to get language from provider, detecting it instead: %v", err)
 	}
+	lang, _ := jibber_jabber.DetectLanguage()
+	return lang
+}
+
+// SetLogglyFilter sets a function that gets to drop or rewrite each message
+// before it's sent to Loggly, without affecting other outputs. Messages for
+// which it returns false aren't sent. Otherwise, rewritten is sent in place of
+// the original fullMessage, with the message and locationInfo Loggly groups by
+// derived from it, so it should return fullMessage unchanged to keep it as
+// is. Passing nil sends all messages as they are.
+func SetLogglyFilter(filter func(fullMessage string) (send bool, rewritten string)) {
+	logglyFilter.Store(logglyFilterBox{filter})
+}
+
+// logglyFilterBox allows storing a possibly nil Loggly filter in an
+// atomic.Value.
+type logglyFilterBox struct {
+	filter func(fullMessage string) (send bool, rewritten string)
+}
+
+// SetLogglyGrouper sets a function that determines the message field, which
+// Loggly groups by, and the locationInfo field of each message sent to Loggly
+// in place of the built-in extraction and Options.LogglyGroup. It's given the
+// message as sent in the fullMessage field, minus any timestamp. The group is
+// still capped to 100 characters. Passing nil restores the built-in
+// extraction.
+func SetLogglyGrouper(grouper func(fullMessage string) (group string, locationInfo string)) {
+	logglyGrouper.Store(logglyGrouperBox{grouper})
+}
+
+// logglyGrouperBox allows storing a possibly nil Loggly grouper in an
+// atomic.Value.
+type logglyGrouperBox struct {
+	grouper func(fullMessage string) (group string, locationInfo string)
+}
+
+func addLoggly(logglyWriter io.Writer) {
+	setRemote(logglyRemote, logglyWriter)
 }
 
 func removeLoggly() {
-	golog.SetOutputs(errorOut, debugOut)
+	setRemote(logglyRemote, nil)
+	logglyInUse.Store(senderBox{})
+	setLogglyBatch(nil)
+}
+
+// activeLoggly returns the current Loggly writer, or nil if Loggly isn't
+// active.
+func activeLoggly() io.Writer {
+	return remote(logglyRemote)
 }
 
 type logglyErrorWriter struct {
 	lang            string
 	tz              string
 	versionToLoggly string
-	client          *loggly.Client
+	client          logglySender
+	maxMessageSize  int
+	oversizePolicy  OversizePolicy
+	timestampMode   LogglyTimestampMode
+	groupMode       LogglyGroupMode
+	groups          *groupTracker
+	context         *lineRing
+	contextLines    int
+	multilinePolicy MultilinePolicy
+	lineTags        bool
+	uptime          bool
+	duplicates      *duplicateSuppressor
+}
+
+func (w *logglyErrorWriter) Write(b []byte) (int, error) {
+	return w.writeAt(b, time.Now())
 }
 
-func (w logglyErrorWriter) Write(b []byte) (int, error) {
+func (w *logglyErrorWriter) writeAt(b []byte, t time.Time) (int, error) {
+	fullMessage := string(b)
+	if filter := logglyFilter.Load().(logglyFilterBox).filter; filter != nil {
+		send, rewritten := filter(fullMessage)
+		if !send {
+			return len(b), nil
+		}
+		fullMessage = rewritten
+	}
+	suppressed := 0
+	if w.duplicates != nil {
+		var send bool
+		send, suppressed = w.duplicates.check(fullMessage, time.Now())
+		if !send {
+			return len(b), nil
+		}
+	}
+	level := levelOf([]byte(fullMessage))
+	if level == "" {
+		level = levelError
+	}
 	extra := map[string]string{
-		"logLevel":  "ERROR",
+		"logLevel":  level,
 		"osName":    runtime.GOOS,
 		"osArch":    runtime.GOARCH,
 		"osVersion": "",
@@ -166,15 +1288,118 @@ func (w logglyErrorWriter) Write(b []byte) (int, error) {
 		"timeZone":  w.tz,
 		"version":   w.versionToLoggly,
 	}
-	fullMessage := string(b)
+	if country := currentExitCountry(); country != "" {
+		extra["exitCountry"] = country
+	}
+	if w.uptime {
+		extra["uptimeSeconds"] = strconv.FormatInt(int64(time.Since(startTime)/time.Second), 10)
+	}
+	if suppressed > 0 {
+		extra["suppressedDuplicates"] = strconv.Itoa(suppressed)
+	}
+	if w.context != nil {
+		if context := w.context.context(string(b), w.contextLines); context != "" {
+			extra["context"] = context
+		}
+	}
+
+	// Stack traces and the like span several lines. Depending on the policy,
+	// either collapse them into one or only group by the first line.
+	source := fullMessage
+	switch w.multilinePolicy {
+	case MultilineCollapse:
+		fullMessage = collapseLines(fullMessage)
+		source = fullMessage
+	case MultilineFirstLine:
+		if i := strings.IndexByte(strings.TrimRight(source, "\n"), '\n'); i >= 0 {
+			source = source[:i+1]
+		}
+	}
+
+	// The golog logger name, like flashlight.logging, for filtering by
+	// package. It's empty for lines not coming from a logger.
+	_, logger, _ := parseLine(source)
+	extra["logger"] = logger
+
+	// Fields logged with Errorf go in extra rather than affecting grouping
+	source, fields := parseFields(source)
+	for key, value := range fields {
+		if _, exists := extra[key]; !exists {
+			extra[key] = value
+		}
+	}
+
+	prefix, message := extractMessage(source)
+	var tags []string
+	if w.lineTags {
+		// Not using validTags as logging here would recurse
+		for _, tag := range []string{strings.ToLower(level), logger} {
+			if tag != "" && validTag(tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	if grouper := logglyGrouper.Load().(logglyGrouperBox).grouper; grouper != nil {
+		message, prefix = grouper(source)
+	} else {
+		switch w.groupMode {
+		case LogglyGroupFullMessage:
+			message = strings.TrimSpace(source)
+		case LogglyGroupLoggerPrefix:
+			message = prefix
+		}
+	}
+
+	// Loggly doesn't group fields with more than 100 characters
+	if len(message) > 100 {
+		message = message[0:100]
+	}
+	if w.groups != nil {
+		message = w.groups.group(message)
+	}
+
+	// Add the timestamp only after extracting the message and prefix so that
+	// it doesn't affect grouping
+	switch w.timestampMode {
+	case LogglyUTCTimestamp:
+		fullMessage = timestampPrefix(t.In(time.UTC)) + fullMessage
+	case LogglyLocalTimestamp:
+		fullMessage = timestampPrefix(t) + fullMessage
+	}
 
-	// extract last 2 (at most) chunks of fullMessage to message, without prefix,
-	// so we can group logs with same reason in Loggly
+	if w.maxMessageSize <= 0 || len(fullMessage) <= w.maxMessageSize {
+		return w.send(b, t, extra, tags, prefix, message, fullMessage)
+	}
+	if w.oversizePolicy == SplitOversized {
+		parts := splitMessage(fullMessage, w.maxMessageSize)
+		correlationId := newCorrelationId()
+		for i, part := range parts {
+			partExtra := make(map[string]string, len(extra)+2)
+			for k, v := range extra {
+				partExtra[k] = v
+			}
+			partExtra["correlationId"] = correlationId
+			partExtra["part"] = fmt.Sprintf("%d/%d", i+1, len(parts))
+			if _, err := w.send(b, t, partExtra, tags, prefix, message, part); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	return w.send(b, t, extra, tags, prefix, message, truncateMessage(fullMessage, w.maxMessageSize))
+}
+
+// extractMessage extracts the prefix (level and logger) and the message that
+// Loggly groups by from a line, the message being the last 2 (at most)
+// colon-separated chunks of the line, so that logs with the same reason are
+// grouped together.
+func extractMessage(source string) (prefix string, message string) {
 	lastColonPos := -1
 	colonsSeen := 0
-	for p := len(fullMessage) - 2; p >= 0; p-- {
-		if fullMessage[p] == ':' {
-			lastChar := fullMessage[p+1]
+	for p := len(source) - 2; p >= 0; p-- {
+		if source[p] == ':' {
+			lastChar := source[p+1]
 			// to prevent colon in "http://" and "x.x.x.x:80" be treated as seperator
 			if !(lastChar == '/' || lastChar >= '0' && lastChar <= '9') {
 				lastColonPos = p
@@ -185,24 +1410,26 @@ func (w logglyErrorWriter) Write(b []byte) (int, error) {
 			}
 		}
 	}
-	message := strings.TrimSpace(fullMessage[lastColonPos+1:])
-
-	// Loggly doesn't group fields with more than 100 characters
-	if len(message) > 100 {
-		message = message[0:100]
-	}
+	message = strings.TrimSpace(source[lastColonPos+1:])
 
-	firstColonPos := strings.IndexRune(fullMessage, ':')
+	firstColonPos := strings.IndexRune(source, ':')
 	if firstColonPos == -1 {
 		firstColonPos = 0
 	}
-	prefix := fullMessage[0:firstColonPos]
+	prefix = source[0:firstColonPos]
+	return prefix, message
+}
 
+func (w *logglyErrorWriter) send(b []byte, t time.Time, extra map[string]string, tags []string, prefix string, message string, fullMessage string) (int, error) {
 	m := loggly.Message{
 		"extra":        extra,
 		"locationInfo": prefix,
 		"message":      message,
 		"fullMessage":  fullMessage,
+		"timestamp":    t.UnixNano() / int64(time.Millisecond),
+	}
+	if len(tags) > 0 {
+		m["tags"] = tags
 	}
 
 	err := w.client.Send(m)
@@ -213,22 +1440,99 @@ func (w logglyErrorWriter) Write(b []byte) (int, error) {
 }
 
 type nonStopWriter struct {
-	writers []io.Writer
+	writers  []io.Writer
+	shortest bool
 }
 
 // NonStopWriter creates a writer that duplicates its writes to all the
 // provided writers, even if errors encountered while writting.
 func NonStopWriter(writers ...io.Writer) io.Writer {
+	return newNonStopWriter(false, writers)
+}
+
+// ShortestNonStopWriter is like NonStopWriter in that it always writes to all
+// of the provided writers, but instead of always reporting success its Write
+// returns the smallest number of bytes written by any of the writers together
+// with the first error encountered. This makes it suitable for io.Copy-style
+// callers that need to notice when a downstream writer comes up short.
+func ShortestNonStopWriter(writers ...io.Writer) io.Writer {
+	return newNonStopWriter(true, writers)
+}
+
+func newNonStopWriter(shortest bool, writers []io.Writer) io.Writer {
 	w := make([]io.Writer, len(writers))
 	copy(w, writers)
-	return &nonStopWriter{w}
+	if !shortest {
+		// Most outputs fan out to one or two writers
+		switch len(w) {
+		case 1:
+			return &nonStopWriter1{w[0]}
+		case 2:
+			return &nonStopWriter2{w[0], w[1]}
+		}
+	}
+	return &nonStopWriter{w, shortest}
+}
+
+// nonStopWriter1 is a NonStopWriter for a single writer.
+type nonStopWriter1 struct {
+	w io.Writer
+}
+
+func (t *nonStopWriter1) Write(p []byte) (int, error) {
+	return t.writeAt(p, time.Now())
+}
+
+func (t *nonStopWriter1) writeAt(p []byte, at time.Time) (int, error) {
+	writeTimed(t.w, p, at)
+	return len(p), nil
+}
+
+// nonStopWriter2 is a NonStopWriter for two writers.
+type nonStopWriter2 struct {
+	w1 io.Writer
+	w2 io.Writer
+}
+
+func (t *nonStopWriter2) Write(p []byte) (int, error) {
+	return t.writeAt(p, time.Now())
+}
+
+func (t *nonStopWriter2) writeAt(p []byte, at time.Time) (int, error) {
+	writeTimed(t.w1, p, at)
+	writeTimed(t.w2, p, at)
+	return len(p), nil
 }
 
 // Write implements the method from io.Writer.
-// It never fails and always return the length of bytes passed in
+// A writer created with NonStopWriter never fails and always return the length
+// of bytes passed in. A writer created with ShortestNonStopWriter returns the
+// minimum count written across all writers and the first error, using
+// io.ErrShortWrite if a writer came up short without reporting an error.
 func (t *nonStopWriter) Write(p []byte) (int, error) {
+	return t.writeAt(p, time.Now())
+}
+
+func (t *nonStopWriter) writeAt(p []byte, at time.Time) (int, error) {
+	n := len(p)
+	var firstErr error
 	for _, w := range t.writers {
-		w.Write(p)
+		wn, err := writeTimed(w, p, at)
+		if !t.shortest {
+			continue
+		}
+		if wn < n {
+			n = wn
+		}
+		if err == nil && wn < len(p) {
+			err = io.ErrShortWrite
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
 	}
-	return len(p), nil
+	if !t.shortest {
+		return len(p), nil
+	}
+	return n, firstErr
 }
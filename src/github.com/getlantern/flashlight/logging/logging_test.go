@@ -3,12 +3,22 @@ package logging
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/getlantern/appdir"
 	"github.com/getlantern/go-loggly"
 	"github.com/getlantern/golog"
+	"github.com/getlantern/keyman"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,8 +27,9 @@ func TestLoggly(t *testing.T) {
 	var result map[string]interface{}
 	loggly := loggly.New("token not required")
 	loggly.Writer = &buf
-	lw := logglyErrorWriter{client: loggly}
+	lw := &logglyErrorWriter{client: logglyClient{loggly}}
 	golog.SetOutputs(lw, nil)
+	defer golog.ResetOutputs()
 	log := golog.LoggerFor("test")
 
 	log.Error("")
@@ -72,3 +83,367 @@ func TestLoggly(t *testing.T) {
 		assert.Equal(t, 100, len(result["message"].(string)))
 	}
 }
+
+type shortWriter struct {
+	max int
+	err error
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		return w.max, w.err
+	}
+	return len(p), nil
+}
+
+func TestNonStopWriter(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	w := NonStopWriter(&buf1, &shortWriter{3, errors.New("fail")}, &buf2)
+	n, err := w.Write([]byte("hello"))
+	assert.NoError(t, err, "NonStopWriter should never fail")
+	assert.Equal(t, 5, n, "NonStopWriter should always report full length")
+	assert.Equal(t, "hello", buf1.String())
+	assert.Equal(t, "hello", buf2.String(), "should keep writing after a failed writer")
+}
+
+func TestNonStopWriterFewWriters(t *testing.T) {
+	n, err := NonStopWriter(&shortWriter{3, errors.New("fail")}).Write([]byte("hello"))
+	assert.NoError(t, err, "a single writer shouldn't fail either")
+	assert.Equal(t, 5, n)
+
+	var buf bytes.Buffer
+	n, err = NonStopWriter(&shortWriter{3, errors.New("fail")}, &buf).Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "hello", buf.String(), "should keep writing after a failed writer")
+}
+
+func TestShortestNonStopWriter(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	w := ShortestNonStopWriter(&buf1, &shortWriter{3, errors.New("fail")}, &shortWriter{2, nil}, &buf2)
+	n, err := w.Write([]byte("hello"))
+	assert.Equal(t, 2, n, "should report the shortest write")
+	assert.EqualError(t, err, "fail", "should report the first error")
+	assert.Equal(t, "hello", buf2.String(), "should keep writing after a failed writer")
+
+	w = ShortestNonStopWriter(&buf1, &shortWriter{4, nil})
+	n, err = w.Write([]byte("hello"))
+	assert.Equal(t, 4, n)
+	assert.Equal(t, io.ErrShortWrite, err, "short write without error should be reported as io.ErrShortWrite")
+
+	n, err = ShortestNonStopWriter(&buf1, &buf2).Write([]byte("hi"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+type recordingTransport struct {
+	requests chan *http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests <- req
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestConfigureWithHTTPClient(t *testing.T) {
+	defer golog.ResetOutputs()
+	defer removeLoggly()
+	origToken := logglyToken
+	logglyToken = "token"
+	defer func() {
+		logglyToken = origToken
+	}()
+
+	transport := &recordingTransport{make(chan *http.Request, 10)}
+	client := &http.Client{Transport: transport}
+	enableLoggly("", "", client, "instance", "1.0.0", "today", BuildInfo{})
+	lw, ok := activeLoggly().(*logglyErrorWriter)
+	if !assert.True(t, ok, "should enable Loggly without a proxy address") {
+		return
+	}
+	lw.Write([]byte("ERROR flashlight: a.go:1 failed\n"))
+	assert.NoError(t, lw.client.(flushingSender).Flush())
+	select {
+	case req := <-transport.requests:
+		assert.Contains(t, req.URL.String(), "token", "should send through the given client")
+	default:
+		t.Fatal("Nothing sent through the given client")
+	}
+
+	proxyMutex.Lock()
+	proxyClient = client
+	proxyMutex.Unlock()
+	defer func() {
+		proxyMutex.Lock()
+		proxyClient = nil
+		proxyMutex.Unlock()
+	}()
+	c, err := proxiedHTTPClient()
+	assert.NoError(t, err)
+	assert.Equal(t, client, c, "remote outputs should use the given client too")
+}
+
+func TestConfigureLogglyDebugOnly(t *testing.T) {
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+		lastAddr, lastDebugOnly = "", false
+		instanceIdValue.Store("")
+		appVersion.Store("")
+		buildDateValue.Store("")
+	}()
+	opener := func(path string) (io.WriteCloser, error) {
+		return &memFile{}, nil
+	}
+	dir := filepath.Join(os.TempDir(), "lantern-memory-logs")
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir, FileOpener: opener, LogglyDebug: LogglyDebugOnly})) {
+		return
+	}
+	defer Close()
+	defer removeLoggly()
+
+	Configure("", "", "instance", "1.0.0", "today")
+	deadline := time.Now().Add(5 * time.Second)
+	for activeLoggly() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NotNil(t, activeLoggly(), "should write to loggly-debug.log without a proxy")
+}
+
+func TestConsoleOutputs(t *testing.T) {
+	var stderr, stdout bytes.Buffer
+	errOut, dbgOut := consoleOutputs(&stderr, &stdout, false, true)
+	errOut.Write([]byte("ERROR test: a.go:1 failed\n"))
+	dbgOut.Write([]byte("DEBUG test: a.go:2 dialing\n"))
+	assert.Regexp(t, ` - ERROR test: a.go:1 failed\n$`, stderr.String())
+	assert.Regexp(t, ` - DEBUG test: a.go:2 dialing\n$`, stdout.String())
+
+	stderr.Reset()
+	stdout.Reset()
+	errOut, dbgOut = consoleOutputs(&stderr, &stdout, true, true)
+	errOut.Write([]byte("ERROR test: a.go:1 failed\n"))
+	dbgOut.Write([]byte("DEBUG test: a.go:2 dialing\n"))
+	assert.Equal(t, "", stderr.String(), "nothing should go to stderr")
+	assert.Regexp(t, `^[^\n]+ - ERROR test: a.go:1 failed\n[^\n]+ - DEBUG test: a.go:2 dialing\n$`, stdout.String())
+
+	stderr.Reset()
+	stdout.Reset()
+	errOut, dbgOut = consoleOutputs(&stderr, &stdout, false, false)
+	errOut.Write([]byte("ERROR test: a.go:1 failed\n"))
+	dbgOut.Write([]byte("DEBUG test: a.go:2 dialing\n"))
+	assert.Equal(t, "ERROR test: a.go:1 failed\n", stderr.String(), "should leave out the timestamp")
+	assert.Equal(t, "DEBUG test: a.go:2 dialing\n", stdout.String())
+}
+
+func TestResolveLogDir(t *testing.T) {
+	dir, err := resolveLogDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, appdir.Logs("Lantern"), dir, "should default to appdir")
+
+	dir, err = resolveLogDir("/var/log/lantern/")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/log/lantern", dir)
+
+	home, _ := os.UserHomeDir()
+	dir, err = resolveLogDir("~/logs")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, "logs"), dir, "should expand ~")
+
+	_, err = resolveLogDir("logs")
+	assert.Error(t, err, "should require an absolute path")
+	_, err = resolveLogDir("~other/logs")
+	assert.Error(t, err, "shouldn't expand other users' home directories")
+}
+
+func TestLogDirFallback(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "logdir")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	oldTmpDir := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", tmp)
+	defer os.Setenv("TMPDIR", oldTmpDir)
+
+	ok := filepath.Join(tmp, "ok", "logs")
+	dir, err := logDirWithFallback(ok, true)
+	assert.NoError(t, err)
+	assert.Equal(t, ok, dir, "should create the logdir")
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files, "shouldn't leave anything behind checking it's writable")
+
+	// A path under a regular file can't be created, even as root
+	file := filepath.Join(tmp, "file")
+	assert.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	unusable := filepath.Join(file, "logs")
+	dir, err = logDirWithFallback(unusable, false)
+	assert.Error(t, err, "should report why it fell back")
+	assert.Equal(t, filepath.Join(tmp, "Lantern", "logs"), dir, "should fall back to the temp dir")
+
+	dir, err = logDirWithFallback(unusable, true)
+	assert.Error(t, err)
+	assert.Equal(t, "", dir, "shouldn't fall back when strict")
+}
+
+func TestValidateConfig(t *testing.T) {
+	origToken := logglyToken
+	defer func() {
+		logglyToken = origToken
+	}()
+
+	logglyToken = ""
+	assert.NoError(t, ValidateConfig("not a certificate"), "shouldn't check the CA without Loggly")
+
+	logglyToken = "token"
+	assert.NoError(t, ValidateConfig(""), "should allow no CA")
+	assert.Error(t, ValidateConfig("not a certificate"))
+
+	pk, err := keyman.GeneratePK(1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cert, err := pk.TLSCertificateFor("Lantern", "test", time.Now().Add(time.Hour), true, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, ValidateConfig(string(cert.PEMEncoded())))
+}
+
+// memFile is an in-memory log file.
+type memFile struct {
+	syncBuffer
+	closed bool
+}
+
+func (f *memFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	f.closed = true
+	return nil
+}
+
+func TestInitWithFileOpener(t *testing.T) {
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+
+	files := make(map[string]*memFile)
+	dir := filepath.Join(os.TempDir(), "lantern-memory-logs")
+	err := InitWithOptions(&Options{
+		LogDir: dir,
+		FileOpener: func(path string) (io.WriteCloser, error) {
+			f := &memFile{}
+			files[path] = f
+			return f, nil
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	golog.LoggerFor("test").Debug("hello memory")
+	assert.NoError(t, Close())
+
+	f := files[filepath.Join(dir, logFileName)]
+	if assert.NotNil(t, f, "should have opened the log file with the opener") {
+		assert.Contains(t, f.String(), "DEBUG test: logging_test.go")
+		assert.Contains(t, f.String(), "hello memory")
+		assert.True(t, f.closed, "should close the file")
+	}
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err), "shouldn't create the logs directory")
+}
+
+func TestCloseSendsPending(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+		removeLoggly()
+	}()
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		received <- string(b)
+	}))
+	defer server.Close()
+
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir, OrderedOutput: true})) {
+		return
+	}
+	sender := newFakeSender()
+	batch := newBatchingSender(sender, logglyBatchSize, defaultLogglyMaxInFlight, time.Hour)
+	addLoggly(&logglyErrorWriter{client: batch})
+	setLogglyBatch(batch)
+	configureOTLP(server.URL, nil, http.DefaultClient, time.Hour)
+
+	golog.LoggerFor("test").Error("pending at close")
+	assert.NoError(t, Close())
+	sent := sender.sent()
+	if assert.Len(t, sent, 1, "should send queued Loggly messages without lifecycle events") {
+		assert.Contains(t, sent[0]["fullMessage"], "pending at close")
+	}
+	assert.Nil(t, logglyBatch.Load().(*batchingSender), "should stop the Loggly batch")
+	assert.Nil(t, remote(otlpRemote), "should stop the remotes")
+	select {
+	case body := <-received:
+		assert.Contains(t, body, "pending at close", "remotes should send what they have left")
+	default:
+		assert.Fail(t, "remotes should send what they have left")
+	}
+}
+
+func TestNDJSONFile(t *testing.T) {
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+
+	files := make(map[string]*memFile)
+	dir := filepath.Join(os.TempDir(), "lantern-memory-logs")
+	err := InitWithOptions(&Options{
+		LogDir:     dir,
+		NDJSONFile: true,
+		FileOpener: func(path string) (io.WriteCloser, error) {
+			f := &memFile{}
+			files[path] = f
+			return f, nil
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	l := golog.LoggerFor("test")
+	l.Debug("first")
+	l.Error("second")
+	assert.NoError(t, Close())
+	assert.Nil(t, ndjsonFile)
+
+	text, ndjson := files[filepath.Join(dir, logFileName)], files[filepath.Join(dir, ndjsonFileName)]
+	if !assert.NotNil(t, ndjson, "should write the NDJSON file") {
+		return
+	}
+	assert.Regexp(t, `(?s)first.*second`, text.String())
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	var msgs []string
+	for _, line := range lines {
+		var record map[string]string
+		if assert.NoError(t, json.Unmarshal([]byte(line), &record), line) && record["logger"] == "test" {
+			msgs = append(msgs, record["msg"])
+		}
+	}
+	if assert.Len(t, msgs, 2, "should have the same lines as the log file") {
+		assert.Contains(t, msgs[0], "first")
+		assert.Contains(t, msgs[1], "second", "should keep the same order")
+	}
+	assert.True(t, ndjson.closed, "Close should close both files")
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	namedLogs      = make(map[string]*sizeRotator)
+	namedLogsMutex sync.Mutex
+)
+
+// RegisterNamedLog creates a separate, rotated log file with the given
+// filename in the logs directory, so that a subsystem can keep its own log
+// apart from the main one. The returned writer timestamps each line like the
+// main log, masks the secrets given to RegisterSecret and is safe for
+// concurrent use. Named logs use the same rotation
+// settings as the main log and are closed by Close. Must be called after Init.
+// It fails if that would exceed Options.MaxLogFiles.
+func RegisterNamedLog(name string, filename string) (io.Writer, error) {
+	dir := currentLogDir()
+	if dir == "" {
+		return nil, fmt.Errorf("Logging not initialized, can't register log %v", name)
+	}
+	if filename == "" || filepath.Base(filename) != filename {
+		return nil, fmt.Errorf("Invalid filename for log %v: %v", name, filename)
+	}
+
+	namedLogsMutex.Lock()
+	defer namedLogsMutex.Unlock()
+	if _, found := namedLogs[name]; found {
+		return nil, fmt.Errorf("Log %v already registered", name)
+	}
+	for _, r := range namedLogs {
+		if r.path == filepath.Join(dir, filename) {
+			return nil, fmt.Errorf("Log file %v already in use", filename)
+		}
+	}
+	if max := currentOptions().MaxLogFiles; max > 0 && logFileCount()+1 > max {
+		return nil, fmt.Errorf("Unable to register log %v, already using %d log files", name, max)
+	}
+	r := newLogFile(dir, filename)
+	if logFile := currentLogFile(); logFile != nil {
+		r.RotationSize = logFile.RotationSize
+		r.MaxRotation = logFile.MaxRotation
+		r.Compress = logFile.Compress
+		r.CompressLevel = logFile.CompressLevel
+		r.MaxRotationSize = logFile.MaxRotationSize
+		r.MaxAge = logFile.MaxAge
+		r.KeepExtension = logFile.KeepExtension
+		r.Checksums = logFile.Checksums
+	}
+	namedLogs[name] = r
+	return &secretMasker{&lockedWriter{w: timestamped(r)}}, nil
+}
+
+// logFileCount returns the number of log files in use, each of which may be
+// kept open. It must be called with namedLogsMutex held.
+func logFileCount() int {
+	count := len(namedLogs)
+	for _, r := range []*sizeRotator{currentLogFile(), currentLogglyDebugFile(), ndjsonFile} {
+		if r != nil {
+			count++
+		}
+	}
+	return count
+}
+
+func closeNamedLogs() {
+	namedLogsMutex.Lock()
+	defer namedLogsMutex.Unlock()
+	for name, r := range namedLogs {
+		if err := r.Close(); err != nil {
+			log.Debugf("Unable to close log %v: %v", name, err)
+		}
+		delete(namedLogs, name)
+	}
+}
+
+// lockedWriter serializes writes to a writer that isn't safe for concurrent
+// use.
+type lockedWriter struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *lockedWriter) writeAt(p []byte, t time.Time) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return writeTimed(w.w, p, t)
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterNamedLog(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir := logDir
+	defer func() {
+		logDir = oldLogDir
+	}()
+
+	logDir = ""
+	_, err := RegisterNamedLog("proxy", "proxy.log")
+	assert.Error(t, err, "should fail before Init")
+
+	logDir = dir
+	_, err = RegisterNamedLog("proxy", "../proxy.log")
+	assert.Error(t, err, "should not allow escaping the logs directory")
+
+	w, err := RegisterNamedLog("proxy", "proxy.log")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = RegisterNamedLog("proxy", "other.log")
+	assert.Error(t, err, "should not allow registering the same name twice")
+	_, err = RegisterNamedLog("other", "proxy.log")
+	assert.Error(t, err, "should not allow sharing a file")
+
+	fmt.Fprintln(w, "first line")
+	fmt.Fprintln(w, "second line")
+	closeNamedLogs()
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "proxy.log"))
+	if assert.NoError(t, err) {
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.Regexp(t, " - first line$", lines[0], "lines should be timestamped")
+			assert.Regexp(t, " - second line$", lines[1], "lines should be timestamped")
+		}
+	}
+
+	_, err = RegisterNamedLog("proxy", "proxy.log")
+	assert.NoError(t, err, "should be able to register again after closing")
+	closeNamedLogs()
+}
+
+func TestNamedLogMasksSecrets(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir := logDir
+	defer func() {
+		logDir = oldLogDir
+	}()
+	defer resetSecrets()
+	logDir = dir
+
+	RegisterSecret("hunter2")
+	w, err := RegisterNamedLog("proxy", "proxy.log")
+	if !assert.NoError(t, err) {
+		return
+	}
+	fmt.Fprintln(w, "password hunter2")
+	closeNamedLogs()
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "proxy.log"))
+	if assert.NoError(t, err) {
+		assert.Regexp(t, " - password \\*\\*\\*\n$", string(b), "should mask secrets")
+	}
+}
+
+func TestMaxLogFiles(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+	logDir = dir
+	logFile = newSizeRotator(filepath.Join(dir, "lantern.log"))
+	defer logFile.Close()
+	options = &Options{MaxLogFiles: 2}
+	defer closeNamedLogs()
+
+	before := Stats().OpenLogFiles
+	w, err := RegisterNamedLog("proxy", "proxy.log")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = RegisterNamedLog("other", "other.log")
+	assert.Error(t, err, "should refuse more log files than the limit")
+
+	fmt.Fprintln(w, "line")
+	logFile.Write([]byte("line\n"))
+	assert.Equal(t, int64(2), Stats().OpenLogFiles-before)
+	closeNamedLogs()
+	assert.Equal(t, int64(1), Stats().OpenLogFiles-before)
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// observerQueueSize is how many lines may be waiting for each observer before
+// further lines are dropped for it.
+const observerQueueSize = 256
+
+var (
+	observers      = make(map[*observer]bool)
+	observersMutex sync.RWMutex
+
+	// observerDroppedLines is the number of lines not passed to observers
+	// because they were falling behind
+	observerDroppedLines uint64
+)
+
+type observedLine struct {
+	level string
+	line  string
+}
+
+type observer struct {
+	fn    func(level, line string)
+	lines chan observedLine
+}
+
+// AddLineObserver registers fn to be called with the level and text (without
+// the trailing newline) of every line logged after Init, as an alternative to
+// writing an io.Writer. It's called from its own goroutine, one line at a
+// time, so it never holds up logging. Lines are dropped for it if it falls
+// too far behind. Calling the returned remove function stops it.
+func AddLineObserver(fn func(level, line string)) (remove func()) {
+	o := &observer{fn: fn, lines: make(chan observedLine, observerQueueSize)}
+	observersMutex.Lock()
+	observers[o] = true
+	observersMutex.Unlock()
+	go func() {
+		for l := range o.lines {
+			o.fn(l.level, l.line)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			observersMutex.Lock()
+			delete(observers, o)
+			observersMutex.Unlock()
+			close(o.lines)
+		})
+	}
+}
+
+type observerTee struct {
+	io.Writer
+}
+
+// observeLines creates a writer that queues each line written to it for all
+// observers before passing it on to w.
+func observeLines(w io.Writer) io.Writer {
+	return &observerTee{w}
+}
+
+func (w *observerTee) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *observerTee) writeAt(p []byte, t time.Time) (int, error) {
+	observersMutex.RLock()
+	if len(observers) > 0 {
+		l := observedLine{levelOf(p), strings.TrimRight(string(p), "\r\n")}
+		for o := range observers {
+			select {
+			case o.lines <- l:
+			default:
+				atomic.AddUint64(&observerDroppedLines, 1)
+			}
+		}
+	}
+	observersMutex.RUnlock()
+	return writeTimed(w.Writer, p, t)
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineObserver(t *testing.T) {
+	w := observeLines(ioutil.Discard)
+	lines := make(chan string, 10)
+	remove := AddLineObserver(func(level, line string) {
+		lines <- level + "|" + line
+	})
+	fmt.Fprintln(w, "ERROR test: a.go:1 failed")
+	fmt.Fprintln(w, "DEBUG test: a.go:2 dialing")
+	for _, expected := range []string{"ERROR|ERROR test: a.go:1 failed", "DEBUG|DEBUG test: a.go:2 dialing"} {
+		select {
+		case line := <-lines:
+			assert.Equal(t, expected, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("should observe %v", expected)
+		}
+	}
+
+	remove()
+	remove()
+	fmt.Fprintln(w, "ERROR test: a.go:3 after")
+	select {
+	case line := <-lines:
+		t.Fatalf("shouldn't observe lines after removal, got %v", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSlowLineObserver(t *testing.T) {
+	w := observeLines(ioutil.Discard)
+	release := make(chan struct{})
+	remove := AddLineObserver(func(level, line string) {
+		<-release
+	})
+	defer remove()
+	defer close(release)
+
+	before := Stats().ObserverDroppedLines
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < observerQueueSize+10; i++ {
+			fmt.Fprintln(w, "DEBUG test: a.go:1 line")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow observer shouldn't block logging")
+	}
+	assert.True(t, Stats().ObserverDroppedLines-before >= 9, "should drop lines for the slow observer")
+}
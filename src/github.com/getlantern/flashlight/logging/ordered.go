@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// orderedQueueSize is how many lines can be queued for ordered output
+	// before logging blocks
+	orderedQueueSize = 1000
+)
+
+var (
+	// ordered is the orderedOutput if Options.OrderedOutput is enabled
+	ordered *orderedOutput
+)
+
+// orderedLine is a line logged at t to write to w, or if drained is set, a
+// marker to close once the lines queued before it are written.
+type orderedLine struct {
+	w       io.Writer
+	p       []byte
+	t       time.Time
+	drained chan struct{}
+}
+
+// orderedOutput funnels the lines of both streams through a single queue
+// written out by a single goroutine, so that all writers receive lines in the
+// same relative order. Otherwise, concurrent lines may reach, say, the log
+// file and Loggly in different orders.
+type orderedOutput struct {
+	queue chan orderedLine
+	// mutex is held for reading from checking stopped until a line is
+	// queued, and for writing to set stopped, so that no line gets queued
+	// once the goroutine may be done writing out the queue
+	mutex   sync.RWMutex
+	stopped bool
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+func newOrderedOutput() *orderedOutput {
+	o := &orderedOutput{
+		queue:  make(chan orderedLine, orderedQueueSize),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go o.run()
+	return o
+}
+
+func (o *orderedOutput) run() {
+	defer close(o.done)
+	for {
+		select {
+		case line := <-o.queue:
+			line.write()
+		case <-o.stopCh:
+			for {
+				select {
+				case line := <-o.queue:
+					line.write()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (line orderedLine) write() {
+	if line.drained != nil {
+		close(line.drained)
+		return
+	}
+	writeTimed(line.w, line.p, line.t)
+}
+
+// writer returns a writer queueing the lines written to it for w.
+func (o *orderedOutput) writer(w io.Writer) io.Writer {
+	return &orderedWriter{o, w}
+}
+
+// stop writes out the queued lines and stops the goroutine. Lines written
+// afterwards are written out directly.
+func (o *orderedOutput) stop() {
+	o.mutex.Lock()
+	o.stopped = true
+	o.mutex.Unlock()
+	close(o.stopCh)
+	<-o.done
+}
+
+// enqueue queues line unless stopped, telling whether it did.
+func (o *orderedOutput) enqueue(line orderedLine) bool {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	if o.stopped {
+		return false
+	}
+	o.queue <- line
+	return true
+}
+
+// drain waits for the lines queued so far to be written out.
+func (o *orderedOutput) drain() {
+	drained := make(chan struct{})
+	if !o.enqueue(orderedLine{drained: drained}) {
+		<-o.done
+		return
+	}
+	<-drained
+}
+
+type orderedWriter struct {
+	o *orderedOutput
+	w io.Writer
+}
+
+func (w *orderedWriter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *orderedWriter) writeAt(p []byte, t time.Time) (int, error) {
+	if w.o.enqueue(orderedLine{w: w.w, p: append([]byte(nil), p...), t: t}) {
+		return len(p), nil
+	}
+	return writeTimed(w.w, p, t)
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedOutput(t *testing.T) {
+	var file, remote syncBuffer
+	o := newOrderedOutput()
+	errOut := o.writer(NonStopWriter(&file, &remote))
+	dbgOut := o.writer(&file)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				errOut.Write([]byte(fmt.Sprintf("ERROR test: a.go:1 %d-%d\n", i, j)))
+				dbgOut.Write([]byte(fmt.Sprintf("DEBUG test: a.go:1 %d-%d\n", i, j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+	o.stop()
+
+	var errorLines []string
+	for _, line := range strings.SplitAfter(file.String(), "\n") {
+		if strings.HasPrefix(line, "ERROR") {
+			errorLines = append(errorLines, line)
+		}
+	}
+	assert.Equal(t, 500, len(errorLines))
+	assert.Equal(t, remote.String(), strings.Join(errorLines, ""), "all writers should get lines in the same order")
+
+	errOut.Write([]byte("ERROR test: a.go:1 after stop\n"))
+	assert.True(t, strings.HasSuffix(remote.String(), "after stop\n"), "should write directly after stopping")
+}
+
+func TestOrderedOutputStopWhileWriting(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		var file syncBuffer
+		o := newOrderedOutput()
+		out := o.writer(&file)
+
+		var started, wg sync.WaitGroup
+		for j := 0; j < 10; j++ {
+			started.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 20; k++ {
+					out.Write([]byte("DEBUG test: a.go:1 line\n"))
+					if k == 0 {
+						started.Done()
+					}
+				}
+			}()
+		}
+		started.Wait()
+		o.stop()
+		wg.Wait()
+
+		assert.Equal(t, 200, strings.Count(file.String(), "\n"), "no line written while stopping should get lost")
+	}
+}
@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	otlpRemote = "otlp"
+
+	otlpBatchSize     = 100
+	otlpMaxBuffered   = 1000
+	otlpFlushInterval = 5 * time.Second
+)
+
+// otlpSeverities maps levels to OpenTelemetry severity numbers.
+var otlpSeverities = map[string]int{
+	levelTrace: 1,
+	levelDebug: 5,
+	levelInfo:  9,
+	levelError: 17,
+	levelFatal: 21,
+}
+
+// ConfigureOTLP starts exporting the error stream to the given OTLP/HTTP logs
+// endpoint (e.g. https://collector.example.com/v1/logs) through the proxy
+// last passed to Configure, adding the given headers to each request. Records
+// are batched and sent as OTLP JSON. Records that fail to send are retried with
+// the next batch, up to a bounded backlog. An empty endpoint stops exporting.
+func ConfigureOTLP(endpoint string, headers map[string]string) error {
+	if endpoint == "" {
+		stopOTLP()
+		return nil
+	}
+	client, err := proxiedHTTPClient()
+	if err != nil {
+		return fmt.Errorf("Unable to export logs to OTLP: %v", err)
+	}
+	configureOTLP(endpoint, headers, client, otlpFlushInterval)
+	return nil
+}
+
+func configureOTLP(endpoint string, headers map[string]string, client *http.Client, flushInterval time.Duration) *otlpLogWriter {
+	stopOTLP()
+	w := &otlpLogWriter{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   client,
+		stop:     make(chan struct{}),
+	}
+	go w.run(flushInterval)
+	setRemote(otlpRemote, w)
+	return w
+}
+
+// stopOTLP stops exporting to OTLP, flushing any pending records.
+func stopOTLP() {
+	w, _ := remote(otlpRemote).(*otlpLogWriter)
+	if w == nil {
+		return
+	}
+	setRemote(otlpRemote, nil)
+	close(w.stop)
+	w.flush()
+}
+
+type otlpRecord struct {
+	ts     time.Time
+	level  string
+	logger string
+	body   string
+}
+
+// otlpLogWriter batches log lines and exports them to an OTLP/HTTP endpoint.
+type otlpLogWriter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+	stop     chan struct{}
+
+	mutex    sync.Mutex
+	records  []otlpRecord
+	flushing sync.Mutex
+}
+
+func (w *otlpLogWriter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *otlpLogWriter) writeAt(p []byte, t time.Time) (int, error) {
+	level, logger, msg := parseLine(string(p))
+	w.mutex.Lock()
+	w.records = append(w.records, otlpRecord{t, level, logger, msg})
+	if len(w.records) > otlpMaxBuffered {
+		w.records = w.records[len(w.records)-otlpMaxBuffered:]
+	}
+	full := len(w.records) >= otlpBatchSize
+	w.mutex.Unlock()
+	if full {
+		go w.flush()
+	}
+	return len(p), nil
+}
+
+func (w *otlpLogWriter) run(flushInterval time.Duration) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+// flush sends the pending records, putting them back for the next attempt if
+// sending fails.
+func (w *otlpLogWriter) flush() {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	w.mutex.Lock()
+	records := w.records
+	w.records = nil
+	w.mutex.Unlock()
+	if len(records) == 0 {
+		return
+	}
+
+	if err := w.send(records); err != nil {
+		log.Debugf("Unable to export %d log records to OTLP, will retry: %v", len(records), err)
+		w.mutex.Lock()
+		w.records = append(records, w.records...)
+		if len(w.records) > otlpMaxBuffered {
+			w.records = w.records[len(w.records)-otlpMaxBuffered:]
+		}
+		w.mutex.Unlock()
+	}
+}
+
+func (w *otlpLogWriter) send(records []otlpRecord) error {
+	body, err := json.Marshal(otlpRequest(records))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected response status %v", resp.Status)
+	}
+	return nil
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+func otlpString(key string, value string) otlpAttribute {
+	return otlpAttribute{key, map[string]string{"stringValue": value}}
+}
+
+// otlpRequest builds the OTLP JSON payload for the given records.
+func otlpRequest(records []otlpRecord) map[string]interface{} {
+	logRecords := make([]map[string]interface{}, 0, len(records))
+	for _, r := range records {
+		level := r.level
+		if level == "" {
+			level = levelError
+		}
+		logRecords = append(logRecords, map[string]interface{}{
+			"timeUnixNano":   strconv.FormatInt(r.ts.UnixNano(), 10),
+			"severityNumber": otlpSeverities[level],
+			"severityText":   level,
+			"body":           map[string]string{"stringValue": r.body},
+			"attributes":     []otlpAttribute{otlpString("logger", r.logger)},
+		})
+	}
+	return map[string]interface{}{
+		"resourceLogs": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{
+					otlpString("service.name", "flashlight"),
+					otlpString("service.version", appVersion.Load().(string)),
+					otlpString("os.type", runtime.GOOS),
+					otlpString("host.arch", runtime.GOARCH),
+				},
+			},
+			"scopeLogs": []map[string]interface{}{{
+				"scope":      map[string]string{"name": "flashlight.logging"},
+				"logRecords": logRecords,
+			}},
+		}},
+	}
+}
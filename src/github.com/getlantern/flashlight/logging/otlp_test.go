@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTLPExport(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []map[string]interface{}
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, "secret", req.Header.Get("X-Api-Key"))
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		if fail {
+			fail = false
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(b, &body))
+		requests = append(requests, body)
+	}))
+	defer server.Close()
+
+	w := configureOTLP(server.URL, map[string]string{"X-Api-Key": "secret"}, http.DefaultClient, time.Hour)
+	defer stopOTLP()
+	fmt.Fprintln(w, "ERROR flashlight.proxy: proxy.go:10 unable to dial")
+	w.flush()
+	mutex.Lock()
+	assert.Empty(t, requests, "first attempt should fail")
+	mutex.Unlock()
+	fmt.Fprintln(w, "FATAL flashlight: main.go:1 giving up")
+	w.flush()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	resourceLogs := requests[0]["resourceLogs"].([]interface{})[0].(map[string]interface{})
+	attrs := resourceLogs["resource"].(map[string]interface{})["attributes"].([]interface{})
+	resource := make(map[string]string)
+	for _, a := range attrs {
+		attr := a.(map[string]interface{})
+		resource[attr["key"].(string)] = attr["value"].(map[string]interface{})["stringValue"].(string)
+	}
+	assert.Equal(t, "flashlight", resource["service.name"])
+	assert.Equal(t, runtime.GOOS, resource["os.type"])
+	assert.Equal(t, runtime.GOARCH, resource["host.arch"])
+
+	records := resourceLogs["scopeLogs"].([]interface{})[0].(map[string]interface{})["logRecords"].([]interface{})
+	if assert.Len(t, records, 2, "failed record should have been retried") {
+		first := records[0].(map[string]interface{})
+		assert.Equal(t, "ERROR", first["severityText"])
+		assert.Equal(t, float64(17), first["severityNumber"])
+		assert.Equal(t, "proxy.go:10 unable to dial", first["body"].(map[string]interface{})["stringValue"])
+		second := records[1].(map[string]interface{})
+		assert.Equal(t, float64(21), second["severityNumber"])
+	}
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"unicode/utf8"
+)
+
+const (
+	truncatedMarker = " [truncated]"
+)
+
+// OversizePolicy determines what happens to Loggly messages that exceed
+// Options.LogglyMaxMessageSize.
+type OversizePolicy int
+
+const (
+	// TruncateOversized cuts oversized messages down to the maximum size,
+	// ending them with a marker to show that they were truncated.
+	TruncateOversized OversizePolicy = iota
+
+	// SplitOversized sends oversized messages as several Loggly messages, each
+	// within the maximum size. All parts share the same correlationId and are
+	// numbered in their part field (e.g. "2/3").
+	SplitOversized
+)
+
+// truncateMessage cuts msg down to at most max bytes including the truncation
+// marker, without splitting a multi-byte character.
+func truncateMessage(msg string, max int) string {
+	if len(msg) <= max {
+		return msg
+	}
+	if max <= len(truncatedMarker) {
+		return msg[:runeBoundary(msg, max)]
+	}
+	return msg[:runeBoundary(msg, max-len(truncatedMarker))] + truncatedMarker
+}
+
+// splitMessage splits msg into parts of at most max bytes each, without
+// splitting multi-byte characters.
+func splitMessage(msg string, max int) []string {
+	var parts []string
+	for len(msg) > max {
+		i := runeBoundary(msg, max)
+		if i == 0 {
+			// max is smaller than a single character, take it anyway
+			_, i = utf8.DecodeRuneInString(msg)
+		}
+		parts = append(parts, msg[:i])
+		msg = msg[i:]
+	}
+	return append(parts, msg)
+}
+
+// runeBoundary returns the largest index <= i at which msg can be cut without
+// splitting a multi-byte character.
+func runeBoundary(msg string, i int) int {
+	for i > 0 && i < len(msg) && !utf8.RuneStart(msg[i]) {
+		i--
+	}
+	return i
+}
+
+func newCorrelationId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/go-loggly"
+	"github.com/stretchr/testify/assert"
+)
+
+func stackTrace() string {
+	var buf bytes.Buffer
+	buf.WriteString("ERROR test: oversize_test.go:17 panic: something bad: runtime error\n")
+	for i := 0; buf.Len() < 4096; i++ {
+		fmt.Fprintf(&buf, "github.com/getlantern/flashlight/fake.func%d(0x%x)\n\t/src/fake/file.go:%d +0x%x\n", i, i*16, i, i*32)
+	}
+	return buf.String()
+}
+
+func sentMessages(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var m map[string]interface{}
+		if assert.NoError(t, json.Unmarshal(scanner.Bytes(), &m), "Unmarshal error") {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func TestLogglyTruncateOversized(t *testing.T) {
+	var buf bytes.Buffer
+	client := loggly.New("token not required")
+	client.Writer = &buf
+	lw := &logglyErrorWriter{client: logglyClient{client}, maxMessageSize: 1000}
+
+	trace := stackTrace()
+	n, err := lw.Write([]byte(trace))
+	assert.NoError(t, err)
+	assert.Equal(t, len(trace), n)
+	msgs := sentMessages(t, &buf)
+	if assert.Len(t, msgs, 1) {
+		full := msgs[0]["fullMessage"].(string)
+		assert.Len(t, full, 1000)
+		assert.True(t, strings.HasSuffix(full, truncatedMarker), "truncated message should end with marker")
+		assert.Equal(t, "ERROR test", msgs[0]["locationInfo"])
+	}
+}
+
+func TestLogglySplitOversized(t *testing.T) {
+	var buf bytes.Buffer
+	client := loggly.New("token not required")
+	client.Writer = &buf
+	lw := &logglyErrorWriter{client: logglyClient{client}, maxMessageSize: 1000, oversizePolicy: SplitOversized}
+
+	trace := stackTrace()
+	_, err := lw.Write([]byte(trace))
+	assert.NoError(t, err)
+	msgs := sentMessages(t, &buf)
+	if !assert.Len(t, msgs, (len(trace)+999)/1000) {
+		return
+	}
+	var joined string
+	var correlationId string
+	for i, m := range msgs {
+		extra := m["extra"].(map[string]interface{})
+		if i == 0 {
+			correlationId = extra["correlationId"].(string)
+			assert.NotEmpty(t, correlationId)
+		}
+		assert.Equal(t, correlationId, extra["correlationId"], "all parts should share the correlation id")
+		assert.Equal(t, fmt.Sprintf("%d/%d", i+1, len(msgs)), extra["part"])
+		assert.Equal(t, msgs[0]["message"], m["message"], "all parts should be grouped together")
+		joined += m["fullMessage"].(string)
+	}
+	assert.Equal(t, trace, joined, "parts should add up to the original message")
+}
+
+func TestSplitMessageMultiByte(t *testing.T) {
+	parts := splitMessage("ééé", 3)
+	assert.Equal(t, []string{"é", "é", "é"}, parts)
+	assert.Equal(t, "é", truncateMessage("éé", 3))
+	assert.Equal(t, "a [truncated]", truncateMessage("abcdefghijklmnopq", 13))
+}
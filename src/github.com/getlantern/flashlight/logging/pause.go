@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// paused is 1 while output is paused, accessed atomically
+	paused int32
+
+	pauseMutex sync.Mutex
+	// pauseBuffer holds the lines held back while paused
+	pauseBuffer []heldLine
+	// pauseBuffered is the total size of the lines in pauseBuffer
+	pauseBuffered int
+	// pauseCap and pauseBypassErrors are the options in effect while paused
+	pauseCap          int
+	pauseBypassErrors bool
+
+	pausedLines uint64
+)
+
+type heldLine struct {
+	w io.Writer
+	p []byte
+	t time.Time
+}
+
+// Pause stops all output, including the log file and Loggly, until Resume is
+// called, e.g. while the screen is being shared. By default, lines logged
+// while paused are lost for good. With Options.PauseBufferSize, they're held
+// back and written out on Resume instead, up to that many bytes, after which
+// further lines are lost. Either way, lost lines are counted in
+// Statistics.PausedLines. With Options.PauseBypassErrors, errors are logged
+// even while paused.
+func Pause() {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	if atomic.LoadInt32(&paused) == 1 {
+		return
+	}
+	opts := currentOptions()
+	pauseCap = opts.PauseBufferSize
+	pauseBypassErrors = opts.PauseBypassErrors
+	atomic.StoreInt32(&paused, 1)
+}
+
+// Resume resumes output after Pause, first writing out the lines held back
+// while paused, if any.
+func Resume() {
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	// Write out held lines before unpausing so that they stay ahead of new
+	// lines, which wait for the mutex in held.
+	for _, line := range pauseBuffer {
+		writeTimed(line.w, line.p, line.t)
+	}
+	pauseBuffer = nil
+	pauseBuffered = 0
+	atomic.StoreInt32(&paused, 0)
+}
+
+// held tells whether the line is held back or dropped because output is
+// paused, in which case it must not be written to w.
+func held(w io.Writer, p []byte, t time.Time) bool {
+	if atomic.LoadInt32(&paused) == 0 {
+		return false
+	}
+	pauseMutex.Lock()
+	defer pauseMutex.Unlock()
+	if atomic.LoadInt32(&paused) == 0 {
+		return false
+	}
+	if pauseBypassErrors {
+		if level := levelOf(p); level == levelError || level == levelFatal {
+			return false
+		}
+	}
+	if pauseBuffered+len(p) > pauseCap {
+		atomic.AddUint64(&pausedLines, 1)
+		return true
+	}
+	pauseBuffer = append(pauseBuffer, heldLine{w, append([]byte(nil), p...), t})
+	pauseBuffered += len(p)
+	return true
+}
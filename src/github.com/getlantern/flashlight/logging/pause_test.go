@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseDiscard(t *testing.T) {
+	options = &Options{}
+	defer Resume()
+
+	var buf bytes.Buffer
+	w := &lineFilter{&buf}
+	before := Stats().PausedLines
+	Pause()
+	w.Write([]byte("DEBUG flashlight: a.go:1 secret\n"))
+	w.Write([]byte("ERROR flashlight: a.go:2 failed\n"))
+	Resume()
+	w.Write([]byte("DEBUG flashlight: a.go:3 resumed\n"))
+	assert.Equal(t, "DEBUG flashlight: a.go:3 resumed\n", buf.String())
+	assert.Equal(t, uint64(2), Stats().PausedLines-before)
+}
+
+func TestPauseBuffer(t *testing.T) {
+	options = &Options{PauseBufferSize: 64, PauseBypassErrors: true}
+	defer func() {
+		Resume()
+		options = &Options{}
+	}()
+
+	var buf bytes.Buffer
+	w := &lineFilter{&buf}
+	before := Stats().PausedLines
+	Pause()
+	w.Write([]byte("DEBUG flashlight: a.go:1 held\n"))
+	w.Write([]byte("ERROR flashlight: a.go:2 failed\n"))
+	w.Write([]byte("DEBUG flashlight: a.go:3 over the cap of the pause buffer\n"))
+	assert.Equal(t, "ERROR flashlight: a.go:2 failed\n", buf.String(), "errors should bypass the pause")
+	Resume()
+	assert.Equal(t, "ERROR flashlight: a.go:2 failed\nDEBUG flashlight: a.go:1 held\n", buf.String())
+	assert.Equal(t, uint64(1), Stats().PausedLines-before)
+}
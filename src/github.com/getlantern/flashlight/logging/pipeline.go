@@ -0,0 +1,182 @@
+package logging
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// stages holds the []*stage added with AddStage, in order. It's replaced
+	// rather than modified so that lines can run through it without locking.
+	stages      atomic.Value
+	stagesMutex sync.Mutex
+)
+
+func init() {
+	stages.Store([]*stage(nil))
+}
+
+// LogRecord is a line being logged, as seen by the stages added with
+// AddStage.
+type LogRecord struct {
+	// Time is when the line was logged. Changing it changes the timestamp
+	// the line is written with.
+	Time time.Time
+	// Level is the level, like ERROR. It's empty for lines that don't start
+	// with one, whose whole text is in Message.
+	Level string
+	// Logger is the golog logger name, like flashlight.proxy, if any.
+	Logger string
+	// Location is the file:line the line was logged at, if any.
+	Location string
+	// Message is the message, without the fields.
+	Message string
+	// Fields are the fields logged with Errorf and Debugf, nil if none.
+	Fields map[string]string
+}
+
+type stage struct {
+	fn func(rec LogRecord) (LogRecord, bool)
+}
+
+// AddStage adds fn to the stages that every line logged after Init goes
+// through before being written to any output, e.g. to rewrite or redact
+// messages or drop lines altogether by returning false. Stages run in the
+// order they were added, each getting the record returned by the previous
+// one, synchronously on the goroutine that logged the line, so they must be
+// safe for concurrent use and quick. Registered secrets are masked before
+// stages see a line. A line whose level is changed between ERROR or FATAL
+// and a more verbose level moves between the error and debug streams.
+// Calling the returned remove function removes the stage.
+func AddStage(fn func(rec LogRecord) (LogRecord, bool)) (remove func()) {
+	s := &stage{fn}
+	stagesMutex.Lock()
+	current := stages.Load().([]*stage)
+	stages.Store(append(current[:len(current):len(current)], s))
+	stagesMutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stagesMutex.Lock()
+			defer stagesMutex.Unlock()
+			current := stages.Load().([]*stage)
+			remaining := make([]*stage, 0, len(current))
+			for _, other := range current {
+				if other != s {
+					remaining = append(remaining, other)
+				}
+			}
+			stages.Store(remaining)
+		})
+	}
+}
+
+// stagedOutputs are the error and debug streams that lines continue to after
+// the stages.
+type stagedOutputs struct {
+	errorOut io.Writer
+	debugOut io.Writer
+}
+
+// stageRunner runs the lines written to it through the stages before passing
+// them on to its stream of outs.
+type stageRunner struct {
+	outs  *stagedOutputs
+	error bool
+}
+
+// runStages creates the writers running lines through the stages for the
+// given error and debug streams.
+func runStages(errOut io.Writer, dbgOut io.Writer) (io.Writer, io.Writer) {
+	outs := &stagedOutputs{errOut, dbgOut}
+	return &stageRunner{outs, true}, &stageRunner{outs, false}
+}
+
+func (w *stageRunner) stream() io.Writer {
+	if w.error {
+		return w.outs.errorOut
+	}
+	return w.outs.debugOut
+}
+
+func (w *stageRunner) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *stageRunner) writeAt(p []byte, t time.Time) (int, error) {
+	current := stages.Load().([]*stage)
+	if len(current) == 0 {
+		return writeTimed(w.stream(), p, t)
+	}
+	orig := parseRecord(string(p), t)
+	rec := orig
+	for _, s := range current {
+		var keep bool
+		if rec, keep = s.fn(rec); !keep {
+			return len(p), nil
+		}
+	}
+
+	out := w.stream()
+	if rec.Level != orig.Level {
+		if isErrorLevel(rec.Level) {
+			out = w.outs.errorOut
+		} else if isErrorLevel(orig.Level) {
+			out = w.outs.debugOut
+		}
+	}
+	line := rec.String()
+	if line == string(p) {
+		return writeTimed(out, p, rec.Time)
+	}
+	if _, err := writeTimed(out, []byte(line), rec.Time); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func isErrorLevel(level string) bool {
+	return level == levelError || level == levelFatal
+}
+
+// parseRecord parses a golog line logged at t into a LogRecord.
+func parseRecord(line string, t time.Time) LogRecord {
+	rec := LogRecord{Time: t}
+	rec.Level, rec.Logger, rec.Message = parseLine(line)
+	if rec.Level == "" {
+		return rec
+	}
+	rec.Message, rec.Fields = parseFields(rec.Message)
+	if rec.Logger != "" {
+		if i := strings.IndexByte(rec.Message, ' '); i > 0 && strings.IndexByte(rec.Message[:i], ':') > 0 {
+			rec.Location, rec.Message = rec.Message[:i], rec.Message[i+1:]
+		}
+	}
+	return rec
+}
+
+// String renders the record as a golog line, like
+// "ERROR flashlight.proxy: proxy.go:12 unable to dial {addr=1.2.3.4}\n".
+func (rec LogRecord) String() string {
+	var b strings.Builder
+	if rec.Level != "" {
+		b.WriteString(rec.Level)
+		b.WriteByte(' ')
+	}
+	if rec.Logger != "" {
+		b.WriteString(rec.Logger)
+		b.WriteString(": ")
+	}
+	if rec.Location != "" {
+		b.WriteString(rec.Location)
+		b.WriteByte(' ')
+	}
+	b.WriteString(rec.Message)
+	b.WriteString(formatFields(rec.Fields))
+	b.WriteByte('\n')
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecord(t *testing.T) {
+	line := "ERROR flashlight.proxy: proxy.go:12 unable to dial {addr=1.2.3.4}\n"
+	rec := parseRecord(line, time.Now())
+	assert.Equal(t, levelError, rec.Level)
+	assert.Equal(t, "flashlight.proxy", rec.Logger)
+	assert.Equal(t, "proxy.go:12", rec.Location)
+	assert.Equal(t, "unable to dial", rec.Message)
+	assert.Equal(t, map[string]string{"addr": "1.2.3.4"}, rec.Fields)
+	assert.Equal(t, line, rec.String())
+
+	for _, line := range []string{"panic: runtime error\n", "DEBUG no logger here\n"} {
+		assert.Equal(t, line, parseRecord(line, time.Now()).String(), "should round trip")
+	}
+}
+
+func TestStages(t *testing.T) {
+	var errBuf, dbgBuf bytes.Buffer
+	_, dbgOut := runStages(&errBuf, timestamped(&dbgBuf))
+
+	var order []string
+	removeFirst := AddStage(func(rec LogRecord) (LogRecord, bool) {
+		order = append(order, "first")
+		if strings.Contains(rec.Message, "drop") {
+			return rec, false
+		}
+		rec.Message = strings.Replace(rec.Message, "password", "[redacted]", -1)
+		if rec.Fields != nil {
+			rec.Fields["stage"] = "1"
+		}
+		return rec, true
+	})
+	removeSecond := AddStage(func(rec LogRecord) (LogRecord, bool) {
+		order = append(order, "second")
+		if strings.Contains(rec.Message, "[redacted]") {
+			rec.Level = levelError
+		}
+		if rec.Message == "backfilled" {
+			rec.Time = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+		}
+		return rec, true
+	})
+	defer removeSecond()
+
+	fmt.Fprint(dbgOut, "DEBUG test: a.go:1 please drop this\n")
+	assert.Equal(t, []string{"first"}, order, "should stop at the stage dropping the line")
+	assert.Equal(t, "", dbgBuf.String())
+
+	fmt.Fprint(dbgOut, "DEBUG test: a.go:2 bad password {user=x}\n")
+	assert.Equal(t, []string{"first", "first", "second"}, order, "should run stages in order")
+	assert.Equal(t, "ERROR test: a.go:2 bad [redacted] {stage=1 user=x}\n", errBuf.String(), "should move to the error stream")
+
+	fmt.Fprint(dbgOut, "DEBUG test: a.go:3 backfilled\n")
+	assert.Equal(t, timestampPrefix(time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC))+"DEBUG test: a.go:3 backfilled\n", dbgBuf.String())
+
+	removeFirst()
+	removeFirst()
+	dbgBuf.Reset()
+	fmt.Fprint(dbgOut, "DEBUG test: a.go:4 drop\n")
+	assert.True(t, strings.HasSuffix(dbgBuf.String(), "DEBUG test: a.go:4 drop\n"), "removed stage shouldn't run")
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/getlantern/golog"
+)
+
+// packageLogger is the logger returned by PackageLogger.
+var packageLogger = newBoundLogger("flashlight.logging")
+
+// PackageLogger returns a golog.Logger for flashlight.logging that writes
+// straight to the outputs set up by this package rather than through golog's
+// global outputs. Lines logged with it keep reaching the log file, the
+// console and Loggly even if another part of the app calls golog.SetOutputs,
+// which loggers from golog.LoggerFor would follow. Like golog's, TRACE lines
+// are only logged if the TRACE environment variable enables them. Before
+// Init, it logs to stderr and stdout.
+func PackageLogger() golog.Logger {
+	return packageLogger
+}
+
+// boundLogger is a golog.Logger writing to currentOutputs.
+type boundLogger struct {
+	prefix   string
+	traceOn  bool
+	traceOut io.Writer
+}
+
+func newBoundLogger(prefix string) *boundLogger {
+	l := &boundLogger{
+		prefix:   prefix,
+		traceOn:  golog.LoggerFor(prefix).IsTraceEnabled(),
+		traceOut: ioutil.Discard,
+	}
+	if l.traceOn {
+		l.traceOut = &traceWriter{l: l}
+	}
+	return l
+}
+
+// output writes a line at the given level with the location skip frames up
+// the stack, 1 being the caller of output.
+func (l *boundLogger) output(skip int, error bool, level string, msg string) {
+	location := "???:0"
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		location = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	outs := currentOutputs.Load().(outputs)
+	out := outs.debugOut
+	if error {
+		out = outs.errorOut
+	}
+	// Write the line at once, just like golog does
+	io.WriteString(out, fmt.Sprintf("%s %s: %s %s\n", level, l.prefix, location, msg))
+}
+
+func (l *boundLogger) Debug(arg interface{}) {
+	l.output(2, false, levelDebug, fmt.Sprint(arg))
+}
+
+func (l *boundLogger) Debugf(message string, args ...interface{}) {
+	l.output(2, false, levelDebug, fmt.Sprintf(message, args...))
+}
+
+func (l *boundLogger) Error(arg interface{}) {
+	l.output(2, true, levelError, fmt.Sprint(arg))
+}
+
+func (l *boundLogger) Errorf(message string, args ...interface{}) {
+	l.output(2, true, levelError, fmt.Sprintf(message, args...))
+}
+
+func (l *boundLogger) Fatal(arg interface{}) {
+	l.output(2, true, levelFatal, fmt.Sprint(arg))
+	os.Exit(1)
+}
+
+func (l *boundLogger) Fatalf(message string, args ...interface{}) {
+	l.output(2, true, levelFatal, fmt.Sprintf(message, args...))
+	os.Exit(1)
+}
+
+func (l *boundLogger) Trace(arg interface{}) {
+	if l.traceOn {
+		l.output(2, false, levelTrace, fmt.Sprint(arg))
+	}
+}
+
+func (l *boundLogger) Tracef(message string, args ...interface{}) {
+	if l.traceOn {
+		l.output(2, false, levelTrace, fmt.Sprintf(message, args...))
+	}
+}
+
+func (l *boundLogger) TraceOut() io.Writer {
+	return l.traceOut
+}
+
+func (l *boundLogger) IsTraceEnabled() bool {
+	return l.traceOn
+}
+
+func (l *boundLogger) AsStdLogger() *stdlog.Logger {
+	return stdlog.New(&stdErrorWriter{l}, "", 0)
+}
+
+// stdErrorWriter logs what's written by a standard logger as errors.
+type stdErrorWriter struct {
+	l *boundLogger
+}
+
+func (w *stdErrorWriter) Write(p []byte) (int, error) {
+	// Skip stdlog's Output and Print functions to get to their caller
+	w.l.output(4, true, levelError, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// traceWriter logs each line written to it at TRACE level, holding on to
+// incomplete lines until they're complete.
+type traceWriter struct {
+	l       *boundLogger
+	mutex   sync.Mutex
+	partial string
+}
+
+func (w *traceWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	lines := strings.Split(w.partial+string(p), "\n")
+	w.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		w.l.output(2, false, levelTrace, line)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageLogger(t *testing.T) {
+	var errBuf, dbgBuf bytes.Buffer
+	setGologOutputs(&errBuf, &dbgBuf)
+	defer resetGologOutputs()
+	// Another part of the app taking over golog
+	golog.SetOutputs(ioutil.Discard, ioutil.Discard)
+
+	l := PackageLogger()
+	l.Errorf("failed: %v", "timeout")
+	l.Debug("dialing")
+	l.AsStdLogger().Printf("from std")
+	assert.Regexp(t, `^ERROR flashlight.logging: pkglogger_test.go:\d+ failed: timeout\n`+
+		`ERROR flashlight.logging: pkglogger_test.go:\d+ from std\n$`, errBuf.String())
+	assert.Regexp(t, `^DEBUG flashlight.logging: pkglogger_test.go:\d+ dialing\n$`, dbgBuf.String())
+}
+
+func TestTraceWriter(t *testing.T) {
+	var dbgBuf bytes.Buffer
+	setGologOutputs(ioutil.Discard, &dbgBuf)
+	defer resetGologOutputs()
+
+	w := &traceWriter{l: newBoundLogger("test")}
+	w.Write([]byte("first\nsec"))
+	w.Write([]byte("ond\n"))
+	assert.Regexp(t, `^TRACE test: \S+:\d+ first\nTRACE test: \S+:\d+ second\n$`, dbgBuf.String())
+}
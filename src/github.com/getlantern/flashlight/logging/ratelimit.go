@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// rateLimitedLines counts the lines dropped because of Options.RateLimits
+	// by level
+	rateLimitedLines = map[string]*uint64{
+		levelTrace: new(uint64),
+		levelDebug: new(uint64),
+		levelInfo:  new(uint64),
+	}
+)
+
+// validateRateLimits checks that limits are only given for TRACE, DEBUG and
+// INFO, and that they're positive.
+func validateRateLimits(limits map[string]float64) error {
+	for level, limit := range limits {
+		if rateLimitedLines[level] == nil {
+			return fmt.Errorf("Invalid level for rate limit, must be one of TRACE, DEBUG or INFO: %v", level)
+		}
+		if limit <= 0 || math.IsNaN(limit) {
+			return fmt.Errorf("Invalid rate limit for %v, must be positive: %v", level, limit)
+		}
+	}
+	return nil
+}
+
+// tokenBucket allows up to rate lines per second on average, with bursts of
+// up to a second's worth.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	b.last = now
+	if max := math.Max(b.rate, 1); b.tokens > max {
+		b.tokens = max
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type rateLimiter struct {
+	io.Writer
+	now     func() time.Time
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// rateLimit creates a writer that drops lines exceeding the number of lines
+// per second given in limits for their level, counting them in
+// rateLimitedLines. Lines of other levels are all kept.
+func rateLimit(w io.Writer, limits map[string]float64) io.Writer {
+	if len(limits) == 0 {
+		return w
+	}
+	return newRateLimiter(w, limits, time.Now)
+}
+
+func newRateLimiter(w io.Writer, limits map[string]float64, now func() time.Time) *rateLimiter {
+	buckets := make(map[string]*tokenBucket, len(limits))
+	start := now()
+	for level, limit := range limits {
+		buckets[level] = &tokenBucket{rate: limit, tokens: math.Max(limit, 1), last: start}
+	}
+	return &rateLimiter{Writer: w, now: now, buckets: buckets}
+}
+
+func (w *rateLimiter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *rateLimiter) writeAt(p []byte, t time.Time) (int, error) {
+	level := levelOf(p)
+	if b := w.buckets[level]; b != nil {
+		w.mutex.Lock()
+		ok := b.take(w.now())
+		w.mutex.Unlock()
+		if !ok {
+			atomic.AddUint64(rateLimitedLines[level], 1)
+			return len(p), nil
+		}
+	}
+	return writeTimed(w.Writer, p, t)
+}
+
+// rateLimitedCounts returns the non-zero counts of rateLimitedLines.
+func rateLimitedCounts() map[string]uint64 {
+	counts := make(map[string]uint64)
+	for level, count := range rateLimitedLines {
+		if n := atomic.LoadUint64(count); n > 0 {
+			counts[level] = n
+		}
+	}
+	return counts
+}
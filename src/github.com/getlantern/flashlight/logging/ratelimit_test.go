@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRateLimits(t *testing.T) {
+	assert.NoError(t, validateRateLimits(nil))
+	assert.NoError(t, validateRateLimits(map[string]float64{levelDebug: 10, levelInfo: 0.5}))
+	assert.Error(t, validateRateLimits(map[string]float64{levelError: 10}), "should never limit errors")
+	assert.Error(t, validateRateLimits(map[string]float64{"debug": 10}))
+	assert.Error(t, validateRateLimits(map[string]float64{levelTrace: 0}))
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Now()
+	var buf bytes.Buffer
+	w := newRateLimiter(&buf, map[string]float64{levelDebug: 2}, func() time.Time { return now })
+	before := Stats().RateLimitedLines[levelDebug]
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("DEBUG test: a.go:1 chatty\n"))
+		w.Write([]byte("ERROR test: a.go:2 failed\n"))
+	}
+	assert.Equal(t, 2, strings.Count(buf.String(), "chatty"), "should allow a burst of a second's worth")
+	assert.Equal(t, 5, strings.Count(buf.String(), "failed"), "shouldn't limit other levels")
+	assert.Equal(t, uint64(3), Stats().RateLimitedLines[levelDebug]-before)
+
+	now = now.Add(500 * time.Millisecond)
+	w.Write([]byte("DEBUG test: a.go:1 chatty\n"))
+	w.Write([]byte("DEBUG test: a.go:1 chatty\n"))
+	assert.Equal(t, 3, strings.Count(buf.String(), "chatty"), "should refill at the given rate")
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var reconfigureMutex sync.Mutex
+
+// Reconfigure switches logging to the given Options at runtime, as if
+// initialized with them, but without losing lines: the new outputs, including
+// a new log file, are set up and swapped in at once, after which the old ones
+// are flushed and closed. If the Options are invalid, it returns an error and
+// logging carries on as before. Messages already written to loggly-debug.log
+// move to the new one right away, while the other settings for Loggly apply
+// from the next call to Configure, even with the same proxy. It returns
+// ErrNotInitialized before Init.
+func Reconfigure(opts Options) error {
+	reconfigureMutex.Lock()
+	defer reconfigureMutex.Unlock()
+	if currentLogFile() == nil {
+		return ErrNotInitialized
+	}
+	if err := validateOptions(&opts); err != nil {
+		return err
+	}
+	if opts.StrictLogDir && opts.FileOpener == nil {
+		logdir, _ := resolveLogDir(opts.LogDir)
+		if err := prepareLogDir(logdir); err != nil {
+			return err
+		}
+	}
+
+	oldOptions, oldStartTime := options, startTime
+	oldStarted, oldEnvironment := atomic.LoadInt32(&lifecycleStarted), atomic.LoadInt32(&environmentLogged)
+	oldLevel, oldDefaultLevel := atomic.LoadInt32(&minLevel), atomic.LoadInt32(&defaultLevel)
+	oldLogDir, oldFile, oldDebugFile, oldNDJSON := logDir, logFile, logglyDebugFile, ndjsonFile
+	oldThrottle, oldJournal, oldSocket := currentFileThrottle(), journal, socketOut
+	oldHeartbeat, oldFlusher, oldSweeper := heartbeatStop, flusherStop, sweeperStop
+	journal, socketOut = nil, nil
+	configMutex.Lock()
+	fileThrottle = nil
+	configMutex.Unlock()
+	ndjsonFile = nil
+	heartbeatStop, flusherStop, sweeperStop = nil, nil, nil
+
+	if err := initialize(&opts, true); err != nil {
+		// Nothing was swapped in yet
+		configMutex.Lock()
+		options, logDir, logFile, logglyDebugFile = oldOptions, oldLogDir, oldFile, oldDebugFile
+		fileThrottle = oldThrottle
+		configMutex.Unlock()
+		startTime = oldStartTime
+		atomic.StoreInt32(&lifecycleStarted, oldStarted)
+		atomic.StoreInt32(&environmentLogged, oldEnvironment)
+		atomic.StoreInt32(&minLevel, oldLevel)
+		atomic.StoreInt32(&defaultLevel, oldDefaultLevel)
+		ndjsonFile = oldNDJSON
+		journal, socketOut = oldJournal, oldSocket
+		heartbeatStop, flusherStop, sweeperStop = oldHeartbeat, oldFlusher, oldSweeper
+		restoreFileTags()
+		return err
+	}
+	// Keep what was set by Configure and the uptime
+	startTime = oldStartTime
+	atomic.StoreInt32(&lifecycleStarted, oldStarted)
+	atomic.StoreInt32(&environmentLogged, oldEnvironment)
+	restoreFileTags()
+	// Have the next call to Configure set up Loggly with the new Options
+	proxyMutex.Lock()
+	lastAddr, lastDebugOnly = "", false
+	proxyMutex.Unlock()
+
+	for _, stop := range []chan struct{}{oldHeartbeat, oldFlusher, oldSweeper} {
+		if stop != nil {
+			close(stop)
+		}
+	}
+	if oldThrottle != nil {
+		oldThrottle.stop()
+	}
+	for _, c := range []io.Closer{oldJournal, oldSocket} {
+		if c != nil {
+			c.Close()
+		}
+	}
+	for _, r := range []*sizeRotator{oldDebugFile, oldNDJSON, oldFile} {
+		if r != nil {
+			r.Close()
+		}
+	}
+	return nil
+}
+
+// restoreFileTags sets the instance id and proxy address included in the log
+// file from what was last passed to Configure.
+func restoreFileTags() {
+	if options.InstanceIdInFile {
+		fileInstanceId.Store(instanceIdValue.Load().(string))
+	}
+	if options.ProxyAddrInFile {
+		proxyMutex.RLock()
+		addr := proxyAddr
+		proxyMutex.RUnlock()
+		fileProxyAddr.Store(proxyTag(addr, options.RedactProxyAddr))
+	}
+}
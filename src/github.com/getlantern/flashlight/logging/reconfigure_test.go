@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconfigure(t *testing.T) {
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+	logFile = nil
+	assert.Equal(t, ErrNotInitialized, Reconfigure(Options{}))
+
+	files := make(map[string]*memFile)
+	opener := func(path string) (io.WriteCloser, error) {
+		f := &memFile{}
+		files[path] = f
+		return f, nil
+	}
+	dir1 := filepath.Join(os.TempDir(), "lantern-memory-logs")
+	dir2 := filepath.Join(os.TempDir(), "lantern-other-memory-logs")
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir1, FileOpener: opener})) {
+		return
+	}
+	defer Close()
+	var remoteBuf syncBuffer
+	addLoggly(&remoteBuf)
+	defer removeLoggly()
+
+	l := golog.LoggerFor("test")
+	l.Error("before")
+	assert.NoError(t, Reconfigure(Options{LogDir: dir2, Format: FormatJSON, FileOpener: opener}))
+	l.Error("after")
+
+	assert.Error(t, Reconfigure(Options{LogDir: dir1, Level: "bogus", FileOpener: opener}))
+	assert.Error(t, Reconfigure(Options{LogDir: "relative", FileOpener: opener}))
+	l.Error("still")
+
+	first, second := files[filepath.Join(dir1, logFileName)], files[filepath.Join(dir2, logFileName)]
+	if assert.NotNil(t, first) && assert.NotNil(t, second) {
+		assert.Contains(t, first.String(), "before")
+		assert.NotContains(t, first.String(), "after")
+		assert.True(t, first.closed, "should close the old log file")
+		assert.Contains(t, second.String(), `"msg":`, "should use the new format")
+		assert.Contains(t, second.String(), "after")
+		assert.Contains(t, second.String(), "still", "should keep the config when the new one is invalid")
+		assert.False(t, second.closed)
+	}
+	assert.Contains(t, remoteBuf.String(), "after", "should keep sending to remotes")
+	assert.Contains(t, remoteBuf.String(), "still")
+}
+
+func TestReconfigureLogglyDebug(t *testing.T) {
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+		lastAddr, lastDebugOnly = "", false
+	}()
+	files := make(map[string]*memFile)
+	opener := func(path string) (io.WriteCloser, error) {
+		f := &memFile{}
+		files[path] = f
+		return f, nil
+	}
+	dir1 := filepath.Join(os.TempDir(), "lantern-memory-logs")
+	dir2 := filepath.Join(os.TempDir(), "lantern-other-memory-logs")
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir1, FileOpener: opener, LogglyDebug: LogglyDebugOnly})) {
+		return
+	}
+	defer Close()
+	enableLoggly("", "", nil, "instance", "1.0.0", "today", BuildInfo{})
+	defer removeLoggly()
+	lw, ok := activeLoggly().(*logglyErrorWriter)
+	if !assert.True(t, ok) {
+		return
+	}
+	lastAddr, lastDebugOnly = "127.0.0.1:8787", true
+
+	lw.Write([]byte("ERROR flashlight: a.go:1 before\n"))
+	assert.NoError(t, Reconfigure(Options{LogDir: dir2, FileOpener: opener, LogglyDebug: LogglyDebugOnly}))
+	lw.Write([]byte("ERROR flashlight: a.go:1 after\n"))
+
+	first, second := files[filepath.Join(dir1, "loggly-debug.log")], files[filepath.Join(dir2, "loggly-debug.log")]
+	if assert.NotNil(t, first) && assert.NotNil(t, second) {
+		assert.Contains(t, first.String(), "before")
+		assert.True(t, first.closed, "should close the old loggly-debug.log")
+		assert.Contains(t, second.String(), "after", "should write to the new loggly-debug.log")
+		assert.False(t, second.closed)
+	}
+	assert.Equal(t, "", lastAddr, "should set up Loggly again on the next call to Configure")
+	assert.False(t, lastDebugOnly, "should set up Loggly again on the next call to Configure")
+}
+
+func TestReconfigureWhileLogging(t *testing.T) {
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		options = &Options{}
+	}()
+	opener := func(path string) (io.WriteCloser, error) {
+		return &memFile{}, nil
+	}
+	dir := filepath.Join(os.TempDir(), "lantern-memory-logs")
+	if !assert.NoError(t, InitWithOptions(&Options{LogDir: dir, FileOpener: opener})) {
+		return
+	}
+	defer Close()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l := golog.LoggerFor("test")
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			l.Error("logging during reconfiguration")
+			l.Debug("logging during reconfiguration")
+			Flush()
+			drainQueues()
+			Stats()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		opts := Options{LogDir: dir, FileOpener: opener, OrderedOutput: i%2 == 0, GoroutineIds: i%3 == 0, FileBytesPerSecond: 1000000 * (i % 2)}
+		assert.NoError(t, Reconfigure(opts))
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/getlantern/flashlight/util"
+)
+
+const (
+	logglyRemote = "loggly"
+)
+
+var (
+	errNoProxy = errors.New("No known proxy")
+
+	remotes      = make(map[string]io.Writer)
+	remotesMutex sync.RWMutex
+)
+
+// setRemote adds a named writer that receives the error stream alongside the
+// local outputs, replacing any writer previously set under the same name, and
+// applies the resulting outputs to golog. A nil writer removes the remote.
+// Each remote can be toggled with SetDestinationEnabled under its name.
+func setRemote(name string, w io.Writer) {
+	remotesMutex.Lock()
+	if w == nil {
+		delete(remotes, name)
+	} else {
+		remotes[name] = w
+	}
+	remotesMutex.Unlock()
+	applyRemotes()
+}
+
+// applyRemotes applies the local outputs along with the remotes to golog.
+func applyRemotes() {
+	remotesMutex.RLock()
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writers := make([]io.Writer, 0, len(names))
+	for _, name := range names {
+		writers = append(writers, gated(name, remotes[name]))
+	}
+	remotesMutex.RUnlock()
+	setOutputs(outputsWithRemotes(runtime.GOOS, writers))
+}
+
+// remote returns the remote writer with the given name, or nil if there's
+// none.
+func remote(name string) io.Writer {
+	remotesMutex.RLock()
+	defer remotesMutex.RUnlock()
+	return remotes[name]
+}
+
+// outputsWithRemotes returns the error and debug outputs to use on the given
+// platform when sending errors to the given remote writers. Either way, remote
+// writers receive the raw golog lines and are themselves responsible for any
+// timestamp (see LogglyTimestampMode).
+func outputsWithRemotes(goos string, writers []io.Writer) (io.Writer, io.Writer) {
+	errorOut, debugOut := localOutputs()
+	if len(writers) == 0 {
+		return errorOut, debugOut
+	}
+	if goos == "android" {
+		if len(writers) == 1 {
+			return writers[0], os.Stdout
+		}
+		return NonStopWriter(writers...), os.Stdout
+	}
+	return NonStopWriter(append([]io.Writer{errorOut}, writers...)...), debugOut
+}
+
+// proxiedHTTPClient returns the HTTP client given to ConfigureWithHTTPClient or
+// creates one going through the proxy last passed to Configure, or returns
+// errNoProxy if there isn't one yet.
+func proxiedHTTPClient() (*http.Client, error) {
+	proxyMutex.RLock()
+	addr, ca, client := proxyAddr, proxyCA, proxyClient
+	proxyMutex.RUnlock()
+	if client != nil {
+		return client, nil
+	}
+	if addr == "" {
+		return nil, errNoProxy
+	}
+	return util.PersistentHTTPClient(ca, addr)
+}
+
+// SetExitCountry sets the country, like "DE", where the proxy currently in
+// use exits to the internet, to be sent along with Loggly messages as
+// extra.exitCountry. Call it whenever the proxy changes, with "" if the
+// country isn't known.
+func SetExitCountry(country string) {
+	proxyMutex.Lock()
+	exitCountry = country
+	proxyMutex.Unlock()
+}
+
+func currentExitCountry() string {
+	proxyMutex.RLock()
+	defer proxyMutex.RUnlock()
+	return exitCountry
+}
+
+// proxyTag returns the proxy address as included in logs, with the host
+// replaced by a hash of it if redact is set, so that lines
+// from the same proxy can still be correlated.
+func proxyTag(addr string, redact bool) string {
+	if !redact || addr == "" {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	sum := sha256.Sum256([]byte(host))
+	tag := hex.EncodeToString(sum[:])[:12]
+	if port != "" {
+		tag += ":" + port
+	}
+	return tag
+}
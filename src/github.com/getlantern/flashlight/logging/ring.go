@@ -0,0 +1,201 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRecentLogsSize = 200
+
+	// defaultContextLines is the default for Options.LogglyContextLines
+	defaultContextLines = 5
+
+	// maxContextSize bounds the size of the context sent with errors
+	maxContextSize = 2048
+
+	// MissedLinesMarker is returned as the first line by RecentLogsSince when
+	// some of the lines following the requested sequence have already been
+	// evicted from the buffer.
+	MissedLinesMarker = "[some log lines were missed]"
+)
+
+var (
+	recentLogs = newLineRing(defaultRecentLogsSize)
+)
+
+// RecentLogs returns the most recently logged lines, oldest first.
+func RecentLogs() []string {
+	lines, _ := recentLogs.since(0)
+	return lines
+}
+
+// RecentLogsSince returns the buffered lines logged after the line with
+// sequence number seq, along with the sequence number of the last line
+// logged, which can be passed to the next call to only get new lines. Pass 0
+// to get all buffered lines. If lines following seq have already been evicted
+// from the buffer, the first line returned is MissedLinesMarker.
+func RecentLogsSince(seq uint64) ([]string, uint64) {
+	return recentLogs.since(seq)
+}
+
+// lineRing is a fixed-size ring of lines, each tagged with a monotonically
+// increasing sequence number starting at 1.
+type lineRing struct {
+	lines   []string
+	lastSeq uint64
+	// bytes is the size of the lines held, updated with the mutex held and
+	// read atomically
+	bytes int64
+	mutex sync.Mutex
+}
+
+func newLineRing(size int) *lineRing {
+	return &lineRing{lines: make([]string, size)}
+}
+
+// reset clears the ring and changes its size. Sequence numbers keep
+// increasing so that pollers notice the gap.
+func (r *lineRing) reset(size int) {
+	r.mutex.Lock()
+	r.lines = make([]string, size)
+	atomic.StoreInt64(&r.bytes, 0)
+	r.mutex.Unlock()
+}
+
+func (r *lineRing) add(line string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.lines) == 0 {
+		return
+	}
+	r.lastSeq++
+	i := r.lastSeq % uint64(len(r.lines))
+	atomic.AddInt64(&r.bytes, int64(len(line)-len(r.lines[i])))
+	r.lines[i] = line
+}
+
+// trim evicts the oldest lines until at least n bytes are freed or the ring
+// is empty, returning the number of bytes freed.
+func (r *lineRing) trim(n int64) int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	size := uint64(len(r.lines))
+	if size == 0 {
+		return 0
+	}
+	first := uint64(1)
+	if r.lastSeq > size {
+		first = r.lastSeq - size + 1
+	}
+	var freed int64
+	for s := first; s <= r.lastSeq && freed < n; s++ {
+		freed += int64(len(r.lines[s%size]))
+		r.lines[s%size] = ""
+	}
+	atomic.AddInt64(&r.bytes, -freed)
+	return freed
+}
+
+func (r *lineRing) since(seq uint64) ([]string, uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	size := uint64(len(r.lines))
+	if seq >= r.lastSeq || size == 0 {
+		return []string{}, r.lastSeq
+	}
+	first := uint64(1)
+	if r.lastSeq > size {
+		first = r.lastSeq - size + 1
+	}
+	// Room for the buffered lines and MissedLinesMarker, however long ago seq
+	// was
+	n := r.lastSeq - seq
+	if n > size {
+		n = size
+	}
+	result := make([]string, 0, n+1)
+	if seq > 0 && seq+1 < first {
+		result = append(result, MissedLinesMarker)
+	}
+	if seq+1 > first {
+		first = seq + 1
+	}
+	for s := first; s <= r.lastSeq; s++ {
+		if line := r.lines[s%size]; line != "" {
+			result = append(result, line)
+		}
+	}
+	return result, r.lastSeq
+}
+
+// last returns up to the n most recent lines, oldest first.
+func (r *lineRing) last(n int) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	size := uint64(len(r.lines))
+	if n <= 0 || size == 0 {
+		return nil
+	}
+	if uint64(n) > size {
+		n = int(size)
+	}
+	if uint64(n) > r.lastSeq {
+		n = int(r.lastSeq)
+	}
+	result := make([]string, 0, n)
+	for s := r.lastSeq - uint64(n) + 1; s <= r.lastSeq; s++ {
+		if line := r.lines[s%size]; line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// context returns up to n lines preceding line from the ring, joined with
+// newlines and capped to maxContextSize by leaving out the oldest ones. line
+// itself is left out if it was already added to the ring.
+func (r *lineRing) context(line string, n int) string {
+	lines := r.last(n + 1)
+	if len(lines) > 0 && strings.HasSuffix(lines[len(lines)-1], strings.TrimRight(line, "\r\n")) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	size := 0
+	first := len(lines)
+	for first > 0 && size+len(lines[first-1])+1 <= maxContextSize {
+		first--
+		size += len(lines[first]) + 1
+	}
+	return strings.Join(lines[first:], "\n")
+}
+
+type lineRecorder struct {
+	io.Writer
+	r *lineRing
+}
+
+// recordLines creates a writer that adds each line written to it, timestamped,
+// to the given ring before passing it on to w.
+func recordLines(w io.Writer, r *lineRing) io.Writer {
+	return &lineRecorder{w, r}
+}
+
+func (w *lineRecorder) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *lineRecorder) writeAt(p []byte, t time.Time) (int, error) {
+	line := appendTimestampPrefix(make([]byte, 0, timestampPrefixLen+len(p)), t.In(time.UTC))
+	line = append(line, bytes.TrimRight(p, "\r\n")...)
+	w.r.add(string(line))
+	checkBufferBudget()
+	return writeTimed(w.Writer, p, t)
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentLogsSince(t *testing.T) {
+	r := newLineRing(3)
+	lines, seq := r.since(0)
+	assert.Empty(t, lines)
+	assert.Equal(t, uint64(0), seq)
+
+	r.add("a")
+	r.add("b")
+	lines, seq = r.since(0)
+	assert.Equal(t, []string{"a", "b"}, lines)
+	assert.Equal(t, uint64(2), seq)
+
+	lines, seq = r.since(seq)
+	assert.Empty(t, lines, "nothing new")
+	assert.Equal(t, uint64(2), seq)
+
+	r.add("c")
+	lines, seq = r.since(seq)
+	assert.Equal(t, []string{"c"}, lines, "should only get new lines")
+	assert.Equal(t, uint64(3), seq)
+
+	r.add("d")
+	lines, seq = r.since(seq)
+	assert.Equal(t, []string{"d"}, lines, "should handle wraparound")
+	assert.Equal(t, uint64(4), seq)
+
+	for _, l := range []string{"e", "f", "g", "h"} {
+		r.add(l)
+	}
+	lines, seq = r.since(seq)
+	assert.Equal(t, []string{MissedLinesMarker, "f", "g", "h"}, lines, "should report evicted lines")
+	assert.Equal(t, uint64(8), seq)
+
+	lines, _ = r.since(0)
+	assert.Equal(t, []string{"f", "g", "h"}, lines, "no gap when fetching everything")
+
+	for i := 0; i < 1000; i++ {
+		r.add("x")
+	}
+	lines, _ = r.since(0)
+	assert.True(t, cap(lines) <= 4, "shouldn't allocate for evicted lines, got capacity %d", cap(lines))
+}
+
+func TestRecordLines(t *testing.T) {
+	r := newLineRing(10)
+	w := recordLines(ioutil.Discard, r)
+	fmt.Fprintln(w, "DEBUG test: ring_test.go:1 hello")
+	lines, _ := r.since(0)
+	if assert.Len(t, lines, 1) {
+		assert.Regexp(t, ` - DEBUG test: ring_test.go:1 hello$`, lines[0])
+	}
+}
+
+func TestLineRingContext(t *testing.T) {
+	r := newLineRing(10)
+	assert.Equal(t, "", r.context("ERROR x: a.go:1 failed\n", 5))
+	for _, line := range []string{"one", "two", "three", "four"} {
+		r.add("ts - " + line)
+	}
+	assert.Equal(t, []string{"ts - three", "ts - four"}, r.last(2))
+	assert.Equal(t, []string{"ts - one", "ts - two", "ts - three", "ts - four"}, r.last(20))
+	assert.Equal(t, "ts - two\nts - three\nts - four", r.context("ERROR x: a.go:1 failed\n", 3))
+
+	r.add("ts - ERROR x: a.go:1 failed")
+	assert.Equal(t, "ts - three\nts - four", r.context("ERROR x: a.go:1 failed\n", 2), "should leave out the error itself")
+
+	r.add("ts - " + strings.Repeat("x", maxContextSize))
+	assert.Equal(t, "", r.context("ERROR x: a.go:2 failed\n", 5), "should cap the context size")
+}
+
+func TestLogglyContext(t *testing.T) {
+	r := newLineRing(10)
+	r.add("ts - DEBUG x: a.go:1 dialing")
+	r.add("ts - ERROR x: a.go:2 failed")
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender, context: r, contextLines: 5}
+	lw.Write([]byte("ERROR x: a.go:2 failed\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 1) {
+		assert.Equal(t, "ts - DEBUG x: a.go:1 dialing", msgs[0]["extra"].(map[string]string)["context"])
+	}
+}
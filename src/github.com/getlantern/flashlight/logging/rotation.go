@@ -0,0 +1,729 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	compressedExt = ".gz"
+
+	// adaptiveRotationPeriod is how long a file should roughly last with an
+	// adaptive rotation size. Files filling up faster make the size double,
+	// files lasting over 4 times longer make it halve.
+	adaptiveRotationPeriod = 1 * time.Hour
+
+	// fileCheckInterval is how often the file is checked for having been
+	// truncated, renamed or removed externally
+	fileCheckInterval = 5 * time.Second
+)
+
+var (
+	// rotateCallback holds the func(string) passed to OnRotate
+	rotateCallback atomic.Value
+)
+
+// OnRotate sets a callback invoked after each rotation of the main log file
+// with the path of the file that was just rotated out, e.g. to ship it right
+// away. It's invoked on its own goroutine so that it can't block logging,
+// which also means that by the time it runs, further rotations may have
+// renamed the file (lantern.log.1 becoming lantern.log.2 and so on) or, with
+// Options.CompressRotated, replaced it with its compressed version. Passing
+// nil removes the callback.
+//
+// With Options.RotatedKeepExtension, rotated files are named lantern.1.log,
+// lantern.2.log and so on instead.
+func OnRotate(callback func(closedPath string)) {
+	if callback == nil {
+		callback = func(string) {}
+	}
+	rotateCallback.Store(callback)
+}
+
+// rotated invokes the callback set with OnRotate.
+func rotated(closedPath string) {
+	if callback, ok := rotateCallback.Load().(func(string)); ok {
+		go callback(closedPath)
+	}
+}
+
+// sizeRotator is a file writer that rotates its file once it would exceed
+// RotationSize, keeping up to MaxRotation rotated files named path.1, path.2
+// and so on, path.1 being the most recent. It is modeled after
+// rotator.SizeRotator, with the addition of optionally gzip compressing
+// rotated files (path.1.gz, path.2.gz ...).
+type sizeRotator struct {
+	path      string
+	totalSize int64
+	file      io.WriteCloser
+	buf       *bufio.Writer
+	gz        *gzip.Writer
+	mutex     sync.Mutex
+	// size is the effective rotation size, accessed atomically
+	size int64
+	// openedAt is when the current file was started
+	openedAt time.Time
+	// checkedAt is when the current file was last checked by checkFile
+	checkedAt time.Time
+	// closed is set by Close
+	closed bool
+	// errs are the errors to report once the mutex is released, see unlock
+	errs []error
+	// compressed, while a rotated file is being compressed in the
+	// background, is closed once it's done. Files aren't moved around or
+	// deleted meanwhile, see awaitCompression.
+	compressed chan struct{}
+	// writeErr is the error of the last write or flush, nil if it succeeded
+	writeErr error
+	// date and part identify the current file when Dated is set
+	date string
+	part int
+	// now returns the current time, which determines the date when Dated is
+	// set
+	now func() time.Time
+	// open opens the file at the given path for appending, creating it if
+	// needed
+	open func(path string) (io.WriteCloser, error)
+
+	// RotationSize is the size threshold that causes rotation
+	RotationSize int64
+	// MaxRotation is the maximum number of rotated files kept
+	MaxRotation int
+	// Compress enables gzip compression of rotated files. Compression happens
+	// in the background after the rotation, so that writes don't wait for it.
+	// The next rotation, Sweep and Close wait for it to be done.
+	Compress bool
+	// CompressLevel is the gzip level used when compressing
+	CompressLevel int
+	// BufferSize, if positive, buffers writes to the file in memory. Buffered
+	// data is written out by Flush, on rotation and on Close.
+	BufferSize int
+	// MaxRotationSize, if greater than RotationSize, makes the rotation size
+	// adaptive between RotationSize and MaxRotationSize depending on how fast
+	// files fill up, so that busy hosts keep fewer, larger files.
+	MaxRotationSize int64
+	// OnRotate, if set, is called after each rotation with the path of the
+	// file that was rotated out, once it's compressed if Compress is set.
+	OnRotate func(closedPath string)
+	// MaxAge, if positive, is how long rotated files are kept, based on their
+	// modification time. Older ones are deleted by Sweep and on rotation.
+	MaxAge time.Duration
+
+	// LiveCompress writes the current file gzip compressed as path.gz, with
+	// rotated files named path.1.gz and so on, and RotationSize applying to
+	// the compressed size. Compressed data only reaches the file when
+	// flushed, so Flush should be called periodically to limit what's lost
+	// on a crash. Each time the file is opened, a new gzip member is
+	// appended, which gzip readers handle transparently.
+	LiveCompress bool
+	// Dated writes to a file per UTC day instead of path, see
+	// RotateByDateAndSize. MaxRotation and MaxAge apply to the dated files.
+	Dated bool
+	// Checksums writes a sidecar with the line count and SHA-256 of each
+	// completed file, see writeChecksum.
+	Checksums bool
+	// KeepExtension numbers rotated files before the extension of path
+	// instead of after it, e.g. test.1.log rather than test.log.1.
+	KeepExtension bool
+
+	// Header, if set, returns a line written at the start of each new file
+	// and when first opening an existing one
+	Header func() string
+
+	// writeLatency and rotationLatency, if set, record how long writes to the
+	// file and rotations take
+	writeLatency    *latencyHistogram
+	rotationLatency *latencyHistogram
+}
+
+// openLogFiles is the number of files currently open by rotators
+var openLogFiles int64
+
+var (
+	// rotationErrors is the number of errors rotators had deleting,
+	// compressing or checksumming rotated files
+	rotationErrors uint64
+
+	// rotationErrorOut is where rotators report those errors. They can't log
+	// them, since log lines are written through the rotator, possibly with
+	// its lock or that of the writer in front of it held.
+	rotationErrorOut io.Writer = os.Stderr
+)
+
+// reportRotationErrors counts and reports the given errors to
+// rotationErrorOut.
+func reportRotationErrors(errs ...error) {
+	for _, err := range errs {
+		atomic.AddUint64(&rotationErrors, 1)
+		fmt.Fprintf(rotationErrorOut, "%s flashlight.logging: %v\n", levelError, err)
+	}
+}
+
+func newSizeRotator(path string) *sizeRotator {
+	return &sizeRotator{
+		path:          path,
+		RotationSize:  1 * 1024 * 1024,
+		MaxRotation:   20,
+		CompressLevel: gzip.DefaultCompression,
+		now:           time.Now,
+		open:          openLogFile,
+	}
+}
+
+// openLogFile opens the file at path for appending, creating it if needed.
+func openLogFile(path string) (io.WriteCloser, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+}
+
+// statter is implemented by files that can tell their size, like *os.File.
+type statter interface {
+	Stat() (os.FileInfo, error)
+}
+
+// unlock releases the mutex, then reports the errors collected while it was
+// held.
+func (r *sizeRotator) unlock() {
+	errs := r.errs
+	r.errs = nil
+	r.mutex.Unlock()
+	reportRotationErrors(errs...)
+}
+
+// Write writes to the current file, rotating it first if p would make it
+// exceed RotationSize.
+func (r *sizeRotator) Write(p []byte) (n int, err error) {
+	r.mutex.Lock()
+	defer r.unlock()
+	defer func() {
+		r.writeErr = err
+	}()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if r.Dated {
+		r.checkDate()
+	}
+	if r.file == nil {
+		if stat, _ := os.Lstat(r.activePath()); stat != nil {
+			r.totalSize = stat.Size()
+		}
+	} else if time.Since(r.checkedAt) >= fileCheckInterval {
+		r.checkFile()
+	}
+
+	if r.totalSize+int64(len(p)) > r.rotationSize() {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.file == nil {
+		// Waiting for compression may have let Close in
+		if r.closed {
+			return 0, ErrClosed
+		}
+		r.file, err = r.open(r.activePath())
+		if err != nil {
+			return 0, err
+		}
+		atomic.AddInt64(&openLogFiles, 1)
+		r.totalSize = 0
+		if f, ok := r.file.(statter); ok {
+			if stat, _ := f.Stat(); stat != nil {
+				r.totalSize = stat.Size()
+			}
+		}
+		firstOpen := r.openedAt.IsZero()
+		if firstOpen {
+			r.openedAt = time.Now()
+		}
+		r.checkedAt = time.Now()
+		if r.LiveCompress {
+			r.gz, _ = gzip.NewWriterLevel(&compressedCounter{r}, r.CompressLevel)
+		} else if r.BufferSize > 0 {
+			r.buf = bufio.NewWriterSize(r.file, r.BufferSize)
+		}
+		if r.Header != nil && (firstOpen || r.totalSize == 0) {
+			r.writeHeader()
+		}
+	}
+
+	start := time.Now()
+	n, err = r.write(p)
+	if r.writeLatency != nil {
+		r.writeLatency.since(start)
+	}
+	return n, err
+}
+
+// write writes p to the open file, through the buffer or gzip writer if any,
+// counting its size. It must be called with the mutex held.
+func (r *sizeRotator) write(p []byte) (n int, err error) {
+	switch {
+	case r.gz != nil:
+		// compressedCounter counts the compressed bytes instead
+		return r.gz.Write(p)
+	case r.buf != nil:
+		n, err = r.buf.Write(p)
+	default:
+		n, err = r.file.Write(p)
+	}
+	r.totalSize += int64(n)
+	return n, err
+}
+
+// compressedCounter writes compressed data to the current file, counting it
+// towards its size.
+type compressedCounter struct {
+	r *sizeRotator
+}
+
+func (c *compressedCounter) Write(p []byte) (int, error) {
+	n, err := c.r.file.Write(p)
+	c.r.totalSize += int64(n)
+	return n, err
+}
+
+// activePath returns the path of the current file.
+func (r *sizeRotator) activePath() string {
+	path := r.path
+	if r.Dated {
+		path = r.datedPath(r.date, r.part)
+	}
+	if r.LiveCompress {
+		path += compressedExt
+	}
+	return path
+}
+
+// currentPath returns the path of the current file, safely while the rotator
+// is in use.
+func (r *sizeRotator) currentPath() string {
+	r.mutex.Lock()
+	defer r.unlock()
+	if r.Dated && r.date == "" {
+		r.checkDate()
+	}
+	return r.activePath()
+}
+
+// writeHeader writes the Header line. It must be called with the mutex held
+// and the file open.
+func (r *sizeRotator) writeHeader() {
+	r.write([]byte(r.Header()))
+}
+
+// SetRotationSize changes RotationSize while the rotator is in use. It takes
+// effect with the next write, which rotates the current file first if it's
+// already larger. Any adaptive size starts over from n.
+func (r *sizeRotator) SetRotationSize(n int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.RotationSize = n
+	atomic.StoreInt64(&r.size, 0)
+}
+
+// currentRotationSize returns the effective rotation size, safely while the
+// rotator is in use.
+func (r *sizeRotator) currentRotationSize() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rotationSize()
+}
+
+// currentSize returns the size of the current file, including what's still
+// buffered, and the size at which it will be rotated.
+func (r *sizeRotator) currentSize() (size int64, rotationSize int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.totalSize, r.rotationSize()
+}
+
+// bytesUntilRotation returns how many bytes can be written before the file
+// is rotated, checking the size of the file on disk if it isn't open yet.
+func (r *sizeRotator) bytesUntilRotation() (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if r.Dated {
+		return 0, ErrTimeBasedRotation
+	}
+	size := r.totalSize
+	if r.file == nil {
+		size = 0
+		if stat, _ := os.Lstat(r.activePath()); stat != nil {
+			size = stat.Size()
+		}
+	}
+	left := r.rotationSize() - size
+	if left < 0 {
+		left = 0
+	}
+	return left, nil
+}
+
+// rotationSize returns the effective rotation size.
+func (r *sizeRotator) rotationSize() int64 {
+	size := atomic.LoadInt64(&r.size)
+	if size == 0 {
+		return r.RotationSize
+	}
+	return size
+}
+
+// adaptRotationSize adjusts the effective rotation size based on how long the
+// file being rotated lasted. It must be called with the mutex held.
+func (r *sizeRotator) adaptRotationSize(now time.Time) {
+	if r.MaxRotationSize <= r.RotationSize || r.openedAt.IsZero() {
+		return
+	}
+	size := r.rotationSize()
+	lasted := now.Sub(r.openedAt)
+	switch {
+	case lasted < adaptiveRotationPeriod:
+		size *= 2
+	case lasted > 4*adaptiveRotationPeriod:
+		size /= 2
+	}
+	if size > r.MaxRotationSize {
+		size = r.MaxRotationSize
+	}
+	if size < r.RotationSize {
+		size = r.RotationSize
+	}
+	atomic.StoreInt64(&r.size, size)
+}
+
+// checkFile notices if the current file was externally renamed or removed, in
+// which case it's closed so that the next write reopens path, or truncated, in
+// which case the size is updated. The file is opened with O_APPEND so writes
+// after a truncation still go to its end. Files that can't tell their size
+// aren't checked. It must be called with the mutex held.
+func (r *sizeRotator) checkFile() {
+	r.checkedAt = time.Now()
+	f, ok := r.file.(statter)
+	if !ok {
+		return
+	}
+	current, err := f.Stat()
+	if err != nil {
+		return
+	}
+	stat, err := os.Stat(r.activePath())
+	if err != nil || !os.SameFile(current, stat) {
+		r.closeFile()
+		r.totalSize = 0
+		if stat != nil {
+			r.totalSize = stat.Size()
+		}
+		return
+	}
+	if size := stat.Size(); size < r.totalSize-r.buffered() {
+		r.totalSize = size + r.buffered()
+	}
+}
+
+// buffered returns the number of bytes written but not yet flushed.
+func (r *sizeRotator) buffered() int64 {
+	if r.buf == nil {
+		return 0
+	}
+	return int64(r.buf.Buffered())
+}
+
+// Flush writes out any buffered data to the file. It doesn't fsync.
+func (r *sizeRotator) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	err := r.flush()
+	r.writeErr = err
+	return err
+}
+
+// status returns the error of the last write or flush, or ErrClosed after
+// Close.
+func (r *sizeRotator) status() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	return r.writeErr
+}
+
+// Rotate rotates the file right away, regardless of its size.
+func (r *sizeRotator) Rotate() error {
+	r.mutex.Lock()
+	defer r.unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	return r.rotate()
+}
+
+func (r *sizeRotator) flush() error {
+	if r.gz != nil {
+		return r.gz.Flush()
+	}
+	if r.buf == nil {
+		return nil
+	}
+	return r.buf.Flush()
+}
+
+// closeFile flushes and closes the current file, if any. It must be called
+// with the mutex held.
+func (r *sizeRotator) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	var flushErr error
+	if r.gz != nil {
+		// Closing writes the gzip trailer
+		flushErr = r.gz.Close()
+		r.gz = nil
+	} else {
+		flushErr = r.flush()
+	}
+	r.buf = nil
+	err := r.file.Close()
+	r.file = nil
+	atomic.AddInt64(&openLogFiles, -1)
+	if err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// rotate closes the current file and shifts it and the previously rotated
+// files down by one, dropping the oldest. It must be called with the mutex
+// held, which is released meanwhile if a file is still being compressed.
+func (r *sizeRotator) rotate() error {
+	if r.rotationLatency != nil {
+		defer r.rotationLatency.since(time.Now())
+	}
+	r.awaitCompression()
+	if r.closed {
+		return ErrClosed
+	}
+	if r.Dated {
+		return r.rotateDated()
+	}
+	r.closeFile()
+
+	// Remove oldest file (in case it exists)
+	oldest := r.rotatedPath(r.MaxRotation)
+	for _, dpath := range []string{oldest, oldest + compressedExt, oldest + checksumExt, oldest + compressedExt + checksumExt} {
+		if err := os.Remove(dpath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Unable to delete oldest file: %v", err)
+		}
+	}
+
+	// Rename existing files, whether compressed or not
+	for i := r.MaxRotation - 1; i >= 0; i-- {
+		for _, ext := range []string{"", compressedExt, checksumExt, compressedExt + checksumExt} {
+			opath := r.rotatedPath(i) + ext
+			npath := r.rotatedPath(i+1) + ext
+			err := os.Rename(opath, npath)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("Unable to rename old file %v to %v: %v", opath, npath, err)
+			}
+		}
+	}
+	r.totalSize = 0
+	now := time.Now()
+	r.adaptRotationSize(now)
+	r.openedAt = now
+
+	r.sweep(now)
+	rotated := r.rotatedPath(1)
+	if r.LiveCompress {
+		rotated += compressedExt
+	}
+	if _, err := os.Stat(rotated); err == nil {
+		r.complete(rotated, r.Compress && !r.LiveCompress)
+	}
+	return nil
+}
+
+// complete compresses the rotated file at path if compress is set, then
+// writes its checksum and notifies OnRotate. Compressing is done in the
+// background, tracked by compressed. It must be called with the mutex held,
+// after awaitCompression.
+func (r *sizeRotator) complete(path string, compress bool) {
+	if !compress {
+		if err := r.completed(path); err != nil {
+			r.errs = append(r.errs, err)
+		}
+		return
+	}
+	level := r.CompressLevel
+	done := make(chan struct{})
+	r.compressed = done
+	go func() {
+		if err := compressFile(path, level); err != nil {
+			reportRotationErrors(fmt.Errorf("Unable to compress rotated log file %v: %v", path, err))
+		} else {
+			path += compressedExt
+		}
+		if err := r.completed(path); err != nil {
+			reportRotationErrors(err)
+		}
+		r.mutex.Lock()
+		r.compressed = nil
+		r.mutex.Unlock()
+		close(done)
+	}()
+}
+
+// awaitCompression waits for the rotated file being compressed, if any. It
+// must be called with the mutex held, but waits with it released so that
+// writers aren't held up any longer than needed and compression never waits
+// on the caller, and holds it again on return, with no file being compressed.
+func (r *sizeRotator) awaitCompression() {
+	for r.compressed != nil {
+		done := r.compressed
+		r.mutex.Unlock()
+		<-done
+		r.mutex.Lock()
+	}
+}
+
+// completed writes the checksum of the rotated file at path if needed and
+// notifies OnRotate, returning the error writing the checksum if any.
+func (r *sizeRotator) completed(path string) error {
+	var err error
+	if r.Checksums {
+		if checksumErr := writeChecksum(path); checksumErr != nil {
+			err = fmt.Errorf("Unable to write checksum of rotated log file %v: %v", path, checksumErr)
+		}
+	}
+	if r.OnRotate != nil {
+		r.OnRotate(path)
+	}
+	return err
+}
+
+// Sweep deletes the rotated files older than MaxAge. The current file is
+// never deleted.
+func (r *sizeRotator) Sweep() {
+	r.mutex.Lock()
+	defer r.unlock()
+	r.awaitCompression()
+	r.sweep(time.Now())
+}
+
+// sweep deletes the expired rotated files. It must be called with the mutex
+// held, failures being reported once it's released.
+func (r *sizeRotator) sweep(now time.Time) {
+	if r.MaxAge <= 0 {
+		return
+	}
+	if r.Dated {
+		r.pruneDated(now)
+		return
+	}
+	for i := 1; i <= r.MaxRotation; i++ {
+		for _, ext := range []string{"", compressedExt} {
+			path := r.rotatedPath(i) + ext
+			stat, err := os.Stat(path)
+			if err != nil || now.Sub(stat.ModTime()) <= r.MaxAge {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				r.errs = append(r.errs, fmt.Errorf("Unable to delete expired log file %v: %v", path, err))
+			}
+			os.Remove(path + checksumExt)
+		}
+	}
+}
+
+// rotatedPath returns the uncompressed path of the i-th rotated file, the
+// 0th being the current file.
+func (r *sizeRotator) rotatedPath(i int) string {
+	if i == 0 {
+		return r.path
+	}
+	if r.KeepExtension {
+		ext := filepath.Ext(r.path)
+		return strings.TrimSuffix(r.path, ext) + "." + strconv.Itoa(i) + ext
+	}
+	return r.path + "." + strconv.Itoa(i)
+}
+
+// Close closes the current file, waiting for rotated files to be compressed.
+func (r *sizeRotator) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+	err := r.closeFile()
+	r.awaitCompression()
+	return err
+}
+
+// compressFile gzips the file at path into path.gz and removes the original.
+func compressFile(path string, level int) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+compressedExt, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewWriterLevel(out, level)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + compressedExt)
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// validCompressLevel returns the gzip level set, gzip.DefaultCompression if
+// it's nil, and otherwise clamps it to the closest valid level.
+func validCompressLevel(set *int) int {
+	if set == nil {
+		return gzip.DefaultCompression
+	}
+	level := *set
+	switch {
+	case level == gzip.DefaultCompression:
+		return gzip.DefaultCompression
+	case level < gzip.NoCompression:
+		log.Errorf("Invalid gzip compression level %d, using %d", level, gzip.NoCompression)
+		return gzip.NoCompression
+	case level > gzip.BestCompression:
+		log.Errorf("Invalid gzip compression level %d, using %d", level, gzip.BestCompression)
+		return gzip.BestCompression
+	}
+	return level
+}
@@ -0,0 +1,619 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempLogDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "logging_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	return dir
+}
+
+func readGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+// readLiveGzip reads what's been flushed so far to a gzip file that's still
+// being written.
+func readLiveGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != io.ErrUnexpectedEOF {
+		assert.NoError(t, err)
+	}
+	return string(b)
+}
+
+func TestSizeRotation(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	r.RotationSize = 10
+	r.MaxRotation = 2
+	defer r.Close()
+
+	for _, s := range []string{"0000000000", "1111111111", "2222222222", "3333333333"} {
+		_, err := r.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	for i, expected := range []string{"3333333333", "2222222222", "1111111111"} {
+		b, err := ioutil.ReadFile(r.rotatedPath(i))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(b))
+	}
+	_, err := os.Stat(r.rotatedPath(3))
+	assert.True(t, os.IsNotExist(err), "should keep at most MaxRotation files")
+}
+
+func TestSizeRotationKeepExtension(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+
+	r := newSizeRotator(filepath.Join(dir, "test.log"))
+	r.RotationSize = 10
+	r.MaxRotation = 2
+	r.Compress = true
+	r.KeepExtension = true
+	r.MaxAge = time.Hour
+	defer r.Close()
+
+	for _, s := range []string{"0000000000", "1111111111", "2222222222"} {
+		r.Write([]byte(s))
+	}
+	awaitCompression(r)
+	assert.Equal(t, filepath.Join(dir, "test.2.log"), r.rotatedPath(2))
+	assert.Equal(t, "1111111111", readGzip(t, filepath.Join(dir, "test.1.log.gz")))
+	assert.Equal(t, "0000000000", readGzip(t, filepath.Join(dir, "test.2.log.gz")))
+
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "test.2.log.gz"), old, old))
+	r.Sweep()
+	_, err := os.Stat(filepath.Join(dir, "test.2.log.gz"))
+	assert.True(t, os.IsNotExist(err), "should sweep expired files named with the extension")
+	_, err = os.Stat(filepath.Join(dir, "test.1.log.gz"))
+	assert.NoError(t, err)
+}
+
+func TestSizeRotationCompressed(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	r.RotationSize = 100
+	r.MaxRotation = 2
+	r.Compress = true
+	r.CompressLevel = gzip.BestSpeed
+	defer r.Close()
+
+	for _, c := range []string{"a", "b", "c", "d"} {
+		r.Write([]byte(strings.Repeat(c, 100)))
+	}
+	awaitCompression(r)
+	assert.Equal(t, strings.Repeat("c", 100), readGzip(t, path+".1.gz"))
+	assert.Equal(t, strings.Repeat("b", 100), readGzip(t, path+".2.gz"))
+	for _, p := range []string{path + ".1", path + ".2", path + ".3.gz"} {
+		_, err := os.Stat(p)
+		assert.True(t, os.IsNotExist(err), "%v shouldn't exist", p)
+	}
+}
+
+func TestAdaptiveRotationSize(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+
+	r := newSizeRotator(filepath.Join(dir, "test.log"))
+	r.RotationSize = 10
+	r.MaxRotationSize = 30
+	defer r.Close()
+
+	for i := 0; i < 4; i++ {
+		_, err := r.Write([]byte("0000000000"))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(30), r.rotationSize(), "should grow up to MaxRotationSize when files fill up quickly")
+	b, err := ioutil.ReadFile(r.rotatedPath(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "00000000000000000000", string(b), "should have rotated at the grown size")
+
+	now := time.Now()
+	r.openedAt = now.Add(-5 * adaptiveRotationPeriod)
+	r.adaptRotationSize(now)
+	assert.Equal(t, int64(15), r.rotationSize(), "should shrink when files last long")
+	r.openedAt = now.Add(-2 * adaptiveRotationPeriod)
+	r.adaptRotationSize(now)
+	assert.Equal(t, int64(15), r.rotationSize(), "should stay put at the expected rate")
+	r.openedAt = now.Add(-5 * adaptiveRotationPeriod)
+	r.adaptRotationSize(now)
+	assert.Equal(t, int64(10), r.rotationSize(), "should not shrink below RotationSize")
+
+	static := newSizeRotator(filepath.Join(dir, "static.log"))
+	static.RotationSize = 10
+	static.openedAt = now
+	static.adaptRotationSize(now)
+	assert.Equal(t, int64(10), static.rotationSize(), "should be static by default")
+}
+
+func TestOnRotate(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	defer OnRotate(nil)
+
+	closed := make(chan string, 10)
+	OnRotate(func(closedPath string) {
+		closed <- closedPath
+	})
+	r := newSizeRotator(filepath.Join(dir, "test.log"))
+	r.RotationSize = 10
+	r.Compress = true
+	r.OnRotate = rotated
+	defer r.Close()
+
+	for _, s := range []string{"0000000000", "1111111111"} {
+		_, err := r.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	select {
+	case path := <-closed:
+		assert.Equal(t, r.rotatedPath(1)+compressedExt, path)
+		assert.Equal(t, "0000000000", readGzip(t, path))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Callback not invoked")
+	}
+
+	OnRotate(nil)
+	_, err := r.Write([]byte("2222222222"))
+	assert.NoError(t, err)
+	select {
+	case path := <-closed:
+		t.Fatalf("Removed callback invoked with %v", path)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// awaitCompression waits for r to be done compressing rotated files.
+func awaitCompression(r *sizeRotator) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.awaitCompression()
+}
+
+func TestSizeRotationCompressesInBackground(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	release := make(chan struct{})
+	r := newSizeRotator(path)
+	r.RotationSize = 10
+	r.Compress = true
+	r.OnRotate = func(string) {
+		<-release
+	}
+	defer r.Close()
+
+	written := make(chan struct{})
+	go func() {
+		for _, s := range []string{"0000000000", "1111111111", "2222222222"} {
+			r.Write([]byte(s))
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("The next rotation should wait for the previous file to be compressed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "1111111111", string(b), "should write after rotating without waiting for compression")
+
+	close(release)
+	<-written
+	awaitCompression(r)
+	assert.Equal(t, "0000000000", readGzip(t, path+".2.gz"))
+	assert.Equal(t, "1111111111", readGzip(t, path+".1.gz"))
+}
+
+func TestSizeRotationCompressionFailure(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+	var errOut syncBuffer
+	rotationErrorOut = &errOut
+	defer func() {
+		rotationErrorOut = os.Stderr
+	}()
+
+	r := newSizeRotator(path)
+	r.RotationSize = 10
+	r.Compress = true
+	r.CompressLevel = 42
+	errorsBefore := Stats().RotationErrors
+	done := make(chan struct{})
+	go func() {
+		for _, s := range []string{"0000000000", "1111111111", "2222222222"} {
+			r.Write([]byte(s))
+		}
+		r.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Failing to compress shouldn't deadlock")
+	}
+
+	assert.Contains(t, errOut.String(), "ERROR flashlight.logging: Unable to compress rotated log file "+path+".1")
+	assert.EqualValues(t, 2, Stats().RotationErrors-errorsBefore)
+	b, _ := ioutil.ReadFile(path + ".1")
+	assert.Equal(t, "1111111111", string(b), "should keep the file uncompressed")
+}
+
+func TestSizeRotationNoCompression(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	level := gzip.NoCompression
+	r := newSizeRotator(path)
+	r.RotationSize = 100
+	r.Compress = true
+	r.CompressLevel = validCompressLevel(&level)
+	for _, c := range []string{"a", "b"} {
+		r.Write([]byte(strings.Repeat(c, 100)))
+	}
+	assert.NoError(t, r.Close())
+
+	stat, err := os.Stat(path + ".1.gz")
+	if assert.NoError(t, err) {
+		assert.True(t, stat.Size() > 100, "should store the file uncompressed, got %d bytes", stat.Size())
+	}
+	assert.Equal(t, strings.Repeat("a", 100), readGzip(t, path+".1.gz"))
+}
+
+func TestValidCompressLevel(t *testing.T) {
+	level := func(l int) *int {
+		return &l
+	}
+	assert.Equal(t, gzip.DefaultCompression, validCompressLevel(nil))
+	assert.Equal(t, gzip.NoCompression, validCompressLevel(level(gzip.NoCompression)))
+	assert.Equal(t, gzip.DefaultCompression, validCompressLevel(level(gzip.DefaultCompression)))
+	assert.Equal(t, gzip.NoCompression, validCompressLevel(level(-5)))
+	assert.Equal(t, gzip.BestCompression, validCompressLevel(level(42)))
+	assert.Equal(t, 5, validCompressLevel(level(5)))
+}
+
+func TestSizeRotatorBuffered(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	r.BufferSize = 1024
+	r.RotationSize = 20
+	defer r.Close()
+
+	read := func(p string) string {
+		b, _ := ioutil.ReadFile(p)
+		return string(b)
+	}
+
+	r.Write([]byte("0123456789"))
+	assert.Equal(t, "", read(path), "write should be buffered")
+	assert.NoError(t, r.Flush())
+	assert.Equal(t, "0123456789", read(path), "flush should write out buffered data")
+
+	r.Write([]byte("abcdefghij"))
+	r.Write([]byte("klmnopqrst"))
+	assert.Equal(t, "0123456789abcdefghij", read(path+".1"), "rotation should write out buffered data")
+
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "klmnopqrst", read(path), "close should write out buffered data")
+}
+
+func TestFlusher(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	r.BufferSize = 1024
+	defer r.Close()
+	startFlusher(r, 10*time.Millisecond)
+	defer stopFlusher()
+
+	r.Write([]byte("hello"))
+	var content string
+	for i := 0; i < 100 && content == ""; i++ {
+		time.Sleep(5 * time.Millisecond)
+		b, _ := ioutil.ReadFile(path)
+		content = string(b)
+	}
+	assert.Equal(t, "hello", content, "flusher should periodically write out buffered data")
+}
+
+func TestSweep(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+
+	r := newSizeRotator(filepath.Join(dir, "test.log"))
+	r.MaxRotation = 5
+	r.MaxAge = 24 * time.Hour
+	old := time.Now().Add(-48 * time.Hour)
+	for _, path := range []string{r.rotatedPath(0), r.rotatedPath(1), r.rotatedPath(2), r.rotatedPath(3) + compressedExt} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte("x"), 0644))
+	}
+	for _, path := range []string{r.rotatedPath(0), r.rotatedPath(2), r.rotatedPath(3) + compressedExt} {
+		assert.NoError(t, os.Chtimes(path, old, old))
+	}
+	r.Sweep()
+
+	_, err := os.Stat(r.rotatedPath(0))
+	assert.NoError(t, err, "should never delete the current file")
+	_, err = os.Stat(r.rotatedPath(1))
+	assert.NoError(t, err, "should keep recent files")
+	_, err = os.Stat(r.rotatedPath(2))
+	assert.True(t, os.IsNotExist(err), "should delete expired files")
+	_, err = os.Stat(r.rotatedPath(3) + compressedExt)
+	assert.True(t, os.IsNotExist(err), "should delete expired compressed files")
+}
+
+func TestSweepFailedDelete(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	var errOut syncBuffer
+	rotationErrorOut = &errOut
+	defer func() {
+		rotationErrorOut = os.Stderr
+	}()
+
+	// A non-empty directory can't be deleted like a file
+	r := newSizeRotator(filepath.Join(dir, "test.log"))
+	r.MaxAge = time.Hour
+	expired := r.rotatedPath(1)
+	assert.NoError(t, os.Mkdir(expired, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(expired, "x"), []byte("x"), 0644))
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(expired, old, old))
+
+	errorsBefore := Stats().RotationErrors
+	r.Sweep()
+	assert.Contains(t, errOut.String(), "ERROR flashlight.logging: Unable to delete expired log file "+expired)
+	assert.EqualValues(t, 1, Stats().RotationErrors-errorsBefore)
+}
+
+func TestInitWithUndeletableExpiredFile(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	rotationErrorOut = ioutil.Discard
+	defer func() {
+		rotationErrorOut = os.Stderr
+	}()
+
+	expired := filepath.Join(dir, "lantern.log.1")
+	assert.NoError(t, os.Mkdir(expired, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(expired, "x"), []byte("x"), 0644))
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(expired, old, old))
+
+	done := make(chan error)
+	go func() {
+		done <- InitWithOptions(&Options{LogDir: dir, MaxAge: time.Hour})
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+		Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Init shouldn't deadlock failing to delete an expired file")
+	}
+}
+
+func TestRotateAndFlushGuards(t *testing.T) {
+	oldLogFile := logFile
+	defer func() {
+		logFile = oldLogFile
+	}()
+
+	logFile = nil
+	assert.Equal(t, ErrNotInitialized, Flush(), "Flush before Init")
+	assert.Equal(t, ErrNotInitialized, Rotate(), "Rotate before Init")
+
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	logFile = newSizeRotator(filepath.Join(dir, "test.log"))
+	logFile.Write([]byte("before"))
+	assert.NoError(t, Flush())
+	assert.NoError(t, Rotate())
+	b, err := ioutil.ReadFile(logFile.rotatedPath(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "before", string(b), "should rotate on demand")
+
+	assert.NoError(t, logFile.Close())
+	assert.Equal(t, ErrClosed, Flush(), "Flush after Close")
+	assert.Equal(t, ErrClosed, Rotate(), "Rotate after Close")
+	openBefore := Stats().OpenLogFiles
+	_, err = logFile.Write([]byte("after"))
+	assert.Equal(t, ErrClosed, err, "Write after Close")
+	assert.Equal(t, openBefore, Stats().OpenLogFiles, "shouldn't reopen the file")
+}
+
+func TestFileHeader(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("previous run\n"), 0644))
+
+	r := newSizeRotator(path)
+	r.RotationSize = 100
+	r.Header = func() string { return "# header\n" }
+	defer r.Close()
+	r.Write([]byte("line 1\n"))
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "previous run\n# header\nline 1\n", string(b), "should write the header when first opening the file")
+
+	r.Write([]byte(strings.Repeat("x", 100)))
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "# header\n"+strings.Repeat("x", 100), string(b), "should write the header on rotation")
+
+	assert.Equal(t, "", levelOf([]byte(fileHeader())), "header should not parse as a golog line")
+	assert.Regexp(t, `^# lantern pid=\d+ started=\S+ version=\S+ hostname=hidden\n$`, fileHeader())
+}
+
+func TestSetRotationSize(t *testing.T) {
+	oldLogFile := logFile
+	defer func() {
+		logFile = oldLogFile
+	}()
+	logFile = nil
+	assert.Equal(t, ErrNotInitialized, SetRotationSize(10))
+
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	logFile = newSizeRotator(filepath.Join(dir, "test.log"))
+	logFile.MaxRotation = 1000
+	assert.Error(t, SetRotationSize(0), "should require a positive size")
+
+	const writers, lines = 4, 100
+	line := "123456789\n"
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				logFile.Write([]byte(line))
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		size := int64(1000)
+		if i%2 == 0 {
+			size = 25
+		}
+		assert.NoError(t, SetRotationSize(size))
+		assert.Equal(t, size, Stats().FileRotationSize)
+	}
+	wg.Wait()
+	assert.NoError(t, logFile.Close())
+
+	total := 0
+	for i := 0; ; i++ {
+		b, err := ioutil.ReadFile(logFile.rotatedPath(i))
+		if os.IsNotExist(err) {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "", strings.Replace(string(b), line, "", -1), "files should only contain whole lines")
+		total += strings.Count(string(b), line)
+	}
+	assert.Equal(t, writers*lines, total, "no lines should be lost")
+}
+
+func TestLiveCompress(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	r.LiveCompress = true
+	r.Header = func() string {
+		return "# header\n"
+	}
+	line := strings.Repeat("compressible ", 10) + "\n"
+	r.Write([]byte(line))
+	assert.NoError(t, r.Flush())
+	assert.Equal(t, "# header\n"+line, readLiveGzip(t, path+compressedExt), "should be readable once flushed")
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "should only write the compressed file")
+
+	// Reopening appends another gzip member
+	assert.NoError(t, r.Close())
+	r = newSizeRotator(path)
+	r.LiveCompress = true
+	r.Write([]byte(line))
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "# header\n"+line+line, readGzip(t, path+compressedExt))
+
+	r = newSizeRotator(path)
+	r.LiveCompress = true
+	r.RotationSize = 100
+	defer r.Close()
+	for i := 0; i < 20; i++ {
+		r.Write([]byte(line))
+	}
+	stat, err := os.Stat(path + compressedExt)
+	if assert.NoError(t, err) {
+		assert.True(t, stat.Size() <= 100+int64(len(line)), "should rotate by compressed size")
+	}
+	assert.Contains(t, readGzip(t, r.rotatedPath(1)+compressedExt), line, "should rotate to a compressed file")
+}
+
+func TestBytesUntilRotation(t *testing.T) {
+	oldLogFile := logFile
+	defer func() {
+		logFile = oldLogFile
+	}()
+	logFile = nil
+	_, err := BytesUntilRotation()
+	assert.Equal(t, ErrNotInitialized, err)
+
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("0123456789"), 0644))
+	logFile = newSizeRotator(path)
+	logFile.RotationSize = 100
+	left, err := BytesUntilRotation()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(90), left, "should account for the existing file before it's opened")
+
+	logFile.Write([]byte("0123456789"))
+	left, _ = BytesUntilRotation()
+	assert.Equal(t, int64(80), left)
+
+	logFile.Dated = true
+	_, err = BytesUntilRotation()
+	assert.Equal(t, ErrTimeBasedRotation, err)
+	logFile.Dated = false
+
+	logFile.Close()
+	_, err = BytesUntilRotation()
+	assert.Equal(t, ErrClosed, err)
+}
@@ -0,0 +1,56 @@
+// +build !windows
+
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeRotatorExternalTruncation(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	r.RotationSize = 100
+	defer r.Close()
+
+	_, err := r.Write([]byte("0000000000"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, 0))
+	r.checkedAt = time.Time{}
+	_, err = r.Write([]byte("1111111111"))
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "1111111111", string(b), "should keep writing at the end of the file")
+	assert.Equal(t, int64(10), r.totalSize, "should notice the truncation")
+}
+
+func TestSizeRotatorExternalRename(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	r := newSizeRotator(path)
+	defer r.Close()
+
+	_, err := r.Write([]byte("0000000000"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Rename(path, path+".moved"))
+	r.checkedAt = time.Time{}
+	_, err = r.Write([]byte("1111111111"))
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "1111111111", string(b), "should reopen the file")
+	b, err = ioutil.ReadFile(path + ".moved")
+	assert.NoError(t, err)
+	assert.Equal(t, "0000000000", string(b))
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	sampledLines uint64
+
+	// configSampleRates holds the map[string]float64 of rates set with
+	// SetSamplingFromConfig, which replace Options.SampleRates unless nil
+	configSampleRates atomic.Value
+)
+
+func init() {
+	configSampleRates.Store(map[string]float64(nil))
+}
+
+// SetSamplingFromConfig replaces the rates set with Options.SampleRates at
+// runtime, typically from the cloud config, e.g. to dial down logging across
+// the fleet during an incident. They apply to the same outputs. Passing no
+// rates reverts to Options.SampleRates. Invalid rates are rejected as a
+// whole.
+func SetSamplingFromConfig(rates map[string]float64) error {
+	if err := validateSampleRates(rates); err != nil {
+		return err
+	}
+	if len(rates) == 0 {
+		configSampleRates.Store(map[string]float64(nil))
+		logInfo("Sampling rates reverted to the defaults")
+		return nil
+	}
+	copied := make(map[string]float64, len(rates))
+	for prefix, rate := range rates {
+		copied[prefix] = rate
+	}
+	configSampleRates.Store(copied)
+	logInfo(fmt.Sprintf("Sampling rates set from config to %v", copied))
+	return nil
+}
+
+// validateSampleRates checks that all rates are between 0 and 1.
+func validateSampleRates(rates map[string]float64) error {
+	for prefix, rate := range rates {
+		if rate < 0 || rate > 1 || math.IsNaN(rate) {
+			return fmt.Errorf("Invalid sample rate for %v, must be between 0 and 1: %v", prefix, rate)
+		}
+	}
+	return nil
+}
+
+type sampler struct {
+	io.Writer
+	rates map[string]float64
+}
+
+// sample creates a writer that only keeps the given fraction of the lines
+// from loggers matching each prefix in rates, or in the rates set with
+// SetSamplingFromConfig, the longest prefix winning. Lines from other loggers
+// are all kept. Sampling is based on a hash of the line so that identical
+// lines are consistently kept or dropped.
+func sample(w io.Writer, rates map[string]float64) io.Writer {
+	return &sampler{w, rates}
+}
+
+func (w *sampler) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *sampler) writeAt(p []byte, t time.Time) (int, error) {
+	rates := configSampleRates.Load().(map[string]float64)
+	if rates == nil {
+		rates = w.rates
+	}
+	if len(rates) == 0 {
+		return writeTimed(w.Writer, p, t)
+	}
+	_, logger, _ := parseLine(string(p))
+	if rate, found := sampleRate(rates, logger); found && !keep(p, rate) {
+		atomic.AddUint64(&sampledLines, 1)
+		return len(p), nil
+	}
+	return writeTimed(w.Writer, p, t)
+}
+
+// sampleRate returns the rate for the longest prefix of logger in rates.
+func sampleRate(rates map[string]float64, logger string) (float64, bool) {
+	longest := -1
+	var rate float64
+	for prefix, r := range rates {
+		if len(prefix) > longest && len(prefix) <= len(logger) && logger[:len(prefix)] == prefix {
+			longest, rate = len(prefix), r
+		}
+	}
+	return rate, longest >= 0
+}
+
+// keep deterministically tells whether to keep the line at the given rate.
+func keep(p []byte, rate float64) bool {
+	h := fnv.New32a()
+	h.Write(p)
+	return float64(h.Sum32()) < rate*float64(math.MaxUint32+1)
+}
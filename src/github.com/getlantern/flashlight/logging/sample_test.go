@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSampleRates(t *testing.T) {
+	assert.NoError(t, validateSampleRates(nil))
+	assert.NoError(t, validateSampleRates(map[string]float64{"a": 0, "b": 0.5, "c": 1}))
+	assert.Error(t, validateSampleRates(map[string]float64{"a": 1.5}))
+	assert.Error(t, validateSampleRates(map[string]float64{"a": -0.1}))
+}
+
+func TestSample(t *testing.T) {
+	var buf bytes.Buffer
+	w := sample(&buf, map[string]float64{
+		"flashlight.proxy":      0.1,
+		"flashlight.proxy.dial": 0,
+		"flashlight.ui":         1,
+	})
+	before := Stats().SampledLines
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(w, "DEBUG flashlight.proxy: a.go:1 line %d\n", i)
+		fmt.Fprintf(w, "DEBUG flashlight.proxy.dial: a.go:1 line %d\n", i)
+		fmt.Fprintf(w, "DEBUG flashlight.ui: a.go:1 line %d\n", i)
+		fmt.Fprintf(w, "DEBUG flashlight.client: a.go:1 line %d\n", i)
+	}
+	out := buf.String()
+	kept := strings.Count(out, "flashlight.proxy:")
+	assert.True(t, kept > 50 && kept < 150, "should keep about 10%% of flashlight.proxy, kept %d", kept)
+	assert.Equal(t, 0, strings.Count(out, "flashlight.proxy.dial:"), "longest prefix should win")
+	assert.Equal(t, 1000, strings.Count(out, "flashlight.ui:"))
+	assert.Equal(t, 1000, strings.Count(out, "flashlight.client:"), "should keep unmatched loggers")
+	assert.Equal(t, uint64(2000-kept), Stats().SampledLines-before)
+
+	line := []byte("DEBUG flashlight.proxy: a.go:1 same\n")
+	assert.Equal(t, keep(line, 0.5), keep(line, 0.5), "should be deterministic")
+}
+
+func TestSetSamplingFromConfig(t *testing.T) {
+	defer SetSamplingFromConfig(nil)
+	var buf bytes.Buffer
+	w := sample(&buf, map[string]float64{"flashlight.proxy": 0})
+	assert.Error(t, SetSamplingFromConfig(map[string]float64{"flashlight.ui": 2}))
+
+	rates := map[string]float64{"flashlight.ui": 0}
+	assert.NoError(t, SetSamplingFromConfig(rates))
+	rates["flashlight.ui"] = 1
+	fmt.Fprintf(w, "DEBUG flashlight.proxy: a.go:1 proxy\n")
+	fmt.Fprintf(w, "DEBUG flashlight.ui: a.go:1 ui\n")
+	assert.Equal(t, "DEBUG flashlight.proxy: a.go:1 proxy\n", buf.String(), "config should replace the default rates")
+
+	buf.Reset()
+	assert.NoError(t, SetSamplingFromConfig(nil))
+	fmt.Fprintf(w, "DEBUG flashlight.proxy: a.go:1 proxy\n")
+	fmt.Fprintf(w, "DEBUG flashlight.ui: a.go:1 ui\n")
+	assert.Equal(t, "DEBUG flashlight.ui: a.go:1 ui\n", buf.String(), "should revert to the default rates")
+}
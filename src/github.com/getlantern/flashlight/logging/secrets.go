@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const secretMask = "***"
+
+var (
+	secrets      = make(map[string]bool)
+	secretsMutex sync.Mutex
+
+	// secretReplacer holds the *strings.Replacer masking the registered
+	// secrets, nil if there are none
+	secretReplacer atomic.Value
+)
+
+func init() {
+	secretReplacer.Store((*strings.Replacer)(nil))
+}
+
+// RegisterSecret makes logging replace s with *** wherever it appears in lines
+// logged from then on, in all outputs, e.g. for tokens or passwords that
+// could end up in error messages. Empty strings are ignored.
+func RegisterSecret(s string) {
+	if s == "" {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	if secrets[s] {
+		return
+	}
+	secrets[s] = true
+	all := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		all = append(all, secret)
+	}
+	// The replacer matches in argument order, so put longer secrets first
+	// for them to be masked in full when they contain shorter ones
+	sort.Slice(all, func(i, j int) bool {
+		return len(all[i]) > len(all[j])
+	})
+	oldnew := make([]string, 0, 2*len(all))
+	for _, secret := range all {
+		oldnew = append(oldnew, secret, secretMask)
+	}
+	secretReplacer.Store(strings.NewReplacer(oldnew...))
+}
+
+// maskSecrets replaces the registered secrets in s with ***.
+func maskSecrets(s string) string {
+	if r := secretReplacer.Load().(*strings.Replacer); r != nil {
+		return r.Replace(s)
+	}
+	return s
+}
+
+// secretMasker masks the registered secrets in lines written to it.
+type secretMasker struct {
+	io.Writer
+}
+
+func (w *secretMasker) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *secretMasker) writeAt(p []byte, t time.Time) (int, error) {
+	r := secretReplacer.Load().(*strings.Replacer)
+	if r == nil {
+		return writeTimed(w.Writer, p, t)
+	}
+	line := string(p)
+	masked := r.Replace(line)
+	if masked == line {
+		return writeTimed(w.Writer, p, t)
+	}
+	if _, err := writeTimed(w.Writer, []byte(masked), t); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
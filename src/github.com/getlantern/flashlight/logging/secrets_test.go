@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetSecrets() {
+	secretsMutex.Lock()
+	secrets = make(map[string]bool)
+	secretsMutex.Unlock()
+	secretReplacer.Store((*strings.Replacer)(nil))
+}
+
+func TestSecretMasker(t *testing.T) {
+	defer resetSecrets()
+	var buf bytes.Buffer
+	w := &secretMasker{&buf}
+	line := "ERROR test: a.go:1 auth failed with token abc123\n"
+	w.Write([]byte(line))
+	assert.Equal(t, line, buf.String(), "shouldn't change anything without secrets")
+
+	RegisterSecret("")
+	RegisterSecret("abc")
+	RegisterSecret("abc123")
+	RegisterSecret("hunter2")
+	buf.Reset()
+	n, err := w.Write([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n, "should report the length written to it")
+	w.Write([]byte("DEBUG test: a.go:2 password hunter2, hunter2 again, abc\n"))
+	assert.Equal(t, "ERROR test: a.go:1 auth failed with token ***\n"+
+		"DEBUG test: a.go:2 password ***, *** again, ***\n", buf.String(),
+		"should mask longer secrets in full")
+}
+
+func TestSecretsInAllOutputs(t *testing.T) {
+	defer resetSecrets()
+	defer golog.ResetOutputs()
+	var errBuf, remoteBuf bytes.Buffer
+	oldErrorOut := errorOut
+	defer func() {
+		errorOut = oldErrorOut
+	}()
+	errorOut = &errBuf
+	setOutputs(outputsWithRemotes("linux", []io.Writer{&remoteBuf}))
+
+	RegisterSecret("s3cr3t")
+	golog.LoggerFor("test").Errorf("unable to log in with s3cr3t")
+	assert.Contains(t, errBuf.String(), "unable to log in with ***")
+	assert.Contains(t, remoteBuf.String(), "unable to log in with ***")
+	assert.NotContains(t, errBuf.String()+remoteBuf.String(), "s3cr3t")
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"fmt"
+	"time"
+)
+
+// minDiskFree is the free space in the logs directory below which SelfCheck
+// reports a problem.
+const minDiskFree = 10 * 1024 * 1024
+
+// CheckResult is the outcome of one of the checks made by SelfCheck.
+type CheckResult struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// SelfCheck reports on the health of logging, e.g. for a diagnostics screen.
+// It checks that the logs directory is writable and has free space, how full
+// the log file is, whether Loggly is active and its last send succeeded, and
+// whether any lines were dropped. It's safe to call at any time, reporting
+// what's not set up yet as such.
+func SelfCheck() []CheckResult {
+	return []CheckResult{
+		checkLogDir(),
+		checkLogFile(),
+		checkDiskFree(),
+		checkLoggly(),
+		checkLogglySend(),
+		checkDropped(),
+	}
+}
+
+func checkLogDir() CheckResult {
+	result := CheckResult{Name: "logdir"}
+	dir := currentLogDir()
+	if dir == "" {
+		result.Detail = "not initialized"
+		return result
+	}
+	if err := prepareLogDir(dir); err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.OK = true
+	result.Detail = dir + " is writable"
+	return result
+}
+
+// FileLoggingStatus reports whether writing to the log file is healthy and,
+// if not, the error of the last failed write, e.g. so that the UI can tell
+// users that logging to disk is degraded because the disk is full. The error
+// is cleared by the next successful write. It returns ErrNotInitialized before
+// Init and ErrClosed after Close.
+func FileLoggingStatus() (healthy bool, lastError error) {
+	f := currentLogFile()
+	if f == nil {
+		return false, ErrNotInitialized
+	}
+	lastError = f.status()
+	return lastError == nil, lastError
+}
+
+func checkLogFile() CheckResult {
+	result := CheckResult{Name: "logfile"}
+	f := currentLogFile()
+	if f == nil {
+		result.Detail = "not initialized"
+		return result
+	}
+	if err := f.status(); err != nil {
+		result.Detail = fmt.Sprintf("last write failed: %v", err)
+		return result
+	}
+	size, rotationSize := f.currentSize()
+	result.OK = true
+	result.Detail = fmt.Sprintf("%d of %d bytes before rotation", size, rotationSize)
+	return result
+}
+
+func checkDiskFree() CheckResult {
+	result := CheckResult{Name: "diskfree"}
+	dir := currentLogDir()
+	if dir == "" {
+		result.Detail = "not initialized"
+		return result
+	}
+	free, err := diskFree(dir)
+	if err != nil {
+		result.Detail = fmt.Sprintf("unable to determine free space: %v", err)
+		return result
+	}
+	result.OK = free >= minDiskFree
+	result.Detail = fmt.Sprintf("%d bytes free in %v", free, dir)
+	return result
+}
+
+func checkLoggly() CheckResult {
+	result := CheckResult{Name: "loggly"}
+	switch {
+	case activeLoggly() != nil:
+		result.OK = true
+		result.Detail = "active"
+	case logglyToken == "":
+		// Not sending to Loggly without a token is expected
+		result.OK = true
+		result.Detail = "no token"
+	default:
+		result.Detail = "not active"
+	}
+	return result
+}
+
+func checkLogglySend() CheckResult {
+	result := CheckResult{Name: "logglysend"}
+	last := lastLogglySend.Load().(logglySendResult)
+	switch {
+	case last.at.IsZero():
+		result.OK = true
+		result.Detail = "nothing sent yet"
+	case last.err != nil:
+		result.Detail = fmt.Sprintf("last send at %v failed: %v", last.at.Format(time.RFC3339), last.err)
+	default:
+		result.OK = true
+		result.Detail = fmt.Sprintf("last send at %v succeeded", last.at.Format(time.RFC3339))
+	}
+	return result
+}
+
+func checkDropped() CheckResult {
+	stats := Stats()
+	dropped := stats.ThrottledLines + stats.ObserverDroppedLines
+	return CheckResult{
+		Name:   "dropped",
+		OK:     dropped == 0,
+		Detail: fmt.Sprintf("%d throttled, %d not observed", stats.ThrottledLines, stats.ObserverDroppedLines),
+	}
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func checkResults() map[string]CheckResult {
+	results := make(map[string]CheckResult)
+	for _, result := range SelfCheck() {
+		results[result.Name] = result
+	}
+	return results
+}
+
+func TestSelfCheck(t *testing.T) {
+	oldLogDir, oldLogFile := logDir, logFile
+	defer func() {
+		logDir, logFile = oldLogDir, oldLogFile
+		lastLogglySend.Store(logglySendResult{})
+	}()
+
+	logDir, logFile = "", nil
+	results := checkResults()
+	assert.Len(t, results, 6)
+	assert.False(t, results["logdir"].OK)
+	assert.Equal(t, "not initialized", results["logfile"].Detail, "should be safe to call before Init")
+	assert.True(t, results["logglysend"].OK)
+
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	logDir = dir
+	logFile = newSizeRotator(filepath.Join(dir, "lantern.log"))
+	defer logFile.Close()
+	logFile.RotationSize = 100
+	logFile.Write([]byte("0123456789"))
+	lastLogglySend.Store(logglySendResult{time.Now(), errors.New("connection refused")})
+
+	results = checkResults()
+	assert.True(t, results["logdir"].OK, results["logdir"].Detail)
+	assert.Equal(t, "10 of 100 bytes before rotation", results["logfile"].Detail)
+	assert.True(t, results["diskfree"].OK, results["diskfree"].Detail)
+	assert.False(t, results["logglysend"].OK)
+	assert.Contains(t, results["logglysend"].Detail, "connection refused")
+}
+
+func TestFileLoggingStatus(t *testing.T) {
+	oldLogFile := logFile
+	defer func() {
+		logFile = oldLogFile
+	}()
+
+	logFile = nil
+	healthy, err := FileLoggingStatus()
+	assert.False(t, healthy)
+	assert.Equal(t, ErrNotInitialized, err)
+
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	logFile = newSizeRotator(filepath.Join(dir, "lantern.log"))
+	_, err = logFile.Write([]byte("ok\n"))
+	assert.NoError(t, err)
+	healthy, err = FileLoggingStatus()
+	assert.True(t, healthy)
+	assert.NoError(t, err)
+
+	// Close the file behind the rotator's back to make writes fail
+	logFile.file.Close()
+	_, writeErr := logFile.Write([]byte("failed\n"))
+	assert.Error(t, writeErr)
+	healthy, err = FileLoggingStatus()
+	assert.False(t, healthy)
+	assert.Equal(t, writeErr, err, "should report the last write error")
+	assert.Contains(t, checkResults()["logfile"].Detail, "last write failed")
+
+	logFile.file = nil
+	logFile.Write([]byte("reopened\n"))
+	healthy, err = FileLoggingStatus()
+	assert.True(t, healthy, "should clear the error on the next successful write")
+	assert.NoError(t, err)
+
+	logFile.Close()
+	healthy, err = FileLoggingStatus()
+	assert.False(t, healthy)
+	assert.Equal(t, ErrClosed, err)
+}
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getlantern/go-loggly"
+)
+
+// logglySender is what logglyErrorWriter needs from a Loggly client. It allows
+// tests to substitute a fake that records the messages it's given.
+type logglySender interface {
+	// Send queues the message for sending to Loggly
+	Send(m loggly.Message) error
+
+	// SetDefault sets a property included in every message sent. It must not
+	// be called concurrently with Send.
+	SetDefault(key string, value interface{})
+}
+
+// logglyClient is the logglySender backed by an actual *loggly.Client.
+type logglyClient struct {
+	*loggly.Client
+}
+
+// logglyEndpoint is where the loggly client sends messages for a token
+const logglyEndpoint = "https://logs-01.loggly.com/bulk/{token}"
+
+// newLogglyClient creates a logglyClient for the given token that sends
+// through the given HTTP client, tagging all messages with the given tags.
+func newLogglyClient(token string, httpClient *http.Client, tags ...string) logglyClient {
+	// batchingSender decides when to send, so the client is created directly
+	// rather than with loggly.New, which starts a goroutine flushing every few
+	// seconds regardless of the requests in flight, and it never flushes on
+	// account of the buffer size
+	c := logglyClient{&loggly.Client{
+		Level:      loggly.INFO,
+		BufferSize: math.MaxInt32,
+		Token:      token,
+		Endpoint:   strings.Replace(logglyEndpoint, "{token}", token, 1),
+		Defaults:   loggly.Message{},
+	}}
+	c.Tag(tags...)
+	c.SetHTTPClient(withStatusCheck(httpClient))
+	return c
+}
+
+// withStatusCheck returns a copy of httpClient whose requests fail on non-2xx
+// responses. The loggly client ignores the response status when flushing, so
+// rejected batches would otherwise count as sent.
+func withStatusCheck(httpClient *http.Client) *http.Client {
+	c := *httpClient
+	c.Transport = &statusCheckingTransport{next: httpClient.Transport}
+	return &c
+}
+
+// statusCheckingTransport is an http.RoundTripper that turns non-2xx
+// responses into errors.
+type statusCheckingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *statusCheckingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Unexpected response status %v", resp.Status)
+	}
+	return resp, nil
+}
+
+func (c logglyClient) SetDefault(key string, value interface{}) {
+	c.Defaults[key] = value
+}
+
+// logglyDebugSender writes the JSON of each message, including defaults, as a
+// line to out before passing it on to next, if any.
+type logglyDebugSender struct {
+	next     logglySender
+	out      io.Writer
+	defaults loggly.Message
+	mutex    sync.Mutex
+}
+
+func newLogglyDebugSender(next logglySender, out io.Writer) *logglyDebugSender {
+	return &logglyDebugSender{next: next, out: out, defaults: loggly.Message{}}
+}
+
+func (s *logglyDebugSender) Send(m loggly.Message) error {
+	full := make(loggly.Message, len(s.defaults)+len(m))
+	for k, v := range s.defaults {
+		full[k] = v
+	}
+	for k, v := range m {
+		full[k] = v
+	}
+	b, err := json.Marshal(full)
+	if err != nil {
+		b = []byte(fmt.Sprintf("Unable to marshal Loggly message: %v", err))
+	}
+	s.mutex.Lock()
+	s.out.Write(append(b, '\n'))
+	s.mutex.Unlock()
+	if s.next == nil {
+		return nil
+	}
+	return s.next.Send(m)
+}
+
+func (s *logglyDebugSender) SetDefault(key string, value interface{}) {
+	s.defaults[key] = value
+	if s.next != nil {
+		s.next.SetDefault(key, value)
+	}
+}
+
+// logglyDebugOut writes to the current loggly-debug.log, if any, so that the
+// logglyDebugSender follows it when Reconfigure replaces it.
+type logglyDebugOut struct{}
+
+func (logglyDebugOut) Write(p []byte) (int, error) {
+	f := currentLogglyDebugFile()
+	if f == nil {
+		return len(p), nil
+	}
+	return f.Write(p)
+}
+
+func (s *logglyDebugSender) Flush() error {
+	if f, ok := s.next.(flushingSender); ok {
+		return f.Flush()
+	}
+	return nil
+}
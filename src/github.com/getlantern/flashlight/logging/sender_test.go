@@ -0,0 +1,425 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getlantern/go-loggly"
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSender is a logglySender that records what it's given.
+type fakeSender struct {
+	messages []loggly.Message
+	defaults map[string]interface{}
+	err      error
+	mutex    sync.Mutex
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{defaults: make(map[string]interface{})}
+}
+
+func (s *fakeSender) Send(m loggly.Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+func (s *fakeSender) SetDefault(key string, value interface{}) {
+	s.defaults[key] = value
+}
+
+func (s *fakeSender) sent() []loggly.Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]loggly.Message(nil), s.messages...)
+}
+
+func TestLogglyWriterWithFakeSender(t *testing.T) {
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{
+		lang:            "en",
+		tz:              "UTC",
+		versionToLoggly: "1.0.0 (today)",
+		client:          sender,
+	}
+	line := "ERROR flashlight.test: sender_test.go:50 could not connect: connection refused\n"
+	n, err := lw.Write([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n)
+
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 1) {
+		m := msgs[0]
+		assert.Equal(t, "ERROR flashlight.test", m["locationInfo"])
+		assert.Equal(t, "sender_test.go:50 could not connect: connection refused", m["message"])
+		assert.Equal(t, line, m["fullMessage"])
+		extra := m["extra"].(map[string]string)
+		assert.Equal(t, "ERROR", extra["logLevel"])
+		assert.Equal(t, runtime.GOOS, extra["osName"])
+		assert.Equal(t, runtime.GOARCH, extra["osArch"])
+		assert.Equal(t, "en", extra["language"])
+		assert.Equal(t, "UTC", extra["timeZone"])
+		assert.Equal(t, "1.0.0 (today)", extra["version"])
+		assert.Equal(t, "flashlight.test", extra["logger"])
+	}
+}
+
+func TestLogglyLoggerField(t *testing.T) {
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender}
+	lw.Write([]byte("ERROR flashlight.logging: a.go:1 failed: timeout {logger=other}\n"))
+	lw.Write([]byte("panic: runtime error\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, "flashlight.logging", msgs[0]["extra"].(map[string]string)["logger"],
+			"fields shouldn't override the logger")
+		assert.Equal(t, "", msgs[1]["extra"].(map[string]string)["logger"], "should leave it empty without a logger")
+	}
+}
+
+func TestLogglyUptime(t *testing.T) {
+	oldStartTime := startTime
+	startTime = time.Now().Add(-90 * time.Second)
+	defer func() {
+		startTime = oldStartTime
+	}()
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender, uptime: true}
+	lw.Write([]byte("ERROR flashlight: a.go:1 failed\n"))
+	lw = &logglyErrorWriter{client: sender}
+	lw.Write([]byte("ERROR flashlight: a.go:1 failed\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, "90", msgs[0]["extra"].(map[string]string)["uptimeSeconds"])
+		_, found := msgs[1]["extra"].(map[string]string)["uptimeSeconds"]
+		assert.False(t, found, "should only add the uptime when enabled")
+	}
+}
+
+func TestLogglyExitCountry(t *testing.T) {
+	defer SetExitCountry("")
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender}
+	lw.Write([]byte("ERROR flashlight: a.go:1 failed\n"))
+	SetExitCountry("DE")
+	lw.Write([]byte("ERROR flashlight: a.go:1 failed\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 2) {
+		_, found := msgs[0]["extra"].(map[string]string)["exitCountry"]
+		assert.False(t, found, "should leave out an unknown exit country")
+		assert.Equal(t, "DE", msgs[1]["extra"].(map[string]string)["exitCountry"])
+	}
+}
+
+func TestLogglyWriterIsShared(t *testing.T) {
+	defer golog.ResetOutputs()
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{versionToLoggly: "1.0.0 (today)", client: sender}
+	addLoggly(lw)
+	defer removeLoggly()
+
+	lw.versionToLoggly = "1.0.1 (tomorrow)"
+	activeLoggly().Write([]byte("ERROR flashlight: sender_test.go:1 failed\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 1) {
+		assert.Equal(t, "1.0.1 (tomorrow)", msgs[0]["extra"].(map[string]string)["version"],
+			"the active writer should be the same instance, not a copy")
+	}
+}
+
+func TestLogglyTimestampMode(t *testing.T) {
+	line := "ERROR flashlight.test: sender_test.go:80 something: failed\n"
+	oldErrorOut := errorOut
+	defer func() {
+		errorOut = oldErrorOut
+	}()
+	errorOut = ioutil.Discard
+	for _, goos := range []string{"android", "linux", "windows", "darwin"} {
+		for _, mode := range []LogglyTimestampMode{LogglyNoTimestamp, LogglyUTCTimestamp, LogglyLocalTimestamp} {
+			sender := newFakeSender()
+			lw := &logglyErrorWriter{client: sender, timestampMode: mode}
+			errOut, _ := outputsWithRemotes(goos, []io.Writer{lw})
+			errOut.Write([]byte(line))
+
+			msgs := sender.sent()
+			if !assert.Len(t, msgs, 1, "%v should send errors to Loggly", goos) {
+				continue
+			}
+			m := msgs[0]
+			assert.Equal(t, "ERROR flashlight.test", m["locationInfo"], "timestamp shouldn't affect locationInfo on %v", goos)
+			assert.Equal(t, "sender_test.go:80 something: failed", m["message"], "timestamp shouldn't affect grouping on %v", goos)
+			full := m["fullMessage"].(string)
+			if mode == LogglyNoTimestamp {
+				assert.Equal(t, line, full, "%v should send raw line by default", goos)
+			} else {
+				assert.Regexp(t, `^[A-Z][a-z]{2} \d{2} \d{2}:\d{2}:\d{2}\.\d{3} - `+line, full, "%v should send timestamped line", goos)
+			}
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	assert.Equal(t, "fa_IR", detectLanguage(func() (string, error) {
+		return "fa_IR", nil
+	}), "should use provider when set")
+
+	fallback := detectLanguage(nil)
+	assert.Equal(t, fallback, detectLanguage(func() (string, error) {
+		return "", errors.New("no language selected")
+	}), "should fall back to detection when the provider fails")
+}
+
+func TestLogglyDebugSender(t *testing.T) {
+	var buf bytes.Buffer
+	next := newFakeSender()
+	s := newLogglyDebugSender(next, &buf)
+	s.SetDefault("hostname", "hidden")
+	assert.NoError(t, s.Send(loggly.Message{"message": "a.go:1 failed"}))
+	assert.Equal(t, "{\"hostname\":\"hidden\",\"message\":\"a.go:1 failed\"}\n", buf.String())
+	assert.Equal(t, []loggly.Message{{"message": "a.go:1 failed"}}, next.sent(), "should still send")
+	assert.Equal(t, "hidden", next.defaults["hostname"])
+
+	buf.Reset()
+	only := newLogglyDebugSender(nil, &buf)
+	assert.NoError(t, only.Send(loggly.Message{"message": "b"}))
+	assert.Equal(t, "{\"message\":\"b\"}\n", buf.String())
+}
+
+func TestLogglyFilter(t *testing.T) {
+	defer SetLogglyFilter(nil)
+	SetLogglyFilter(func(fullMessage string) (bool, string) {
+		if strings.Contains(fullMessage, "noisy") {
+			return false, ""
+		}
+		return true, strings.Replace(fullMessage, "secret", "[redacted]", -1)
+	})
+
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender}
+	line := "ERROR flashlight: sender_test.go:1 noisy failure\n"
+	n, err := lw.Write([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n, "dropped messages should count as written")
+	lw.Write([]byte("ERROR flashlight: sender_test.go:2 bad secret\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 1, "should drop filtered messages") {
+		assert.Equal(t, "ERROR flashlight: sender_test.go:2 bad [redacted]\n", msgs[0]["fullMessage"])
+		assert.Equal(t, "sender_test.go:2 bad [redacted]", msgs[0]["message"], "should derive message from the rewritten one")
+		assert.Equal(t, "ERROR flashlight", msgs[0]["locationInfo"])
+	}
+
+	SetLogglyFilter(nil)
+	lw.Write([]byte("ERROR flashlight: sender_test.go:3 noisy failure\n"))
+	assert.Len(t, sender.sent(), 2, "should send all without a filter")
+}
+
+func TestLogglyGroupModes(t *testing.T) {
+	line := "ERROR flashlight.proxy: sender_test.go:1 dial failed: lookup example.com: no such host\n"
+	for mode, expected := range map[LogglyGroupMode]string{
+		LogglyGroupHeuristic:    "lookup example.com: no such host",
+		LogglyGroupFullMessage:  "ERROR flashlight.proxy: sender_test.go:1 dial failed: lookup example.com: no such host",
+		LogglyGroupLoggerPrefix: "ERROR flashlight.proxy",
+	} {
+		sender := newFakeSender()
+		lw := &logglyErrorWriter{client: sender, groupMode: mode}
+		lw.Write([]byte(line))
+		msgs := sender.sent()
+		if assert.Len(t, msgs, 1) {
+			assert.Equal(t, expected, msgs[0]["message"], "mode %d", mode)
+			assert.Equal(t, "ERROR flashlight.proxy", msgs[0]["locationInfo"], "mode %d", mode)
+			assert.Equal(t, line, msgs[0]["fullMessage"], "mode %d", mode)
+		}
+	}
+}
+
+func TestLogglyMultiline(t *testing.T) {
+	line := "ERROR flashlight: sender_test.go:1 Panic: runtime error: index out of range\n" +
+		"goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/src/main.go:10 +0x20\n"
+	send := func(policy MultilinePolicy) loggly.Message {
+		sender := newFakeSender()
+		lw := &logglyErrorWriter{client: sender, multilinePolicy: policy}
+		lw.Write([]byte(line))
+		return sender.sent()[0]
+	}
+
+	m := send(MultilineAsIs)
+	assert.Equal(t, line, m["fullMessage"])
+	assert.Equal(t, "index out of range\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:10 +0x20", m["message"], "should group by the whole trace")
+
+	m = send(MultilineCollapse)
+	assert.Equal(t, "ERROR flashlight: sender_test.go:1 Panic: runtime error: index out of range | goroutine 1 [running]: | main.main() | \t/src/main.go:10 +0x20\n", m["fullMessage"])
+
+	m = send(MultilineFirstLine)
+	assert.Equal(t, line, m["fullMessage"], "should keep the whole trace")
+	assert.Equal(t, "runtime error: index out of range", m["message"], "should group by the first line")
+	assert.Equal(t, "ERROR flashlight", m["locationInfo"])
+}
+
+func TestPendingLogglyMessages(t *testing.T) {
+	assert.Empty(t, PendingLogglyMessages(), "should have nothing pending without Loggly")
+
+	next := newFakeSender()
+	b := newBatchingSender(next, 3, 1, time.Hour)
+	setLogglyBatch(b)
+	defer setLogglyBatch(nil)
+
+	b.Send(loggly.Message{"message": "a"})
+	b.Send(loggly.Message{"message": "b"})
+	pending := PendingLogglyMessages()
+	if assert.Len(t, pending, 2) {
+		assert.Equal(t, "a", pending[0]["message"])
+		assert.NotNil(t, pending[0]["timestamp"], "should timestamp when queued")
+	}
+	assert.EqualValues(t, 2, Stats().LogglyBacklog)
+	pending[0]["message"] = "changed"
+	assert.Equal(t, "a", PendingLogglyMessages()[0]["message"], "should return a copy")
+	assert.Empty(t, next.sent(), "shouldn't send before the batch is full")
+
+	assert.NoError(t, b.Flush())
+	assert.Len(t, next.sent(), 2)
+	assert.Empty(t, PendingLogglyMessages())
+	assert.EqualValues(t, 0, Stats().LogglyBacklog)
+}
+
+// blockingSender is a fakeSender whose Flush blocks until released, after
+// which it returns right away.
+type blockingSender struct {
+	*fakeSender
+	flushing chan struct{}
+	release  chan struct{}
+}
+
+func (s *blockingSender) Flush() error {
+	select {
+	case s.flushing <- struct{}{}:
+		<-s.release
+	case <-s.release:
+	}
+	return nil
+}
+
+func TestLogglyMaxInFlight(t *testing.T) {
+	next := &blockingSender{newFakeSender(), make(chan struct{}), make(chan struct{})}
+	b := newBatchingSender(next, 100, 1, time.Hour)
+	defer b.stop()
+
+	b.Send(loggly.Message{"message": "a"})
+	done := make(chan error)
+	go func() {
+		done <- b.flush(false)
+	}()
+	<-next.flushing
+	assert.EqualValues(t, 1, Stats().LogglyInFlight)
+
+	b.Send(loggly.Message{"message": "b"})
+	assert.NoError(t, b.flush(false))
+	assert.Len(t, next.sent(), 1, "shouldn't send more than the limit at once")
+	assert.Len(t, b.pendingMessages(), 1, "should keep messages queued at the limit")
+
+	close(next.release)
+	assert.NoError(t, <-done)
+	assert.EqualValues(t, 0, Stats().LogglyInFlight)
+	assert.NoError(t, b.flush(false))
+	assert.Len(t, next.sent(), 2, "should send queued messages once below the limit")
+}
+
+func TestBatchingSenderBackoff(t *testing.T) {
+	next := newFakeSender()
+	next.err = errors.New("unavailable")
+	b := startBatchingSender(next, 100, 100, 1, time.Hour, newBatchCounters())
+	defer b.stop()
+
+	b.Send(loggly.Message{"message": "a"})
+	assert.Error(t, b.flush(false))
+	assert.Equal(t, maxBatchRetryBackoff, b.retryAt.Sub(b.counters.lastSend.Load().(logglySendResult).at), "should back off for the interval at first, capped")
+
+	next.mutex.Lock()
+	next.err = nil
+	next.mutex.Unlock()
+	b.Send(loggly.Message{"message": "b"})
+	assert.NoError(t, b.flush(false))
+	assert.Empty(t, next.sent(), "shouldn't send while backing off")
+	assert.Len(t, b.pendingMessages(), 1)
+	assert.NoError(t, b.Flush())
+	assert.Len(t, next.sent(), 1, "should send when flushed explicitly")
+	assert.True(t, b.retryAt.IsZero(), "should stop backing off once sent")
+
+	b.interval = time.Second
+	b.failures = 3
+	assert.Equal(t, 8*time.Second, b.backoff(), "should double with each failure")
+	b.interval = time.Minute
+	assert.Equal(t, maxBatchRetryBackoff, b.backoff(), "should cap the backoff")
+}
+
+func TestLogglyClientMaxInFlight(t *testing.T) {
+	var concurrent, maxConcurrent, requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt64(&concurrent, 1)
+		defer atomic.AddInt64(&concurrent, -1)
+		for {
+			max := atomic.LoadInt64(&maxConcurrent)
+			if n <= max || atomic.CompareAndSwapInt64(&maxConcurrent, max, n) {
+				break
+			}
+		}
+		atomic.AddInt64(&requests, 1)
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := newLogglyClient("token", &http.Client{})
+	client.Endpoint = server.URL
+	b := newBatchingSender(client, 1, 2, 5*time.Millisecond)
+	for i := 0; i < 20; i++ {
+		b.Send(loggly.Message{"message": "a"})
+		time.Sleep(2 * time.Millisecond)
+	}
+	b.stop()
+	assert.NoError(t, b.Flush())
+	assert.True(t, atomic.LoadInt64(&requests) > 0, "should have sent requests")
+	assert.True(t, atomic.LoadInt64(&maxConcurrent) <= 2, "should never have more than 2 requests in flight, had %d", atomic.LoadInt64(&maxConcurrent))
+}
+
+func TestLogglyGrouper(t *testing.T) {
+	defer SetLogglyGrouper(nil)
+	var given string
+	SetLogglyGrouper(func(fullMessage string) (string, string) {
+		given = fullMessage
+		return "dial " + strings.Repeat("x", 200), "proxy"
+	})
+
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender, groupMode: LogglyGroupLoggerPrefix, timestampMode: LogglyUTCTimestamp}
+	line := "ERROR flashlight.proxy: sender_test.go:1 dial failed: timeout\n"
+	lw.Write([]byte(line))
+	SetLogglyGrouper(nil)
+	lw.Write([]byte(line))
+
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, line, given, "should be given the message without timestamp")
+		assert.Len(t, msgs[0]["message"], 100, "should still cap the group")
+		assert.Equal(t, "proxy", msgs[0]["locationInfo"])
+		assert.Contains(t, msgs[0]["fullMessage"], line)
+		assert.Equal(t, "ERROR flashlight.proxy", msgs[1]["message"], "should go back to the built-in grouping")
+	}
+}
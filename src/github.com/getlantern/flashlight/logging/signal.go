@@ -0,0 +1,28 @@
+// +build !windows
+
+package logging
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var handleSIGUSR1Once sync.Once
+
+// HandleSIGUSR1 makes the process toggle its log level between the level
+// configured at Init and DEBUG every time it receives SIGUSR1, so that verbose
+// logging can be switched on and off without restarting. Calling it more
+// than once has no further effect.
+func HandleSIGUSR1() {
+	handleSIGUSR1Once.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGUSR1)
+		go func() {
+			for range c {
+				toggleDebug()
+			}
+		}()
+	})
+}
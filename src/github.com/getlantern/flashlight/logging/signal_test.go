@@ -0,0 +1,26 @@
+// +build !windows
+
+package logging
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleSIGUSR1(t *testing.T) {
+	defer setDefaultLevel(levelTrace)
+	setDefaultLevel(levelError)
+
+	HandleSIGUSR1()
+	HandleSIGUSR1()
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	for i := 0; i < 100 && Level() != levelDebug; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, levelDebug, Level(), "SIGUSR1 should switch to DEBUG")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, levelDebug, Level(), "SIGUSR1 should toggle only once however many times it's handled")
+}
@@ -0,0 +1,5 @@
+package logging
+
+// HandleSIGUSR1 is a no-op on Windows, which doesn't have SIGUSR1.
+func HandleSIGUSR1() {
+}
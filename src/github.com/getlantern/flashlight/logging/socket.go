@@ -0,0 +1,95 @@
+// +build !windows
+
+package logging
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// socketRetryInterval is the minimum time between attempts to reconnect to
+	// the socket
+	socketRetryInterval = 1 * time.Second
+
+	// socketBacklogSize is how many bytes are held while disconnected from
+	// the socket, so that a collector restart doesn't lose everything
+	socketBacklogSize = 64 * 1024
+)
+
+// socketWriter writes lines to a Unix domain socket, e.g. for a local log
+// collector, reconnecting as needed. Lines written while disconnected are
+// held in a backlog, up to socketBacklogSize bytes, after which the oldest
+// lines are dropped.
+type socketWriter struct {
+	path        string
+	conn        net.Conn
+	lastAttempt time.Time
+	backlog     [][]byte
+	backlogSize int
+	mutex       sync.Mutex
+}
+
+func newSocketWriter(path string) (io.WriteCloser, error) {
+	w := &socketWriter{path: path}
+	w.connect()
+	return w, nil
+}
+
+// connect tries connecting to the socket. It must be called with the mutex
+// held.
+func (w *socketWriter) connect() {
+	w.lastAttempt = time.Now()
+	conn, err := net.DialTimeout("unix", w.path, socketRetryInterval)
+	if err != nil {
+		log.Debugf("Unable to connect to log socket %v: %v", w.path, err)
+		return
+	}
+	w.conn = conn
+}
+
+func (w *socketWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.hold(p)
+	if w.conn == nil && time.Since(w.lastAttempt) >= socketRetryInterval {
+		w.connect()
+	}
+	if w.conn == nil {
+		return len(p), nil
+	}
+	for len(w.backlog) > 0 {
+		if _, err := w.conn.Write(w.backlog[0]); err != nil {
+			w.conn.Close()
+			w.conn = nil
+			break
+		}
+		w.backlogSize -= len(w.backlog[0])
+		w.backlog = w.backlog[1:]
+	}
+	return len(p), nil
+}
+
+// hold adds a copy of p to the backlog, dropping the oldest lines if needed.
+// It must be called with the mutex held.
+func (w *socketWriter) hold(p []byte) {
+	w.backlog = append(w.backlog, append([]byte(nil), p...))
+	w.backlogSize += len(p)
+	for w.backlogSize > socketBacklogSize && len(w.backlog) > 0 {
+		w.backlogSize -= len(w.backlog[0])
+		w.backlog = w.backlog[1:]
+	}
+}
+
+func (w *socketWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
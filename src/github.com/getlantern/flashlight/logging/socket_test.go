@@ -0,0 +1,79 @@
+// +build !windows
+
+package logging
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketWriter(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collector.socket")
+
+	accept := func(l net.Listener) *bufio.Reader {
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatalf("Unable to accept: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return bufio.NewReader(conn)
+	}
+
+	l, err := net.Listen("unix", path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	wc, err := newSocketWriter(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer wc.Close()
+	w := wc.(*socketWriter)
+	r := accept(l)
+	w.Write([]byte("line 1\n"))
+	line, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "line 1\n", line)
+
+	// Simulate a collector restart
+	l.Close()
+	w.mutex.Lock()
+	w.conn.Close()
+	w.conn = nil
+	w.mutex.Unlock()
+	w.Write([]byte("line 2\n"))
+
+	l, err = net.Listen("unix", path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	w.mutex.Lock()
+	w.lastAttempt = time.Time{}
+	w.mutex.Unlock()
+	w.Write([]byte("line 3\n"))
+	r = accept(l)
+	for _, expected := range []string{"line 2\n", "line 3\n"} {
+		line, err = r.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, expected, line, "should send the backlog after reconnecting")
+	}
+}
+
+func TestSocketWriterBacklog(t *testing.T) {
+	w := &socketWriter{}
+	line := make([]byte, socketBacklogSize/4)
+	for i := 0; i < 10; i++ {
+		w.hold(line)
+	}
+	assert.Equal(t, 4, len(w.backlog), "should cap the backlog")
+	assert.Equal(t, socketBacklogSize, w.backlogSize)
+}
@@ -0,0 +1,10 @@
+package logging
+
+import (
+	"errors"
+	"io"
+)
+
+func newSocketWriter(path string) (io.WriteCloser, error) {
+	return nil, errors.New("Logging to a Unix domain socket is not supported on Windows")
+}
@@ -0,0 +1,236 @@
+package logging
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxLoggerCounts bounds the number of loggers errors are counted for, in
+	// case some logger names are dynamic. Further loggers are counted under
+	// otherLoggers.
+	maxLoggerCounts = 100
+	otherLoggers    = "other"
+)
+
+var (
+	errorLines uint64
+	debugLines uint64
+
+	loggerCounts      = make(map[string]*uint64)
+	loggerCountsMutex sync.RWMutex
+
+	// statsBaseline holds the counters as of the last ResetStats. The
+	// counters themselves are never reset, so that their other users like
+	// OnErrorRate keep seeing them increase.
+	statsBaseline Statistics
+	statsMutex    sync.RWMutex
+)
+
+// Statistics is a snapshot of the counters kept by the logging package.
+//
+// The line counters (ErrorLines, DebugLines, ThrottledLines, DeniedLines,
+// FilteredLines, PausedLines, SampledLines, RateLimitedLines, DedupedLines and
+// ObserverDroppedLines) count since the process started or the last
+// ResetStats. LogglyGroups, LogglyBacklog, LogglyInFlight, FileRotationSize,
+// OpenLogFiles and BufferBytes are current values, and the latencies and
+// RotationErrors are cumulative, neither being affected by ResetStats.
+type Statistics struct {
+	// ErrorLines is the number of lines written to the error stream
+	ErrorLines uint64
+	// DebugLines is the number of lines written to the debug stream
+	DebugLines uint64
+	// ThrottledLines is the number of lines dropped from the log file because
+	// of Options.FileBytesPerSecond
+	ThrottledLines uint64
+	// DeniedLines is the number of lines dropped because of Options.Denylist
+	DeniedLines uint64
+	// FilteredLines is the number of lines dropped by the regex filters
+	FilteredLines uint64
+	// PausedLines is the number of lines lost because they were logged while
+	// paused
+	PausedLines uint64
+	// SampledLines is the number of lines dropped because of
+	// Options.SampleRates
+	SampledLines uint64
+	// RateLimitedLines is the number of lines dropped from the log file
+	// because of Options.RateLimits, by level
+	RateLimitedLines map[string]uint64
+	// DedupedLines is the number of lines dropped from the log file because
+	// of Options.FileDuplicateWindow
+	DedupedLines uint64
+	// LogglyGroups is the number of distinct messages sent to Loggly that
+	// count towards Options.LogglyMaxGroups
+	LogglyGroups uint64
+	// LogglyBacklog is the number of messages waiting to be sent to Loggly in
+	// the next batch
+	LogglyBacklog int64
+	// LogglyInFlight is the number of requests to Loggly currently in flight
+	LogglyInFlight int64
+	// ObserverDroppedLines is the number of lines not passed to line observers
+	// because they were falling behind
+	ObserverDroppedLines uint64
+	// FileWriteLatency is how long writes to the log file take
+	FileWriteLatency Latency
+	// RotationLatency is how long rotations of the log file take, not
+	// including compression, which happens in the background
+	RotationLatency Latency
+	// FileRotationSize is the size at which the log file is currently rotated,
+	// which varies with Options.MaxRotationSize
+	FileRotationSize int64
+	// OpenLogFiles is the number of log files currently open
+	OpenLogFiles int64
+	// RotationErrors is the number of errors deleting, compressing or
+	// checksumming rotated log files, which are printed to stderr since they
+	// can't be logged
+	RotationErrors uint64
+	// BufferBytes is the size of the lines currently kept in memory for
+	// RecentLogs, RecentErrors and CaptureScope, see Options.MaxBufferBytes
+	BufferBytes int64
+}
+
+// Stats returns a snapshot of the current logging counters.
+func Stats() Statistics {
+	statsMutex.RLock()
+	defer statsMutex.RUnlock()
+	stats := readStats()
+	base := statsBaseline
+	stats.ErrorLines -= base.ErrorLines
+	stats.DebugLines -= base.DebugLines
+	stats.ThrottledLines -= base.ThrottledLines
+	stats.DeniedLines -= base.DeniedLines
+	stats.FilteredLines -= base.FilteredLines
+	stats.PausedLines -= base.PausedLines
+	stats.SampledLines -= base.SampledLines
+	stats.DedupedLines -= base.DedupedLines
+	stats.ObserverDroppedLines -= base.ObserverDroppedLines
+	for level, count := range stats.RateLimitedLines {
+		if count -= base.RateLimitedLines[level]; count > 0 {
+			stats.RateLimitedLines[level] = count
+		} else {
+			delete(stats.RateLimitedLines, level)
+		}
+	}
+	return stats
+}
+
+// ResetStats zeroes the line counters returned by Stats, e.g. at the start
+// of each reporting period, so that monitoring can read per-period counts.
+// See Statistics for which counters are affected.
+func ResetStats() {
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	statsBaseline = readStats()
+}
+
+// readStats reads the counters as they are.
+func readStats() Statistics {
+	stats := Statistics{
+		ErrorLines:     atomic.LoadUint64(&errorLines),
+		DebugLines:     atomic.LoadUint64(&debugLines),
+		ThrottledLines: atomic.LoadUint64(&throttledLines),
+		DeniedLines:    atomic.LoadUint64(&deniedLines),
+		FilteredLines:  atomic.LoadUint64(&filteredLines),
+		PausedLines:    atomic.LoadUint64(&pausedLines),
+		SampledLines:   atomic.LoadUint64(&sampledLines),
+
+		RateLimitedLines: rateLimitedCounts(),
+		DedupedLines:     atomic.LoadUint64(&dedupedLines),
+
+		LogglyGroups:   atomic.LoadUint64(&logglyGroups),
+		LogglyBacklog:  atomic.LoadInt64(&logglyBacklog),
+		LogglyInFlight: atomic.LoadInt64(&logglyInFlight),
+
+		ObserverDroppedLines: atomic.LoadUint64(&observerDroppedLines),
+
+		FileWriteLatency: fileWriteLatency.snapshot(),
+		RotationLatency:  rotationLatency.snapshot(),
+
+		OpenLogFiles:   atomic.LoadInt64(&openLogFiles),
+		RotationErrors: atomic.LoadUint64(&rotationErrors),
+		BufferBytes:    bufferUsage(),
+	}
+	if f := currentLogFile(); f != nil {
+		stats.FileRotationSize = f.currentRotationSize()
+	}
+	return stats
+}
+
+type lineCounter struct {
+	io.Writer
+	count *uint64
+}
+
+// countLines creates a writer that increments count on every write, relying
+// on golog writing each line in whole.
+func countLines(w io.Writer, count *uint64) io.Writer {
+	return &lineCounter{w, count}
+}
+
+func (w *lineCounter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *lineCounter) writeAt(p []byte, t time.Time) (int, error) {
+	atomic.AddUint64(w.count, 1)
+	return writeTimed(w.Writer, p, t)
+}
+
+// ErrorCountsByLogger returns the number of lines written to the error stream
+// by each logger, like flashlight.proxy, to see which subsystem fails most.
+// Lines not coming from a logger are counted under "".
+func ErrorCountsByLogger() map[string]uint64 {
+	loggerCountsMutex.RLock()
+	defer loggerCountsMutex.RUnlock()
+	counts := make(map[string]uint64, len(loggerCounts))
+	for logger, count := range loggerCounts {
+		counts[logger] = atomic.LoadUint64(count)
+	}
+	return counts
+}
+
+type loggerCounter struct {
+	io.Writer
+}
+
+// countByLogger creates a writer that counts the lines written to it by
+// logger.
+func countByLogger(w io.Writer) io.Writer {
+	return &loggerCounter{w}
+}
+
+func (w *loggerCounter) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *loggerCounter) writeAt(p []byte, t time.Time) (int, error) {
+	_, logger, _ := parseLine(string(p))
+	atomic.AddUint64(loggerCount(logger), 1)
+	return writeTimed(w.Writer, p, t)
+}
+
+// loggerCount returns the counter for the given logger, adding it if needed.
+func loggerCount(logger string) *uint64 {
+	loggerCountsMutex.RLock()
+	count := loggerCounts[logger]
+	loggerCountsMutex.RUnlock()
+	if count != nil {
+		return count
+	}
+	loggerCountsMutex.Lock()
+	defer loggerCountsMutex.Unlock()
+	if count = loggerCounts[logger]; count != nil {
+		return count
+	}
+	if len(loggerCounts) >= maxLoggerCounts {
+		logger = otherLoggers
+		if count = loggerCounts[logger]; count != nil {
+			return count
+		}
+	}
+	count = new(uint64)
+	loggerCounts[logger] = count
+	return count
+}
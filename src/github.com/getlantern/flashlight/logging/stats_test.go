@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCountsByLogger(t *testing.T) {
+	loggerCountsMutex.Lock()
+	loggerCounts = make(map[string]*uint64)
+	loggerCountsMutex.Unlock()
+
+	w := countByLogger(ioutil.Discard)
+	w.Write([]byte("ERROR flashlight.proxy: a.go:1 failed\n"))
+	w.Write([]byte("ERROR flashlight.proxy: a.go:2 failed again\n"))
+	w.Write([]byte("FATAL flashlight: a.go:3 dying\n"))
+	w.Write([]byte("not a golog line\n"))
+	assert.Equal(t, map[string]uint64{"flashlight.proxy": 2, "flashlight": 1, "": 1}, ErrorCountsByLogger())
+
+	for i := 0; i < maxLoggerCounts*2; i++ {
+		w.Write([]byte(fmt.Sprintf("ERROR dynamic-%d: a.go:1 failed\n", i)))
+	}
+	counts := ErrorCountsByLogger()
+	assert.Equal(t, maxLoggerCounts+1, len(counts), "should bound the number of loggers")
+	assert.Equal(t, uint64(maxLoggerCounts+3), counts[otherLoggers])
+	assert.Equal(t, uint64(2), counts["flashlight.proxy"], "should keep counting known loggers")
+}
+
+func TestResetStats(t *testing.T) {
+	defer ResetStats()
+	atomic.AddUint64(&errorLines, 3)
+	atomic.AddUint64(rateLimitedLines[levelDebug], 2)
+	ResetStats()
+	stats := Stats()
+	assert.Equal(t, uint64(0), stats.ErrorLines)
+	assert.Empty(t, stats.RateLimitedLines)
+
+	atomic.AddUint64(&errorLines, 1)
+	atomic.AddUint64(rateLimitedLines[levelDebug], 1)
+	stats = Stats()
+	assert.Equal(t, uint64(1), stats.ErrorLines)
+	assert.Equal(t, map[string]uint64{levelDebug: 1}, stats.RateLimitedLines)
+}
+
+func TestResetStatsConcurrently(t *testing.T) {
+	ResetStats()
+	defer ResetStats()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				atomic.AddUint64(&debugLines, 1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ResetStats()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.True(t, Stats().DebugLines <= 4000, "counters shouldn't wrap around on reset")
+			}
+		}()
+	}
+	wg.Wait()
+}
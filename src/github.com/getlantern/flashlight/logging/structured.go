@@ -0,0 +1,224 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/getlantern/golog"
+)
+
+// currentOutputs holds the outputs last given to golog, which structured
+// lines are written to directly so that they carry the caller's file and line.
+var currentOutputs atomic.Value
+
+func init() {
+	currentOutputs.Store(outputs{os.Stderr, os.Stdout})
+}
+
+type outputs struct {
+	errorOut io.Writer
+	debugOut io.Writer
+}
+
+// debugStream writes to the debug output last given to golog, so that lines
+// from this package are filtered, masked and ordered like logged ones.
+type debugStream struct{}
+
+func (debugStream) Write(p []byte) (int, error) {
+	return currentOutputs.Load().(outputs).debugOut.Write(p)
+}
+
+// setGologOutputs sets golog's outputs, remembering them for structured
+// lines.
+func setGologOutputs(errOut io.Writer, dbgOut io.Writer) {
+	golog.SetOutputs(errOut, dbgOut)
+	currentOutputs.Store(outputs{errOut, dbgOut})
+}
+
+// resetGologOutputs resets golog to its default outputs.
+func resetGologOutputs() {
+	golog.ResetOutputs()
+	currentOutputs.Store(outputs{os.Stderr, os.Stdout})
+}
+
+// Errorf logs an error like golog's Errorf for the given logger, with the
+// given fields appended to the line as {key=value ...}. Loggly receives the
+// fields in the extra map without them affecting grouping. Keys may only
+// contain letters, digits, dots, dashes and underscores, others are left out.
+func Errorf(logger string, fields map[string]string, message string, args ...interface{}) {
+	logStructured(currentOutputs.Load().(outputs).errorOut, levelError, logger, fields, message, args...)
+}
+
+// Debugf logs at DEBUG level like golog's Debugf for the given logger, with
+// the given fields appended like Errorf does.
+func Debugf(logger string, fields map[string]string, message string, args ...interface{}) {
+	logStructured(currentOutputs.Load().(outputs).debugOut, levelDebug, logger, fields, message, args...)
+}
+
+// opKey is the context key for the operation id set by WithOp.
+type opKey struct{}
+
+// WithOp returns a context carrying the given operation id, which
+// ErrorfContext and DebugfContext include in each line so that all lines for
+// a single operation can be found, in the file and in Loggly. A random id is
+// generated if opID is empty.
+func WithOp(ctx context.Context, opID string) context.Context {
+	if opID == "" {
+		opID = newCorrelationId()
+	}
+	return context.WithValue(ctx, opKey{}, opID)
+}
+
+// OpFrom returns the operation id set by WithOp, or "" if there's none.
+func OpFrom(ctx context.Context) string {
+	opID, _ := ctx.Value(opKey{}).(string)
+	return opID
+}
+
+// ErrorfContext is like Errorf, also prepending "[op=id] " to the message and
+// adding the op field if ctx carries an operation id (see WithOp).
+func ErrorfContext(ctx context.Context, logger string, fields map[string]string, message string, args ...interface{}) {
+	fields, message = withOp(ctx, fields, message)
+	logStructured(currentOutputs.Load().(outputs).errorOut, levelError, logger, fields, message, args...)
+}
+
+// DebugfContext is like Debugf, adding the operation id like ErrorfContext
+// does.
+func DebugfContext(ctx context.Context, logger string, fields map[string]string, message string, args ...interface{}) {
+	fields, message = withOp(ctx, fields, message)
+	logStructured(currentOutputs.Load().(outputs).debugOut, levelDebug, logger, fields, message, args...)
+}
+
+// withOp adds the operation id from ctx, if any, to a copy of fields and to
+// the beginning of message.
+func withOp(ctx context.Context, fields map[string]string, message string) (map[string]string, string) {
+	opID := OpFrom(ctx)
+	if opID == "" {
+		return fields, message
+	}
+	withOp := make(map[string]string, len(fields)+1)
+	for k, v := range fields {
+		withOp[k] = v
+	}
+	withOp["op"] = opID
+	return withOp, "[op=" + strings.Replace(opID, "%", "%%", -1) + "] " + message
+}
+
+func logStructured(out io.Writer, level string, logger string, fields map[string]string, message string, args ...interface{}) {
+	location := "???:0"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		location = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	// Write the line at once, just like golog does
+	io.WriteString(out, fmt.Sprintf("%s %s: %s %s%s\n", level, logger, location,
+		fmt.Sprintf(message, args...), formatFields(fields)))
+}
+
+// formatFields renders fields sorted by key as " {key=value ...}", or "" if
+// there are none.
+func formatFields(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if validTag(key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(" {")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(fieldValue(fields[key]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// fieldValue quotes value like logfmtValue does, also quoting braces so that
+// the end of the fields is unambiguous.
+func fieldValue(value string) string {
+	if strings.ContainsAny(value, "{}") {
+		return strconv.Quote(value)
+	}
+	return logfmtValue(value)
+}
+
+// parseFields splits the fields appended by formatFields off the end of line,
+// returning the line without them. Lines without fields are returned as is
+// with nil fields.
+func parseFields(line string) (string, map[string]string) {
+	trimmed := strings.TrimRight(line, "\r\n")
+	if !strings.HasSuffix(trimmed, "}") {
+		return line, nil
+	}
+	for end := len(trimmed); end > 0; {
+		start := strings.LastIndex(trimmed[:end], " {")
+		if start < 0 {
+			break
+		}
+		if fields := parseFieldList(trimmed[start+2 : len(trimmed)-1]); fields != nil {
+			return trimmed[:start] + line[len(trimmed):], fields
+		}
+		end = start
+	}
+	return line, nil
+}
+
+// parseFieldList parses "key=value ..." as rendered by formatFields, returning
+// nil if it's not valid.
+func parseFieldList(s string) map[string]string {
+	fields := make(map[string]string)
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || !validTag(s[:eq]) {
+			return nil
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil
+			}
+			value, _ = strconv.Unquote(quoted)
+			s = s[len(quoted):]
+		} else {
+			i := strings.IndexByte(s, ' ')
+			if i < 0 {
+				i = len(s)
+			}
+			value = s[:i]
+			if strings.ContainsAny(value, `{}"=`) {
+				return nil
+			}
+			s = s[i:]
+		}
+		fields[key] = value
+		if len(s) > 0 {
+			if s[0] != ' ' {
+				return nil
+			}
+			s = s[1:]
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
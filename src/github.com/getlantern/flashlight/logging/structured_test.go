@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructuredLogging(t *testing.T) {
+	var errBuf, dbgBuf bytes.Buffer
+	setGologOutputs(&errBuf, &dbgBuf)
+	defer resetGologOutputs()
+
+	Errorf("flashlight.proxy", map[string]string{"proxy": "10.0.0.1:443", "attempt": "2", "bad key": "x"}, "unable to dial: %v", "timeout")
+	Debugf("flashlight.proxy", nil, "dialing %v", "10.0.0.1:443")
+	assert.Regexp(t, `^ERROR flashlight.proxy: structured_test.go:\d+ unable to dial: timeout \{attempt=2 proxy=10.0.0.1:443\}\n$`, errBuf.String(),
+		"should report the caller and leave out invalid keys")
+	assert.Regexp(t, `^DEBUG flashlight.proxy: structured_test.go:\d+ dialing 10.0.0.1:443\n$`, dbgBuf.String())
+}
+
+func TestParseFields(t *testing.T) {
+	fields := map[string]string{"a": "plain", "b": "with space", "c": "{braces}", "d": "", "e": `quo"te`}
+	line := "ERROR test: a.go:1 failed {with} braces" + formatFields(fields) + "\n"
+	stripped, parsed := parseFields(line)
+	assert.Equal(t, "ERROR test: a.go:1 failed {with} braces\n", stripped)
+	assert.Equal(t, fields, parsed)
+
+	for _, line := range []string{
+		"ERROR test: a.go:1 failed\n",
+		"ERROR test: a.go:1 failed {not fields}\n",
+		"ERROR test: a.go:1 failed {}\n",
+	} {
+		stripped, parsed := parseFields(line)
+		assert.Equal(t, line, stripped)
+		assert.Nil(t, parsed)
+	}
+}
+
+func TestLogglyFields(t *testing.T) {
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender}
+	line := "ERROR flashlight.proxy: a.go:1 unable to dial: timeout" +
+		formatFields(map[string]string{"proxy": "10.0.0.1:443", "logLevel": "spoofed"}) + "\n"
+	lw.Write([]byte(line))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 1) {
+		extra := msgs[0]["extra"].(map[string]string)
+		assert.Equal(t, "10.0.0.1:443", extra["proxy"])
+		assert.Equal(t, "ERROR", extra["logLevel"], "fields shouldn't override built-in ones")
+		assert.Equal(t, "a.go:1 unable to dial: timeout", msgs[0]["message"], "fields shouldn't affect grouping")
+		assert.Equal(t, line, msgs[0]["fullMessage"])
+	}
+}
+
+func TestOpContext(t *testing.T) {
+	var errBuf, dbgBuf bytes.Buffer
+	setGologOutputs(&errBuf, &dbgBuf)
+	defer resetGologOutputs()
+
+	assert.Equal(t, "", OpFrom(context.Background()))
+	ctx := WithOp(context.Background(), "connect-1")
+	assert.Equal(t, "connect-1", OpFrom(ctx))
+	generated := OpFrom(WithOp(context.Background(), ""))
+	assert.Len(t, generated, 16, "should generate an id when none is given")
+	assert.NotEqual(t, generated, OpFrom(WithOp(context.Background(), "")))
+
+	fields := map[string]string{"proxy": "10.0.0.1:443"}
+	ErrorfContext(ctx, "flashlight.proxy", fields, "unable to dial: %v", "timeout")
+	DebugfContext(context.Background(), "flashlight.proxy", nil, "no op")
+	assert.Regexp(t, `^ERROR flashlight.proxy: structured_test.go:\d+ \[op=connect-1\] unable to dial: timeout \{op=connect-1 proxy=10.0.0.1:443\}\n$`, errBuf.String())
+	assert.Regexp(t, `^DEBUG flashlight.proxy: structured_test.go:\d+ no op\n$`, dbgBuf.String())
+	assert.Len(t, fields, 1, "shouldn't modify the given fields")
+
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender}
+	lw.Write(errBuf.Bytes())
+	if msgs := sender.sent(); assert.Len(t, msgs, 1) {
+		assert.Equal(t, "connect-1", msgs[0]["extra"].(map[string]string)["op"])
+	}
+}
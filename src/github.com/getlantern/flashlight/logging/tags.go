@@ -0,0 +1,29 @@
+package logging
+
+// validTags returns the tags that Loggly accepts, leaving out empty ones and
+// logging others.
+func validTags(tags []string) []string {
+	valid := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		if !validTag(tag) {
+			log.Errorf("Invalid Loggly tag, leaving it out: %q", tag)
+			continue
+		}
+		valid = append(valid, tag)
+	}
+	return valid
+}
+
+// validTag checks that the tag only has letters, digits, dots, dashes and
+// underscores, as required by Loggly.
+func validTag(tag string) bool {
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
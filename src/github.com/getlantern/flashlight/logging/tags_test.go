@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidTags(t *testing.T) {
+	assert.Equal(t, []string{"lantern", "beta-channel", "v2.0_1"}, validTags([]string{"lantern", "", "beta-channel", "no spaces", "v2.0_1", "a,b"}))
+}
+
+func TestLogglyLineTags(t *testing.T) {
+	sender := newFakeSender()
+	lw := &logglyErrorWriter{client: sender, lineTags: true}
+	lw.Write([]byte("ERROR flashlight.proxy: tags_test.go:1 failed\n"))
+	lw.Write([]byte("not a golog line\n"))
+	msgs := sender.sent()
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, []string{"error", "flashlight.proxy"}, msgs[0]["tags"])
+		assert.Equal(t, []string{"error"}, msgs[1]["tags"], "should default to the error level")
+	}
+
+	sender = newFakeSender()
+	lw = &logglyErrorWriter{client: sender}
+	lw.Write([]byte("ERROR flashlight.proxy: tags_test.go:1 failed\n"))
+	_, found := sender.sent()[0]["tags"]
+	assert.False(t, found, "should not tag lines by default")
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// testErrorTimeout bounds how long SendTestError waits for Loggly
+	testErrorTimeout = 10 * time.Second
+)
+
+var (
+	errLogglyDisabled = errors.New("Loggly is not enabled")
+
+	// logglyInUse holds the senderBox of the active Loggly writer
+	logglyInUse atomic.Value
+
+	testErrorSeq uint64
+)
+
+func init() {
+	logglyInUse.Store(senderBox{})
+}
+
+// senderBox allows storing a possibly nil logglySender in an atomic.Value.
+type senderBox struct {
+	sender logglySender
+}
+
+// flushingSender is a logglySender that can send what it has queued right
+// away, like the actual Loggly client.
+type flushingSender interface {
+	Flush() error
+}
+
+// SendTestError logs an ERROR line containing the given tag and a unique id
+// through the usual outputs and waits for it to be sent to Loggly, so that
+// support staff can check that logs reach Loggly end to end by looking for the
+// tag. It returns an error if Loggly isn't enabled or the line couldn't be sent
+// within 10 seconds. Note that the line may still be dropped before reaching
+// Loggly by Options like Denylist or SampleRates.
+func SendTestError(tag string) error {
+	box := logglyInUse.Load().(senderBox)
+	if box.sender == nil || activeLoggly() == nil {
+		return errLogglyDisabled
+	}
+	id := fmt.Sprintf("%d-%d", time.Now().Unix(), atomic.AddUint64(&testErrorSeq, 1))
+	log.Errorf("Test error %v (id %v)", tag, id)
+
+	f, ok := box.sender.(flushingSender)
+	if !ok {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f.Flush()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("Unable to send test error to Loggly: %v", err)
+		}
+		return nil
+	case <-time.After(testErrorTimeout):
+		return errors.New("Timed out sending test error to Loggly")
+	}
+}
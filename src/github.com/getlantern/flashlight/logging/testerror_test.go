@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getlantern/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+// flushingFakeSender is a fakeSender that can fail its flushes.
+type flushingFakeSender struct {
+	*fakeSender
+	flushErr error
+}
+
+func (s *flushingFakeSender) Flush() error {
+	return s.flushErr
+}
+
+func TestSendTestError(t *testing.T) {
+	defer golog.ResetOutputs()
+	assert.Equal(t, errLogglyDisabled, SendTestError("support-123"))
+
+	sender := &flushingFakeSender{fakeSender: newFakeSender()}
+	addLoggly(&logglyErrorWriter{client: sender})
+	logglyInUse.Store(senderBox{sender})
+	defer removeLoggly()
+
+	assert.NoError(t, SendTestError("support-123"))
+	sent := sender.sent()
+	if assert.Len(t, sent, 1) {
+		assert.Contains(t, sent[0]["fullMessage"], "Test error support-123 (id ")
+	}
+
+	sender.flushErr = errors.New("unreachable")
+	assert.Error(t, SendTestError("support-123"), "should report failed sends")
+
+	removeLoggly()
+	assert.Equal(t, errLogglyDisabled, SendTestError("support-123"))
+}
+
+func TestSendTestErrorRejected(t *testing.T) {
+	defer golog.ResetOutputs()
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := newLogglyClient("token", &http.Client{})
+	client.Endpoint = server.URL
+	batch := newBatchingSender(client, logglyBatchSize, 1, time.Hour)
+	addLoggly(&logglyErrorWriter{client: batch})
+	logglyInUse.Store(senderBox{batch})
+	defer removeLoggly()
+	defer batch.stop()
+
+	err := SendTestError("support-123")
+	if assert.Error(t, err, "should report batches Loggly rejects") {
+		assert.Contains(t, err.Error(), "403")
+	}
+}
@@ -0,0 +1,170 @@
+package logging
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	throttledLines uint64
+
+	fileThrottle *throttledWriter
+)
+
+// throttledWriter limits the rate at which bytes are written to an underlying
+// writer, to protect slow storage during log storms. Lines that exceed the
+// rate are buffered and written as the budget allows. When the buffer is full,
+// the oldest buffered TRACE and DEBUG lines are dropped. Other lines are never
+// dropped, even if that means exceeding the buffer.
+type throttledWriter struct {
+	w           io.Writer
+	rate        float64
+	maxBuffered int
+	now         func() time.Time
+
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	queue       []throttledLine
+	queuedBytes int
+	tokens      float64
+	last        time.Time
+	stopped     bool
+}
+
+// throttledLine is a line logged at t that's waiting for the budget.
+type throttledLine struct {
+	p []byte
+	t time.Time
+}
+
+// throttle creates a throttledWriter allowing up to bytesPerSecond to w,
+// buffering up to maxBuffered bytes.
+func throttle(w io.Writer, bytesPerSecond int, maxBuffered int) *throttledWriter {
+	t := &throttledWriter{
+		w:           w,
+		rate:        float64(bytesPerSecond),
+		maxBuffered: maxBuffered,
+		now:         time.Now,
+		tokens:      float64(bytesPerSecond),
+	}
+	t.cond = sync.NewCond(&t.mutex)
+	t.last = t.now()
+	go t.drain()
+	return t
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	return t.writeAt(p, time.Now())
+}
+
+func (t *throttledWriter) writeAt(p []byte, at time.Time) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stopped {
+		return writeTimed(t.w, p, at)
+	}
+
+	t.refill()
+	if len(t.queue) == 0 && t.hasTokensFor(len(p)) {
+		t.tokens -= float64(len(p))
+		return writeTimed(t.w, p, at)
+	}
+
+	t.queue = append(t.queue, throttledLine{append([]byte(nil), p...), at})
+	t.queuedBytes += len(p)
+	for i := 0; t.queuedBytes > t.maxBuffered && i < len(t.queue); {
+		if isVerbose(levelOf(t.queue[i].p)) {
+			t.queuedBytes -= len(t.queue[i].p)
+			t.queue = append(t.queue[:i], t.queue[i+1:]...)
+			atomic.AddUint64(&throttledLines, 1)
+		} else {
+			i++
+		}
+	}
+	t.cond.Signal()
+	return len(p), nil
+}
+
+// drain writes buffered lines as the budget allows until stopped.
+func (t *throttledWriter) drain() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for {
+		for !t.stopped && len(t.queue) == 0 {
+			t.cond.Wait()
+		}
+		if t.stopped {
+			return
+		}
+		t.refill()
+		for len(t.queue) > 0 && t.hasTokensFor(len(t.queue[0].p)) {
+			t.tokens -= float64(len(t.queue[0].p))
+			t.writeHead()
+		}
+		if len(t.queue) > 0 {
+			needed := float64(len(t.queue[0].p))
+			if needed > t.rate {
+				needed = t.rate
+			}
+			wait := time.Duration((needed - t.tokens) / t.rate * float64(time.Second))
+			t.mutex.Unlock()
+			time.Sleep(wait)
+			t.mutex.Lock()
+		}
+	}
+}
+
+// flush writes out everything buffered right away, regardless of the rate.
+func (t *throttledWriter) flush() {
+	t.mutex.Lock()
+	t.writeAll()
+	t.mutex.Unlock()
+}
+
+// stop writes out everything still buffered regardless of the rate, and
+// makes further writes go straight through.
+func (t *throttledWriter) stop() {
+	t.mutex.Lock()
+	t.stopped = true
+	t.writeAll()
+	t.cond.Broadcast()
+	t.mutex.Unlock()
+}
+
+func (t *throttledWriter) writeAll() {
+	for len(t.queue) > 0 {
+		t.writeHead()
+	}
+}
+
+func (t *throttledWriter) writeHead() {
+	writeTimed(t.w, t.queue[0].p, t.queue[0].t)
+	t.queuedBytes -= len(t.queue[0].p)
+	t.queue[0] = throttledLine{}
+	t.queue = t.queue[1:]
+}
+
+// refill adds tokens for the time elapsed, allowing at most a second's worth
+// of burst.
+func (t *throttledWriter) refill() {
+	now := t.now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+	t.last = now
+}
+
+// hasTokensFor tells whether n bytes can be written now. Lines larger than a
+// second's worth of budget only require a full budget.
+func (t *throttledWriter) hasTokensFor(n int) bool {
+	needed := float64(n)
+	if needed > t.rate {
+		needed = t.rate
+	}
+	return t.tokens >= needed
+}
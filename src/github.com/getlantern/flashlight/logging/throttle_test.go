@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	var buf syncBuffer
+	tw := throttle(&buf, 100, 200)
+	// Freeze the clock so that the budget never refills
+	now := time.Now()
+	tw.mutex.Lock()
+	tw.now = func() time.Time { return now }
+	tw.last = now
+	tw.mutex.Unlock()
+
+	line := func(level string, i int) []byte {
+		l := fmt.Sprintf("%s test: throttle_test.go:%d ", level, i)
+		return []byte(l + strings.Repeat("x", 99-len(l)) + "\n")
+	}
+
+	droppedBefore := atomic.LoadUint64(&throttledLines)
+	tw.Write(line("DEBUG", 1))
+	assert.Equal(t, string(line("DEBUG", 1)), buf.String(), "first line should be written within budget")
+	tw.Write(line("DEBUG", 2))
+	tw.Write(line("DEBUG", 3))
+	assert.Equal(t, string(line("DEBUG", 1)), buf.String(), "lines over budget should be buffered")
+	tw.Write(line("DEBUG", 4))
+	tw.Write(line("ERROR", 5))
+	tw.Write(line("ERROR", 6))
+	tw.Write(line("ERROR", 7))
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&throttledLines)-droppedBefore, "oldest debug lines should have been dropped")
+
+	tw.stop()
+	expected := string(line("DEBUG", 1)) + string(line("ERROR", 5)) + string(line("ERROR", 6)) + string(line("ERROR", 7))
+	assert.Equal(t, expected, buf.String(), "errors should never be dropped")
+}
+
+func TestThrottleDrains(t *testing.T) {
+	var buf syncBuffer
+	tw := throttle(&buf, 10000, 10000)
+	defer tw.stop()
+	for i := 0; i < 20; i++ {
+		tw.Write([]byte(strings.Repeat("x", 999) + "\n"))
+	}
+	for i := 0; i < 100 && len(buf.String()) < 20000; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, 20000, len(buf.String()), "buffered lines should eventually be written")
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webhookRemote = "webhook"
+
+	defaultWebhookRate = 1 * time.Minute
+)
+
+// ConfigureWebhook starts posting errors to the given webhook URL, like a
+// Slack incoming webhook, through the proxy last passed to Configure. The
+// JSON payload's text field is the error line. At most one message is posted
+// per rate (1 minute by default), with the errors in between summarized as
+// "+N more". An empty url stops posting.
+func ConfigureWebhook(url string, rate time.Duration) error {
+	if url == "" {
+		stopWebhook()
+		return nil
+	}
+	client, err := proxiedHTTPClient()
+	if err != nil {
+		return fmt.Errorf("Unable to post errors to webhook: %v", err)
+	}
+	configureWebhook(url, rate, client)
+	return nil
+}
+
+func configureWebhook(url string, rate time.Duration, client *http.Client) *webhookWriter {
+	stopWebhook()
+	if rate <= 0 {
+		rate = defaultWebhookRate
+	}
+	w := &webhookWriter{
+		url:    url,
+		client: client,
+		stop:   make(chan struct{}),
+	}
+	go w.run(rate)
+	setRemote(webhookRemote, w)
+	return w
+}
+
+// stopWebhook stops posting to the webhook, posting the summary of any
+// errors not posted yet.
+func stopWebhook() {
+	w, _ := remote(webhookRemote).(*webhookWriter)
+	if w == nil {
+		return
+	}
+	setRemote(webhookRemote, nil)
+	close(w.stop)
+	w.tick()
+}
+
+// webhookWriter posts the first error of each period to a webhook and counts
+// the rest.
+type webhookWriter struct {
+	url    string
+	client *http.Client
+	stop   chan struct{}
+
+	mutex  sync.Mutex
+	posted bool
+	more   int
+}
+
+func (w *webhookWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	if w.posted {
+		w.more++
+		w.mutex.Unlock()
+		return len(p), nil
+	}
+	w.posted = true
+	w.mutex.Unlock()
+	go w.post(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+func (w *webhookWriter) run(rate time.Duration) {
+	ticker := time.NewTicker(rate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.tick()
+		}
+	}
+}
+
+// tick starts a new period, posting a summary of the errors not posted in
+// the last one. The summary counts as the new period's message.
+func (w *webhookWriter) tick() {
+	w.mutex.Lock()
+	more := w.more
+	w.more = 0
+	w.posted = more > 0
+	w.mutex.Unlock()
+	if more > 0 {
+		w.post(fmt.Sprintf("+%d more", more))
+	}
+}
+
+func (w *webhookWriter) post(text string) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Debugf("Unable to post error to webhook: %v", err)
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Debugf("Unexpected response status posting error to webhook: %v", resp.Status)
+	}
+}
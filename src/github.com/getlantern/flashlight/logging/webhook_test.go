@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	posted := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		posted <- body["text"]
+	}))
+	defer server.Close()
+
+	w := configureWebhook(server.URL, time.Hour, http.DefaultClient)
+	defer stopWebhook()
+	assert.Equal(t, w, remote(webhookRemote), "should add the webhook to the error stream")
+	fmt.Fprintln(w, "ERROR flashlight.proxy: proxy.go:10 unable to dial")
+	fmt.Fprintln(w, "ERROR flashlight.proxy: proxy.go:10 unable to dial")
+	fmt.Fprintln(w, "ERROR flashlight: main.go:1 failed")
+	select {
+	case text := <-posted:
+		assert.Equal(t, "ERROR flashlight.proxy: proxy.go:10 unable to dial", text)
+	case <-time.After(5 * time.Second):
+		t.Fatal("should post the first error")
+	}
+
+	w.tick()
+	assert.Equal(t, "+2 more", <-posted, "should summarize the rest at the end of the period")
+	fmt.Fprintln(w, "ERROR flashlight: main.go:1 failed")
+	w.tick()
+	assert.Equal(t, "+1 more", <-posted, "the summary should count as the period's message")
+	w.tick()
+	fmt.Fprintln(w, "ERROR flashlight: main.go:2 failed again")
+	assert.Equal(t, "ERROR flashlight: main.go:2 failed again", <-posted)
+
+	stopWebhook()
+	assert.Nil(t, remote(webhookRemote))
+	select {
+	case text := <-posted:
+		t.Fatalf("shouldn't post anything else, got %v", text)
+	default:
+	}
+}
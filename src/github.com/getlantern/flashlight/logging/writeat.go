@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriteAt logs msg at the given level as if it happened at time t, e.g. to
+// backfill events captured elsewhere. The line goes to the same outputs with
+// the same formatting as other lines, only timestamped with t instead of the
+// current time, and without a logger or location.
+func WriteAt(t time.Time, level string, msg string) error {
+	level = strings.ToUpper(level)
+	if _, found := levelRanks[level]; !found {
+		return fmt.Errorf("Unknown log level %v", level)
+	}
+	outs := currentOutputs.Load().(outputs)
+	out := outs.debugOut
+	if isErrorLevel(level) {
+		out = outs.errorOut
+	}
+	_, err := writeTimed(out, []byte(level+" "+strings.TrimRight(msg, "\n")+"\n"), t)
+	return err
+}
+
+// timedWriter is implemented by the writers on the write path. They pass the
+// time each line was logged at down to the outputs, so that lines are
+// timestamped with it rather than with the time they're written out, which
+// may be later or, with WriteAt and stages, set explicitly.
+type timedWriter interface {
+	writeAt(p []byte, t time.Time) (int, error)
+}
+
+// writeTimed writes p to w as logged at t, or as logged now if w doesn't take
+// the time.
+func writeTimed(w io.Writer, p []byte, t time.Time) (int, error) {
+	if tw, ok := w.(timedWriter); ok {
+		return tw.writeAt(p, t)
+	}
+	return w.Write(p)
+}
+
+// linePrepender writes the prefix for the time each line was logged at before
+// every line written to it, like wfilter.LinePrepender. Writes are
+// serialized, since the outputs of successive configurations may write to the
+// same console concurrently while one is being replaced.
+type linePrepender struct {
+	w             io.Writer
+	prefix        func(t time.Time) []byte
+	mutex         sync.Mutex
+	prependNeeded bool
+}
+
+func prependLines(w io.Writer, prefix func(t time.Time) []byte) *linePrepender {
+	return &linePrepender{w: w, prefix: prefix, prependNeeded: true}
+}
+
+func (w *linePrepender) Write(p []byte) (int, error) {
+	return w.writeAt(p, time.Now())
+}
+
+func (w *linePrepender) writeAt(p []byte, t time.Time) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.prependNeeded {
+		if _, err := w.w.Write(w.prefix(t)); err != nil {
+			return 0, err
+		}
+		w.prependNeeded = false
+	}
+	total := 0
+	for {
+		i := bytes.IndexByte(p, '\n') + 1
+		if i == 0 {
+			break
+		}
+		if i == len(p) {
+			// The prefix goes before the next line written
+			w.prependNeeded = true
+			break
+		}
+		n, err := w.w.Write(p[:i])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if _, err := w.w.Write(w.prefix(t)); err != nil {
+			return total, err
+		}
+		p = p[i:]
+	}
+	n, err := w.w.Write(p)
+	return total + n, err
+}
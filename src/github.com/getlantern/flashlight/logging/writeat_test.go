@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAt(t *testing.T) {
+	var errBuf, dbgBuf bytes.Buffer
+	setGologOutputs(formatted(&errBuf, FormatJSON), textFormatted(&dbgBuf, true))
+	defer resetGologOutputs()
+
+	ts := time.Date(2015, 6, 1, 12, 30, 15, 250*int(time.Millisecond), time.UTC)
+	assert.Error(t, WriteAt(ts, "verbose", "imported"))
+	assert.NoError(t, WriteAt(ts, "debug", "imported event\n"))
+	assert.NoError(t, WriteAt(ts.Add(time.Second), levelError, "imported failure"))
+	assert.Equal(t, timestampPrefix(ts)+"DEBUG imported event\n", dbgBuf.String(),
+		"should use the given timestamp")
+
+	var record map[string]string
+	if assert.NoError(t, json.Unmarshal(errBuf.Bytes(), &record)) {
+		assert.Equal(t, "2015-06-01T12:30:16.25Z", record["ts"])
+		assert.Equal(t, levelError, record["level"])
+		assert.Equal(t, "imported failure", record["msg"])
+	}
+}
+
+func TestWriteAtOrderedOutput(t *testing.T) {
+	defer resetGologOutputs()
+	var buf bytes.Buffer
+	ordered = newOrderedOutput()
+	defer func() {
+		ordered = nil
+	}()
+	setOutputs(ioutil.Discard, textFormatted(&buf, true))
+
+	ts := time.Date(2015, 6, 1, 12, 30, 15, 0, time.UTC)
+	assert.NoError(t, WriteAt(ts, "debug", "imported event"))
+	ordered.stop()
+	assert.Equal(t, timestampPrefix(ts)+"DEBUG imported event\n", buf.String(),
+		"should keep the given timestamp when written out by another goroutine")
+}